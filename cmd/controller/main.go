@@ -20,13 +20,18 @@ import (
 	"knative.dev/pkg/injection/sharedmain"
 
 	"github.com/infernus01/knative-demo/pkg/reconciler/namespacecleaner"
+	"github.com/infernus01/knative-demo/pkg/reconciler/podcleaner"
 
 	// Import injection packages to register them
+	_ "github.com/infernus01/knative-demo/pkg/client/injection/client"
+	_ "github.com/infernus01/knative-demo/pkg/client/injection/informers/clusterops/v1alpha1/cleanuprun"
 	_ "github.com/infernus01/knative-demo/pkg/client/injection/informers/clusterops/v1alpha1/namespacecleaner"
+	_ "github.com/infernus01/knative-demo/pkg/client/injection/informers/clusterops/v1alpha1/podcleaner"
 	_ "github.com/infernus01/knative-demo/pkg/client/injection/informers/factory"
 	_ "knative.dev/pkg/client/injection/kube/client"
+	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/node"
 )
 
 func main() {
-	sharedmain.Main("namespacecleaner-controller", namespacecleaner.NewController)
+	sharedmain.Main("namespacecleaner-controller", namespacecleaner.NewController, podcleaner.NewController)
 }
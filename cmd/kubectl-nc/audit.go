@@ -0,0 +1,75 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/infernus01/knative-demo/pkg/audit"
+)
+
+// verifyAudit checks that the audit records in the files given in args,
+// oldest first, form an unbroken chain. "-" reads stdin, e.g. piped from
+// kubectl logs. It needs no cluster access.
+func verifyAudit(out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("kubectl nc verify-audit", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), usage) }
+	keyFile := fs.String("key-file", "", "")
+	allowRestarts := fs.Bool("allow-restarts", false, "")
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("verify-audit needs at least one file, see 'kubectl nc help'")
+	}
+
+	v := audit.Verifier{AllowRestarts: *allowRestarts}
+	if v.Key, err = audit.ReadKey(*keyFile); err != nil {
+		return err
+	}
+	for _, name := range files {
+		if err := verifyFile(&v, name); err != nil {
+			return err
+		}
+	}
+	if v.Records == 0 {
+		return errors.New("no audit records found")
+	}
+
+	fmt.Fprintf(out, "Verified %d records, %d to %d\n", v.Records, v.First, v.Last)
+	for _, where := range v.Restarts {
+		fmt.Fprintf(out, "A new chain starts at %s\n", where)
+	}
+	return nil
+}
+
+func verifyFile(v *audit.Verifier, name string) error {
+	if name == "-" {
+		return v.Verify("stdin", os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return v.Verify(name, f)
+}
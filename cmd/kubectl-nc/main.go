@@ -0,0 +1,172 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command kubectl-nc is a kubectl plugin to preview, run and inspect
+// NamespaceCleaners. Install it on the PATH and call it as `kubectl nc`.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	versioned "github.com/infernus01/knative-demo/pkg/generated/clientset/versioned"
+)
+
+const usage = `kubectl nc - preview, run and inspect NamespaceCleaners
+
+Usage:
+  kubectl nc preview <cleaner>                Show the namespaces and pods the cleaner would delete now
+  kubectl nc run <cleaner>                    Request an immediate run
+  kubectl nc suspend <cleaner>                Pause the cleaner
+  kubectl nc resume <cleaner>                 Resume a suspended cleaner
+  kubectl nc status [<cleaner>]               Show the status of one or all cleaners
+  kubectl nc history <cleaner>                List the recorded CleanupRuns of the cleaner
+  kubectl nc extend <namespace> <duration>    Protect a namespace from cleanup for the given duration
+  kubectl nc verify-audit <file>...           Check that audit log files, oldest first, were not tampered with
+
+Flags:
+  --kubeconfig string   Path to the kubeconfig file
+  --context string      Name of the kubeconfig context to use
+  -o, --output string   Output format: table, json or yaml (default "table")
+
+Flags of verify-audit:
+  --key-file string     File holding the key the records were signed with
+  --allow-restarts      Accept new chains starting within the files
+`
+
+// command is the shared state of a single plugin invocation.
+type command struct {
+	kube       kubernetes.Interface
+	clusterops versioned.Interface
+	output     string
+	out        io.Writer
+}
+
+type commandFunc func(ctx context.Context, c *command, args []string) error
+
+var commands = map[string]struct {
+	run   commandFunc
+	nargs []int
+}{
+	"preview": {run: preview, nargs: []int{1}},
+	"run":     {run: requestRun, nargs: []int{1}},
+	"suspend": {run: suspend(true), nargs: []int{1}},
+	"resume":  {run: suspend(false), nargs: []int{1}},
+	"status":  {run: status, nargs: []int{0, 1}},
+	"history": {run: history, nargs: []int{1}},
+	"extend":  {run: extend, nargs: []int{2}},
+}
+
+func main() {
+	if err := run(context.Background(), os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Print(usage)
+		return nil
+	}
+
+	// Audit logs are verified offline.
+	if args[0] == "verify-audit" {
+		return verifyAudit(os.Stdout, args[1:])
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, see 'kubectl nc help'", args[0])
+	}
+
+	fs := flag.NewFlagSet("kubectl nc "+args[0], flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), usage) }
+	kubeconfig := fs.String("kubeconfig", "", "")
+	kubeContext := fs.String("context", "", "")
+	output := fs.String("output", "table", "")
+	fs.StringVar(output, "o", "table", "")
+
+	positional, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if !contains(cmd.nargs, len(positional)) {
+		return fmt.Errorf("wrong number of arguments for %q, see 'kubectl nc help'", args[0])
+	}
+	switch *output {
+	case outputTable, outputJSON, outputYAML:
+	default:
+		return fmt.Errorf("unsupported output format %q", *output)
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = *kubeconfig
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules,
+		&clientcmd.ConfigOverrides{CurrentContext: *kubeContext}).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	c := &command{output: *output, out: os.Stdout}
+	if c.kube, err = kubernetes.NewForConfig(cfg); err != nil {
+		return err
+	}
+	if c.clusterops, err = versioned.NewForConfig(cfg); err != nil {
+		return err
+	}
+
+	return cmd.run(ctx, c, positional)
+}
+
+// parseInterspersed parses flags appearing anywhere in args, returning the
+// positional arguments, so `kubectl nc status foo -o yaml` works.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		if args[0] != "-" && strings.HasPrefix(args[0], "-") {
+			continue
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func contains(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
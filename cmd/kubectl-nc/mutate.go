@@ -0,0 +1,106 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/policy"
+)
+
+// requestRun stamps the run-requested-at annotation, which the controller
+// picks up to run the cleaner out of schedule.
+func requestRun(ctx context.Context, c *command, args []string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				v1alpha1.RunRequestedAtAnnotation: time.Now().UTC().Format(time.RFC3339Nano),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	nc, err := c.clusterops.ClusteropsV1alpha1().NamespaceCleaners().Patch(ctx, args[0], types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	return c.printCleaner(nc, "run requested")
+}
+
+// suspend returns a command setting spec.suspend of a cleaner to value.
+func suspend(value bool) commandFunc {
+	return func(ctx context.Context, c *command, args []string) error {
+		patch, err := json.Marshal(map[string]interface{}{
+			"spec": map[string]bool{"suspend": value},
+		})
+		if err != nil {
+			return err
+		}
+		nc, err := c.clusterops.ClusteropsV1alpha1().NamespaceCleaners().Patch(ctx, args[0], types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return err
+		}
+		if value {
+			return c.printCleaner(nc, "suspended")
+		}
+		return c.printCleaner(nc, "resumed")
+	}
+}
+
+func (c *command) printCleaner(nc *v1alpha1.NamespaceCleaner, action string) error {
+	return c.print(nc, func(w io.Writer) {
+		fmt.Fprintf(w, "namespacecleaner.clusterops.io/%s %s\n", nc.Name, action)
+	})
+}
+
+// extend protects a namespace from every cleaner until now plus the given
+// duration.
+func extend(ctx context.Context, c *command, args []string) error {
+	d, err := time.ParseDuration(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", args[1], err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("duration must be positive, got %s", d)
+	}
+
+	until := time.Now().Add(d).UTC().Format(time.RFC3339)
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{policy.ExtendedUntilAnnotation: until},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	ns, err := c.kube.CoreV1().Namespaces().Patch(ctx, args[0], types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	return c.print(ns, func(w io.Writer) {
+		fmt.Fprintf(w, "namespace/%s extended until %s\n", ns.Name, until)
+	})
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// print writes obj as JSON or YAML, or calls table to render it as a table.
+func (c *command) print(obj interface{}, table func(w io.Writer)) error {
+	switch c.output {
+	case outputJSON:
+		b, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(c.out, string(b))
+		return err
+
+	case outputYAML:
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		_, err = c.out.Write(b)
+		return err
+
+	default:
+		w := tabwriter.NewWriter(c.out, 0, 8, 3, ' ', 0)
+		table(w)
+		return w.Flush()
+	}
+}
+
+// row writes the tab separated columns of a table row.
+func row(w io.Writer, columns ...interface{}) {
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		values[i] = fmt.Sprint(column)
+	}
+	fmt.Fprintln(w, strings.Join(values, "\t"))
+}
+
+// age renders the time elapsed since t the way kubectl does.
+func age(t *metav1.Time) string {
+	if t == nil || t.IsZero() {
+		return "<none>"
+	}
+	return duration.HumanDuration(time.Since(t.Time))
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/pager"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/policy"
+)
+
+// previewPageSize bounds the list requests issued by preview.
+const previewPageSize = 500
+
+type previewResult struct {
+	Cleaner    string             `json:"cleaner"`
+	DryRun     bool               `json:"dryRun,omitempty"`
+	Namespaces []previewNamespace `json:"namespaces"`
+}
+
+type previewNamespace struct {
+	Name string `json:"name"`
+	// Skipped is set when the namespace matches the selector but is not
+	// cleaned, e.g. because its cleanup was extended.
+	Skipped string       `json:"skipped,omitempty"`
+	Pods    []previewPod `json:"pods,omitempty"`
+}
+
+type previewPod struct {
+	Name    string          `json:"name"`
+	Phase   corev1.PodPhase `json:"phase"`
+	Created metav1.Time     `json:"created"`
+	Rule    string          `json:"rule"`
+	Reason  string          `json:"reason"`
+}
+
+// preview evaluates the cleaner client-side with the same policy the
+// controller uses, without deleting anything.
+func preview(ctx context.Context, c *command, args []string) error {
+	nc, err := c.clusterops.ClusteropsV1alpha1().NamespaceCleaners().Get(ctx, args[0], metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	// The other cleaners decide which of the selected namespaces nc owns.
+	list, err := c.clusterops.ClusteropsV1alpha1().NamespaceCleaners().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	cleaners := make([]*v1alpha1.NamespaceCleaner, 0, len(list.Items))
+	for i := range list.Items {
+		cleaners = append(cleaners, &list.Items[i])
+	}
+
+	nodes := map[string]*corev1.Node{}
+	if nc.Spec.OrphanedNode != nil {
+		list, err := c.kube.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list nodes: %w", err)
+		}
+		for i := range list.Items {
+			nodes[list.Items[i].Name] = &list.Items[i]
+		}
+	}
+	lookupNode := func(name string) (*corev1.Node, error) {
+		node, ok := nodes[name]
+		if !ok {
+			return nil, apierrs.NewNotFound(corev1.Resource("nodes"), name)
+		}
+		return node, nil
+	}
+
+	now := time.Now()
+	result := previewResult{Cleaner: nc.Name, DryRun: nc.Spec.DryRun, Namespaces: []previewNamespace{}}
+
+	namespaces := pager.New(func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return c.kube.CoreV1().Namespaces().List(ctx, opts)
+	})
+	namespaces.PageSize = previewPageSize
+	err = namespaces.EachListItem(ctx, metav1.ListOptions{}, func(obj runtime.Object) error {
+		ns := obj.(*corev1.Namespace)
+		decision := policy.EvaluateNamespace(nc, cleaners, ns, now)
+		if !decision.Matches {
+			if decision.Reason != "" {
+				result.Namespaces = append(result.Namespaces, previewNamespace{Name: ns.Name, Skipped: decision.Reason})
+			}
+			return nil
+		}
+
+		entry := previewNamespace{Name: ns.Name}
+		// Finished pods past their TTL are only known to be deleted once
+		// the whole namespace was seen, see spec.retention.
+		var expiry *policy.Expiry
+		jobs := func(name string) (*batchv1.Job, bool) {
+			job, err := c.kube.BatchV1().Jobs(ns.Name).Get(ctx, name, metav1.GetOptions{})
+			return job, err == nil
+		}
+		if nc.Spec.Retention != nil {
+			expiry = policy.NewExpiry(nc.Spec.Retention, jobs)
+		}
+		add := func(pod *corev1.Pod, decision policy.PodDecision) {
+			entry.Pods = append(entry.Pods, previewPod{
+				Name:    pod.Name,
+				Phase:   pod.Status.Phase,
+				Created: pod.CreationTimestamp,
+				Rule:    decision.Rule,
+				Reason:  decision.Reason,
+			})
+		}
+
+		for _, selector := range policy.PodFieldSelectors(nc) {
+			pods := pager.New(func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+				return c.kube.CoreV1().Pods(ns.Name).List(ctx, opts)
+			})
+			pods.PageSize = previewPageSize
+			err := pods.EachListItem(ctx, metav1.ListOptions{FieldSelector: selector}, func(obj runtime.Object) error {
+				pod := obj.(*corev1.Pod)
+				decision, err := policy.EvaluateCleanerPod(nc, pod, lookupNode, now)
+				if err != nil {
+					return err
+				}
+				if expiry != nil && expiry.Hold(pod, decision) {
+					return nil
+				}
+				if decision.Delete {
+					add(pod, decision)
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("failed to list pods in namespace %s: %w", ns.Name, err)
+			}
+		}
+		if expiry != nil {
+			expired, _ := expiry.Release()
+			for _, e := range expired {
+				add(e.Pod, e.Decision)
+			}
+		}
+		result.Namespaces = append(result.Namespaces, entry)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	return c.print(result, func(w io.Writer) {
+		row(w, "NAMESPACE", "POD", "PHASE", "AGE", "RULE", "REASON")
+		for _, ns := range result.Namespaces {
+			if ns.Skipped != "" {
+				row(w, ns.Name, "<skipped>", "", "", "", ns.Skipped)
+				continue
+			}
+			if len(ns.Pods) == 0 {
+				row(w, ns.Name, "<none>", "", "", "", "no pods eligible")
+				continue
+			}
+			for _, pod := range ns.Pods {
+				row(w, ns.Name, pod.Name, pod.Phase, age(&pod.Created), pod.Rule, pod.Reason)
+			}
+		}
+	})
+}
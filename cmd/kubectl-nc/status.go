@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+// status shows one cleaner, or all of them when no name is given.
+func status(ctx context.Context, c *command, args []string) error {
+	var cleaners []v1alpha1.NamespaceCleaner
+	var obj interface{}
+	if len(args) == 1 {
+		nc, err := c.clusterops.ClusteropsV1alpha1().NamespaceCleaners().Get(ctx, args[0], metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		cleaners, obj = []v1alpha1.NamespaceCleaner{*nc}, nc
+	} else {
+		list, err := c.clusterops.ClusteropsV1alpha1().NamespaceCleaners().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		cleaners, obj = list.Items, list
+	}
+
+	return c.print(obj, func(w io.Writer) {
+		row(w, "NAME", "PRIORITY", "SUSPENDED", "DRY RUN", "INTERVAL", "OWNED", "CONFLICTS", "LAST RUN", "LAST RUN AGE")
+		for _, nc := range cleaners {
+			row(w, nc.Name, nc.Spec.Priority, nc.Spec.Suspend, nc.Spec.DryRun, nc.Spec.GetInterval(),
+				nc.Status.OwnedNamespaceCount, orNone(strings.Join(nc.Status.ConflictingCleaners, ",")),
+				orNone(nc.Status.LastRun), age(nc.Status.LastRunTime))
+		}
+	})
+}
+
+// history lists the CleanupRuns of a cleaner, newest first.
+func history(ctx context.Context, c *command, args []string) error {
+	selector := labels.SelectorFromSet(labels.Set{v1alpha1.CleanerLabel: args[0]})
+	list, err := c.clusterops.ClusteropsV1alpha1().CleanupRuns().List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return err
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[j].CreationTimestamp.Before(&list.Items[i].CreationTimestamp)
+	})
+
+	return c.print(list, func(w io.Writer) {
+		row(w, "NAME", "TRIGGER", "PHASE", "DRY RUN", "NAMESPACES", "DELETED", "SKIPPED", "ERRORS", "DURATION", "AGE")
+		for _, run := range list.Items {
+			row(w, run.Name, run.Spec.Trigger, orNone(string(run.Status.Phase)), run.Spec.DryRun,
+				len(run.Status.Namespaces), run.Status.TotalDeleted, run.Status.TotalSkipped, len(run.Status.Errors),
+				runDuration(&run), age(run.Status.StartTime))
+		}
+	})
+}
+
+func runDuration(run *v1alpha1.CleanupRun) string {
+	if run.Status.StartTime == nil || run.Status.CompletionTime == nil {
+		return "<none>"
+	}
+	return run.Status.CompletionTime.Sub(run.Status.StartTime.Time).Round(time.Second).String()
+}
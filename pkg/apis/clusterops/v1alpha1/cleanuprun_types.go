@@ -0,0 +1,158 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// CleanerLabel is set on every CleanupRun to the name of its NamespaceCleaner.
+	CleanerLabel = "clusterops.io/cleaner"
+
+	// RunAnnotation is set on the events recorded during a CleanupRun to
+	// the name of the run, which identifies it in logs, CloudEvents and
+	// traces as well.
+	RunAnnotation = "clusterops.io/run"
+
+	// TraceIDAnnotation records on a CleanupRun the ID of the OpenTelemetry
+	// trace of the run, when the run was sampled.
+	TraceIDAnnotation = "clusterops.io/trace-id"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// one execution of a NamespaceCleaner
+type CleanupRun struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CleanupRunSpec   `json:"spec,omitempty"`
+	Status CleanupRunStatus `json:"status,omitempty"`
+}
+
+// what started the run
+type RunTrigger string
+
+const (
+	// RunTriggerSchedule is a run started because spec.interval elapsed
+	RunTriggerSchedule RunTrigger = "Schedule"
+	// RunTriggerManual is a run requested by a user
+	RunTriggerManual RunTrigger = "Manual"
+	// RunTriggerEvent is a run started because the cleaner was created or changed
+	RunTriggerEvent RunTrigger = "Event"
+)
+
+// how the run went
+type RunPhase string
+
+const (
+	RunPhaseRunning     RunPhase = "Running"
+	RunPhaseSucceeded   RunPhase = "Succeeded"
+	RunPhaseFailed      RunPhase = "Failed"
+	RunPhaseInterrupted RunPhase = "Interrupted"
+)
+
+// how the run was started
+type CleanupRunSpec struct {
+	// Cleaner is the name of the NamespaceCleaner that ran
+	Cleaner string `json:"cleaner"`
+
+	// Trigger is what started the run
+	Trigger RunTrigger `json:"trigger"`
+
+	// DryRun is true when pods were only previewed, not deleted
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// what happened during the run
+type CleanupRunStatus struct {
+	Phase RunPhase `json:"phase,omitempty"`
+
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// TotalDeleted is the number of pods deleted across all namespaces
+	TotalDeleted int32 `json:"totalDeleted,omitempty"`
+
+	// TotalSkipped is the number of deletions skipped across all namespaces
+	TotalSkipped int32 `json:"totalSkipped,omitempty"`
+
+	// TotalBlocked is the number of evictions refused or deferred across all namespaces
+	TotalBlocked int32 `json:"totalBlocked,omitempty"`
+
+	// TotalReclaimedStorage is the capacity of the PersistentVolumeClaims
+	// deleted across all namespaces
+	TotalReclaimedStorage *resource.Quantity `json:"totalReclaimedStorage,omitempty"`
+
+	// Namespaces has one entry per namespace matched by the cleaner
+	Namespaces []NamespaceRunResult `json:"namespaces,omitempty"`
+
+	// Errors that affected the run as a whole
+	Errors []string `json:"errors,omitempty"`
+}
+
+// the outcome of a run in a single namespace
+type NamespaceRunResult struct {
+	Name string `json:"name"`
+
+	// Candidates is the number of pods selected for deletion
+	Candidates int32 `json:"candidates,omitempty"`
+
+	// Deleted is the number of pods actually deleted
+	Deleted int32 `json:"deleted,omitempty"`
+
+	// ForceDeleted is the number of deleted pods that were stuck in Terminating
+	ForceDeleted int32 `json:"forceDeleted,omitempty"`
+
+	// Orphaned is the number of deleted pods whose node was gone or NotReady
+	Orphaned int32 `json:"orphaned,omitempty"`
+
+	// Unschedulable is the number of deleted pods that could not be scheduled
+	Unschedulable int32 `json:"unschedulable,omitempty"`
+
+	// Broken is the number of broken pods reported, deleted or scaled down
+	Broken int32 `json:"broken,omitempty"`
+
+	// Retained is the number of pods past their TTL kept by spec.retention
+	Retained int32 `json:"retained,omitempty"`
+
+	// ConfigDeleted is the number of unreferenced ConfigMaps and Secrets deleted
+	ConfigDeleted int32 `json:"configDeleted,omitempty"`
+
+	// VolumesDeleted is the number of unused PersistentVolumeClaims deleted
+	VolumesDeleted int32 `json:"volumesDeleted,omitempty"`
+
+	// Snapshots is the number of VolumeSnapshots taken of unused claims
+	Snapshots int32 `json:"snapshots,omitempty"`
+
+	// ReclaimedStorage is the capacity of the PersistentVolumeClaims deleted
+	ReclaimedStorage *resource.Quantity `json:"reclaimedStorage,omitempty"`
+
+	// ReplicaSetsDeleted is the number of old ReplicaSets pruned
+	ReplicaSetsDeleted int32 `json:"replicaSetsDeleted,omitempty"`
+
+	// Skipped is the number of deletions skipped because the pod was
+	// already gone or changed since it was evaluated
+	Skipped int32 `json:"skipped,omitempty"`
+
+	// Blocked is the number of pods whose eviction a PodDisruptionBudget
+	// refused, or that wait for their eviction backoff to elapse
+	Blocked int32 `json:"blocked,omitempty"`
+
+	// Errors hit while cleaning the namespace
+	Errors []string `json:"errors,omitempty"`
+
+	// DryRunPreview lists the pods a dry run would have deleted
+	DryRunPreview []string `json:"dryRunPreview,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// a list of CleanupRun
+type CleanupRunList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CleanupRun `json:"items"`
+}
@@ -0,0 +1,92 @@
+package v1alpha1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ConditionLimited is True while a cluster cleaner's tenant limits
+	// override part of a PodCleaner's spec.
+	ConditionLimited = "Limited"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// a tenant-owned cleaner acting only on pods in its own namespace
+type PodCleaner struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PodCleanerSpec   `json:"spec,omitempty"`
+	Status PodCleanerStatus `json:"status,omitempty"`
+}
+
+// what the cleaner should do
+type PodCleanerSpec struct {
+	// PodPolicy decides which pods in the namespace are deleted, within the
+	// tenant limits of the cluster cleaners selecting the namespace
+	PodPolicy `json:",inline"`
+
+	// Interval between cleanup runs, defaults to 5m
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// DryRun records the number of pods that would be deleted without deleting them
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Suspend pauses all runs until unset
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// the current state
+type PodCleanerStatus struct {
+	// ObservedGeneration is the generation of the spec used by the last run
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastRunTime is when the last cleanup run started
+	LastRunTime *metav1.Time `json:"lastRunTime,omitempty"`
+
+	// LastRun names the last run in its logs, audit records, CloudEvents
+	// and trace
+	LastRun string `json:"lastRun,omitempty"`
+
+	// Candidates is the number of pods eligible for deletion in the last run
+	Candidates int32 `json:"candidates,omitempty"`
+
+	// Deleted is the number of pods deleted in the last run
+	Deleted int32 `json:"deleted,omitempty"`
+
+	// Skipped is the number of deletions skipped in the last run because
+	// the pod was already gone or changed since it was evaluated
+	Skipped int32 `json:"skipped,omitempty"`
+
+	// BlockedPods are the pods whose eviction PodDisruptionBudgets refused,
+	// capped at 100 entries
+	BlockedPods []BlockedPod `json:"blockedPods,omitempty"`
+
+	// Errors are the first errors hit by the last run
+	Errors []string `json:"errors,omitempty"`
+
+	// Conditions describe the current state of the cleaner
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// GetInterval returns the interval between runs.
+func (s *PodCleanerSpec) GetInterval() time.Duration {
+	if s.Interval == nil || s.Interval.Duration <= 0 {
+		return DefaultInterval
+	}
+	return s.Interval.Duration
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// a list of PodCleaner
+type PodCleanerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []PodCleaner `json:"items"`
+}
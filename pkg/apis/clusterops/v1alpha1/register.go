@@ -16,6 +16,10 @@ func AddToScheme(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&NamespaceCleaner{},
 		&NamespaceCleanerList{},
+		&CleanupRun{},
+		&CleanupRunList{},
+		&PodCleaner{},
+		&PodCleanerList{},
 	)
 
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
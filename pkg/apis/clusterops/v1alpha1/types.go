@@ -1,12 +1,75 @@
 package v1alpha1
 
 import (
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// DefaultInterval is how often a NamespaceCleaner runs when spec.interval is unset.
+	DefaultInterval = 5 * time.Minute
+
+	// RunRequestedAtAnnotation requests an immediate run when set to an
+	// RFC3339 timestamp, with fractional seconds or not, later than the last
+	// request acted upon.
+	RunRequestedAtAnnotation = "clusterops.io/run-requested-at"
+
+	// DefaultTTL is how old a finished pod must be before it is deleted when
+	// spec.ttl is unset.
+	DefaultTTL = 30 * time.Second
+
+	// ConditionSuspended is True while spec.suspend is set.
+	ConditionSuspended = "Suspended"
+
+	// ConditionForbidden is True when RBAC denied requests made by the
+	// cleaner during its last run.
+	ConditionForbidden = "Forbidden"
+
+	// ConditionOverlapping is True while other cleaners select some of the
+	// namespaces this cleaner selects.
+	ConditionOverlapping = "Overlapping"
+
+	// ConditionInvalidRunRequest is True while the run-requested-at
+	// annotation holds something other than an RFC3339 timestamp.
+	ConditionInvalidRunRequest = "InvalidRunRequest"
+
+	// ConditionNoServiceAccount is True while spec.serviceAccountRef is unset
+	// and the controller may not clean with its own permissions, so no run
+	// starts.
+	ConditionNoServiceAccount = "NoServiceAccount"
+
+	// BrokenPodAnnotation is set on the owner of a broken pod, or on a bare
+	// broken pod, to why a NamespaceCleaner acted on it.
+	BrokenPodAnnotation = "clusterops.io/broken-pod"
+
+	// ScaledFromReplicasAnnotation records the replicas of a Deployment
+	// before a NamespaceCleaner scaled it to zero.
+	ScaledFromReplicasAnnotation = "clusterops.io/scaled-from-replicas"
+
+	// UnreferencedSinceAnnotation records on a ConfigMap or Secret since when
+	// nothing refers to it, as an RFC3339 timestamp.
+	UnreferencedSinceAnnotation = "clusterops.io/unreferenced-since"
+
+	// KeepAnnotation set to "true" on a ConfigMap, Secret or
+	// PersistentVolumeClaim keeps it from being garbage collected, e.g. when
+	// only a custom resource refers to it.
+	KeepAnnotation = "clusterops.io/keep"
+
+	// LastUsedAnnotation records on a PersistentVolumeClaim when a pod was
+	// last seen mounting it, as an RFC3339 timestamp.
+	LastUsedAnnotation = "clusterops.io/last-used"
+
+	// DefaultRunsHistoryLimit is how many finished CleanupRuns are kept per
+	// NamespaceCleaner when spec.runsHistoryLimit is unset.
+	DefaultRunsHistoryLimit = 10
 )
 
 // +genclient
 // +genclient:nonNamespaced
-// +genclient:noStatus
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 type NamespaceCleaner struct {
@@ -21,10 +84,496 @@ type NamespaceCleaner struct {
 type NamespaceCleanerSpec struct {
 	// Selector which namespaces to scan for old pods
 	Selector metav1.LabelSelector `json:"selector,omitempty"`
+
+	// PodPolicy decides which pods are deleted in the selected namespaces
+	PodPolicy `json:",inline"`
+
+	// Retention keeps the most recently finished pods of each group, however old
+	Retention *RetentionPolicy `json:"retention,omitempty"`
+
+	// StuckTerminating force deletes pods that stay in Terminating for too long
+	StuckTerminating *StuckTerminatingPolicy `json:"stuckTerminating,omitempty"`
+
+	// OrphanedNode deletes pods bound to nodes that are gone or NotReady for too long
+	OrphanedNode *OrphanedNodePolicy `json:"orphanedNode,omitempty"`
+
+	// Unschedulable deletes pods that stay Pending and unschedulable for too long
+	Unschedulable *UnschedulablePolicy `json:"unschedulable,omitempty"`
+
+	// BrokenPods acts on pods that crash loop or fail to pull their image for too long
+	BrokenPods *BrokenPodPolicy `json:"brokenPods,omitempty"`
+
+	// OrphanedConfig deletes ConfigMaps and Secrets nothing has referred to for a while
+	OrphanedConfig *OrphanedConfigPolicy `json:"orphanedConfig,omitempty"`
+
+	// UnusedVolumes deletes PersistentVolumeClaims no pod has mounted for a while
+	UnusedVolumes *UnusedVolumePolicy `json:"unusedVolumes,omitempty"`
+
+	// ReplicaSets prunes the old zero-replica ReplicaSets of Deployments
+	ReplicaSets *ReplicaSetPolicy `json:"replicaSets,omitempty"`
+
+	// ServiceAccountRef is the ServiceAccount the cleaner impersonates to list
+	// and delete, so its RBAC bounds what the cleaner may touch. Required
+	// unless allow-controller-identity is set in config-namespacecleaner
+	ServiceAccountRef *ServiceAccountReference `json:"serviceAccountRef,omitempty"`
+
+	// TenantLimits bound the PodCleaners created in the namespaces this cleaner selects
+	TenantLimits *TenantLimits `json:"tenantLimits,omitempty"`
+
+	// Priority decides which cleaner owns a namespace selected by several
+	// cleaners: the highest priority wins, then the selector with the most
+	// labels, then the name that sorts first
+	Priority int32 `json:"priority,omitempty"`
+
+	// Concurrency is the maximum number of matching namespaces cleaned in
+	// parallel; defaults to the controller's default-namespace-concurrency
+	Concurrency int32 `json:"concurrency,omitempty"`
+
+	// Archive stores the logs, events and manifest of each pod before it is deleted
+	Archive *ArchiveSpec `json:"archive,omitempty"`
+
+	// Notifications send a summary of runs, or an alert when they fail
+	Notifications []NotificationSpec `json:"notifications,omitempty"`
+
+	// Interval between scheduled cleanup runs, defaults to 5m
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// DryRun records the pods that would be deleted without deleting them
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// RunsHistoryLimit is the number of finished CleanupRuns to keep, defaults to 10
+	RunsHistoryLimit *int32 `json:"runsHistoryLimit,omitempty"`
+
+	// Suspend pauses all runs, including manually requested ones, until unset
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// GetInterval returns the interval between scheduled runs.
+func (s *NamespaceCleanerSpec) GetInterval() time.Duration {
+	if s.Interval == nil || s.Interval.Duration <= 0 {
+		return DefaultInterval
+	}
+	return s.Interval.Duration
+}
+
+// GetRunsHistoryLimit returns the number of finished CleanupRuns to keep.
+func (s *NamespaceCleanerSpec) GetRunsHistoryLimit() int {
+	if s.RunsHistoryLimit == nil || *s.RunsHistoryLimit < 0 {
+		return DefaultRunsHistoryLimit
+	}
+	return int(*s.RunsHistoryLimit)
+}
+
+// which finished pods are kept past their TTL
+type RetentionPolicy struct {
+	// KeepLastSucceeded is the number of most recently succeeded pods kept per group
+	KeepLastSucceeded int32 `json:"keepLastSucceeded,omitempty"`
+
+	// KeepLastFailed is the number of most recently failed pods kept per group
+	KeepLastFailed int32 `json:"keepLastFailed,omitempty"`
+
+	// GroupByLabel groups pods by the value of this label; when unset pods
+	// are grouped by their controller, and the pods of a CronJob's Jobs by
+	// the CronJob
+	GroupByLabel string `json:"groupByLabel,omitempty"`
+}
+
+// how pods stuck in Terminating are force deleted
+type StuckTerminatingPolicy struct {
+	// After is how long past its deletionTimestamp a pod may still exist
+	// before it is force deleted with a grace period of 0
+	After metav1.Duration `json:"after"`
+
+	// RemoveFinalizers are the finalizers removed from stuck pods first
+	RemoveFinalizers []string `json:"removeFinalizers,omitempty"`
+}
+
+// how pods on lost nodes are deleted
+type OrphanedNodePolicy struct {
+	// NotReadyAfter is how long a node may not be Ready before its pods are
+	// deleted; when unset only pods on nodes that no longer exist are
+	NotReadyAfter *metav1.Duration `json:"notReadyAfter,omitempty"`
+
+	// Force deletes the pods with a grace period of 0, since a lost kubelet
+	// never confirms a graceful deletion
+	Force bool `json:"force,omitempty"`
+}
+
+// how pods that cannot be scheduled are deleted
+type UnschedulablePolicy struct {
+	// After is how long a pod may be Pending with its PodScheduled condition
+	// False for reason Unschedulable before it is deleted
+	After metav1.Duration `json:"after"`
+
+	// BarePodsOnly restricts deletion to pods without a controller, which
+	// would otherwise just be recreated
+	BarePodsOnly bool `json:"barePodsOnly,omitempty"`
+}
+
+// what is done about a broken pod
+type BrokenPodAction string
+
+const (
+	// BrokenPodActionReport records a warning event and annotates the owner.
+	BrokenPodActionReport BrokenPodAction = "Report"
+	// BrokenPodActionDelete deletes pods without a controller, and reports
+	// the others.
+	BrokenPodActionDelete BrokenPodAction = "Delete"
+	// BrokenPodActionScaleOwnerToZero scales the Deployment owning the pod
+	// to zero replicas, and reports pods not owned by a Deployment.
+	BrokenPodActionScaleOwnerToZero BrokenPodAction = "ScaleOwnerToZero"
+)
+
+// DefaultBrokenPodReasons are the container waiting reasons a pod is broken
+// by when spec.brokenPods.reasons is unset.
+var DefaultBrokenPodReasons = []string{"CrashLoopBackOff", "ImagePullBackOff", "ErrImagePull"}
+
+// how pods that never reach a terminal phase are recognised and handled
+type BrokenPodPolicy struct {
+	// Reasons are the container waiting reasons that make a pod broken,
+	// defaults to CrashLoopBackOff, ImagePullBackOff and ErrImagePull
+	Reasons []string `json:"reasons,omitempty"`
+
+	// MinRestarts is how often the waiting container must have restarted
+	MinRestarts int32 `json:"minRestarts,omitempty"`
+
+	// After is how long the pod's containers must not have been ready
+	After metav1.Duration `json:"after"`
+
+	// Action is what is done about a broken pod, defaults to Report
+	Action BrokenPodAction `json:"action,omitempty"`
+}
+
+// GetReasons returns the container waiting reasons that make a pod broken.
+func (p *BrokenPodPolicy) GetReasons() []string {
+	if len(p.Reasons) == 0 {
+		return DefaultBrokenPodReasons
+	}
+	return p.Reasons
+}
+
+// GetAction returns what is done about a broken pod.
+func (p *BrokenPodPolicy) GetAction() BrokenPodAction {
+	if p.Action == "" {
+		return BrokenPodActionReport
+	}
+	return p.Action
+}
+
+// a kind of configuration object
+type ConfigKind string
+
+const (
+	ConfigKindConfigMap ConfigKind = "ConfigMap"
+	ConfigKindSecret    ConfigKind = "Secret"
+)
+
+// how unreferenced ConfigMaps and Secrets are garbage collected
+type OrphanedConfigPolicy struct {
+	// GracePeriod is how long a ConfigMap or Secret must stay unreferenced
+	// before it is deleted
+	GracePeriod metav1.Duration `json:"gracePeriod"`
+
+	// Kinds are the kinds collected, defaults to ConfigMap and Secret
+	Kinds []ConfigKind `json:"kinds,omitempty"`
+
+	// Selector opts objects in: when set, only the ConfigMaps and Secrets
+	// carrying all of its labels are collected
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// Collects reports whether objects of kind are garbage collected.
+func (p *OrphanedConfigPolicy) Collects(kind ConfigKind) bool {
+	return len(p.Kinds) == 0 || slices.Contains(p.Kinds, kind)
+}
+
+// how unused PersistentVolumeClaims are reclaimed
+type UnusedVolumePolicy struct {
+	// UnusedFor is how long no pod may have mounted a Bound claim before it
+	// is deleted
+	UnusedFor metav1.Duration `json:"unusedFor"`
+
+	// Snapshot takes a VolumeSnapshot of each claim first, and deletes the
+	// claim only once the snapshot is ready to use
+	Snapshot *VolumeSnapshotSpec `json:"snapshot,omitempty"`
+}
+
+// the VolumeSnapshot taken of a claim before it is deleted
+type VolumeSnapshotSpec struct {
+	// ClassName is the VolumeSnapshotClass, defaults to the cluster's default class
+	ClassName string `json:"className,omitempty"`
+}
+
+// how the old ReplicaSets of Deployments are pruned
+type ReplicaSetPolicy struct {
+	// KeepRevisions is the number of old revisions kept per Deployment
+	// besides the current one
+	KeepRevisions int32 `json:"keepRevisions"`
+}
+
+// a ServiceAccount in a given namespace
+type ServiceAccountReference struct {
+	// Namespace of the ServiceAccount
+	Namespace string `json:"namespace"`
+
+	// Name of the ServiceAccount
+	Name string `json:"name"`
+}
+
+// Username returns the name the API server authenticates the ServiceAccount as.
+func (r *ServiceAccountReference) Username() string {
+	return "system:serviceaccount:" + r.Namespace + ":" + r.Name
+}
+
+// which pods get deleted, shared by NamespaceCleaners and PodCleaners
+type PodPolicy struct {
+	// TTL is the minimum age of a finished pod before it is deleted, defaults to 30s
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// PodFilters narrow the finished pods that are deleted. When set, a pod is
+	// deleted only if it matches one of them, and the first matching filter
+	// decides its ttl; when empty, every finished pod is deleted after ttl
+	PodFilters []PodFilter `json:"podFilters,omitempty"`
+
+	// Action is how selected pods are removed, Delete (default) or Evict
+	Action PodAction `json:"action,omitempty"`
+
+	// DeleteOptions tune how pods are deleted or evicted
+	DeleteOptions *DeleteOptions `json:"deleteOptions,omitempty"`
+}
+
+// which finished pods to delete and when; every field that is set must
+// match, and a field matches if any of its values does
+type PodFilter struct {
+	// Name identifies the filter in logs and events
+	Name string `json:"name,omitempty"`
+
+	// Reasons match status.reason, e.g. Evicted, NodeShutdown, NodeAffinity
+	// or UnexpectedAdmissionError
+	Reasons []string `json:"reasons,omitempty"`
+
+	// TerminationReasons match the reason any container terminated with,
+	// e.g. OOMKilled, Error or DeadlineExceeded
+	TerminationReasons []string `json:"terminationReasons,omitempty"`
+
+	// ExitCodes match the exit code of any terminated container
+	ExitCodes []int32 `json:"exitCodes,omitempty"`
+
+	// QOSClasses match status.qosClass
+	QOSClasses []corev1.PodQOSClass `json:"qosClasses,omitempty"`
+
+	// PriorityClassNames match spec.priorityClassName
+	PriorityClassNames []string `json:"priorityClassNames,omitempty"`
+
+	// NodeNames match spec.nodeName
+	NodeNames []string `json:"nodeNames,omitempty"`
+
+	// TTL overrides the policy's ttl for the pods this filter matches
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+}
+
+// how selected pods are removed
+type PodAction string
+
+const (
+	// PodActionDelete deletes pods directly, ignoring PodDisruptionBudgets
+	PodActionDelete PodAction = "Delete"
+	// PodActionEvict removes pods through the Eviction API, so
+	// PodDisruptionBudgets are honoured
+	PodActionEvict PodAction = "Evict"
+)
+
+// a pod whose eviction a PodDisruptionBudget refused, retried with backoff
+type BlockedPod struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid"`
+
+	// Attempts is the number of refused evictions
+	Attempts int32 `json:"attempts"`
+
+	// LastAttemptTime is when the eviction was last refused
+	LastAttemptTime metav1.Time `json:"lastAttemptTime"`
+
+	// NextAttemptTime is when the eviction is retried, at the first run after it
+	NextAttemptTime metav1.Time `json:"nextAttemptTime"`
+
+	// Message returned with the last refusal
+	Message string `json:"message,omitempty"`
+}
+
+// how pods are deleted
+type DeleteOptions struct {
+	// GracePeriodSeconds overrides the pods' termination grace period
+	GracePeriodSeconds *int64 `json:"gracePeriodSeconds,omitempty"`
+
+	// PropagationPolicy decides how dependents are garbage collected
+	PropagationPolicy *metav1.DeletionPropagation `json:"propagationPolicy,omitempty"`
+}
+
+// GetTTL returns how old a finished pod must be before it is deleted.
+func (p *PodPolicy) GetTTL() time.Duration {
+	if p.TTL == nil || p.TTL.Duration <= 0 {
+		return DefaultTTL
+	}
+	return p.TTL.Duration
+}
+
+// what tenants may configure in their own namespaces
+type TenantLimits struct {
+	// MinTTL is the shortest ttl a PodCleaner may use
+	MinTTL *metav1.Duration `json:"minTTL,omitempty"`
+}
+
+// where pod artifacts are archived, exactly one sink must be set
+type ArchiveSpec struct {
+	// Filesystem writes archives to a directory mounted into the controller, e.g. a PVC
+	Filesystem *FilesystemArchive `json:"filesystem,omitempty"`
+
+	// S3 uploads archives to an S3-compatible object store
+	S3 *S3Archive `json:"s3,omitempty"`
+}
+
+// a directory in the controller's filesystem
+type FilesystemArchive struct {
+	// Path of the directory archives are written under
+	Path string `json:"path"`
+}
+
+// an S3-compatible bucket
+type S3Archive struct {
+	// Endpoint is the base URL of the object store, e.g. http://minio.minio:9000
+	Endpoint string `json:"endpoint"`
+
+	// Region used to sign requests, defaults to us-east-1
+	Region string `json:"region,omitempty"`
+
+	// Bucket the archives are uploaded to
+	Bucket string `json:"bucket"`
+
+	// Prefix prepended to every object key
+	Prefix string `json:"prefix,omitempty"`
+
+	// CredentialsSecret is the name of a Secret in the controller's namespace
+	// holding the accessKeyID and secretAccessKey keys
+	CredentialsSecret string `json:"credentialsSecret"`
+}
+
+// where and when the outcome of runs is sent
+type NotificationSpec struct {
+	// Name identifies the notification in events and logs
+	Name string `json:"name"`
+
+	// On are the phases of the finished runs notified, defaults to Failed
+	On []RunPhase `json:"on,omitempty"`
+
+	// Template is a Go text/template rendering the message from the run,
+	// defaults to a summary of its outcome
+	Template string `json:"template,omitempty"`
+
+	// Webhook posts the message to a Slack or Teams compatible incoming webhook
+	Webhook *WebhookNotification `json:"webhook,omitempty"`
+
+	// SMTP emails the message
+	SMTP *SMTPNotification `json:"smtp,omitempty"`
+
+	// HTTP posts the message and the run as JSON
+	HTTP *HTTPNotification `json:"http,omitempty"`
+}
+
+// GetOn returns the phases of the finished runs notified.
+func (n *NotificationSpec) GetOn() []RunPhase {
+	if len(n.On) == 0 {
+		return []RunPhase{RunPhaseFailed}
+	}
+	return n.On
+}
+
+// an incoming webhook accepting {"text": ...}
+type WebhookNotification struct {
+	// URLSecret is the name of a Secret in the controller's namespace
+	// holding the webhook URL in the url key
+	URLSecret string `json:"urlSecret"`
+}
+
+// an SMTP server relaying email
+type SMTPNotification struct {
+	// Address of the server, host:port
+	Address string `json:"address"`
+
+	// From is the sender address
+	From string `json:"from"`
+
+	// To are the recipient addresses
+	To []string `json:"to"`
+
+	// CredentialsSecret is the name of a Secret in the controller's
+	// namespace holding the username and password keys; when unset mail is
+	// sent unauthenticated
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+}
+
+// an HTTP endpoint accepting JSON
+type HTTPNotification struct {
+	// URL the notification is posted to
+	URL string `json:"url"`
+
+	// CredentialsSecret is the name of a Secret in the controller's
+	// namespace whose authorization key is sent as the Authorization header
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
 }
 
 // the current state
 type NamespaceCleanerStatus struct {
+	// ObservedGeneration is the generation of the spec used by the last run
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastRunTime is when the last cleanup run started
+	LastRunTime *metav1.Time `json:"lastRunTime,omitempty"`
+
+	// LastRun is the name of the CleanupRun recording the last run
+	LastRun string `json:"lastRun,omitempty"`
+
+	// LastManualRunTime is the value of the run-requested-at annotation that
+	// was last acted upon
+	LastManualRunTime *metav1.Time `json:"lastManualRunTime,omitempty"`
+
+	// LastManualRunRequest is that value with its fractional seconds, which
+	// tell apart requests made within the same second
+	LastManualRunRequest string `json:"lastManualRunRequest,omitempty"`
+
+	// ConflictingCleaners are the other cleaners that selected at least one
+	// of the namespaces this cleaner selected during the last run
+	ConflictingCleaners []string `json:"conflictingCleaners,omitempty"`
+
+	// OwnedNamespaces are the namespaces this cleaner owned during the last
+	// run, capped at 100 entries
+	OwnedNamespaces []string `json:"ownedNamespaces,omitempty"`
+
+	// OwnedNamespaceCount is the total number of namespaces owned during the last run
+	OwnedNamespaceCount int32 `json:"ownedNamespaceCount,omitempty"`
+
+	// BlockedPods are the pods whose eviction PodDisruptionBudgets refused,
+	// capped at 100 entries
+	BlockedPods []BlockedPod `json:"blockedPods,omitempty"`
+
+	// Conditions describe the current state of the cleaner
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// RunRequestedAt returns the time of the manual run requested through the
+// run-requested-at annotation, and whether the annotation is set. An error is
+// returned if the annotation is not a valid RFC3339 timestamp.
+func (nc *NamespaceCleaner) RunRequestedAt() (time.Time, bool, error) {
+	value, ok := nc.Annotations[RunRequestedAtAnnotation]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, true, err
+	}
+	return t, true, nil
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -21,16 +21,260 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArchiveSpec) DeepCopyInto(out *ArchiveSpec) {
+	*out = *in
+	if in.Filesystem != nil {
+		in, out := &in.Filesystem, &out.Filesystem
+		*out = new(FilesystemArchive)
+		**out = **in
+	}
+	if in.S3 != nil {
+		in, out := &in.S3, &out.S3
+		*out = new(S3Archive)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArchiveSpec.
+func (in *ArchiveSpec) DeepCopy() *ArchiveSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ArchiveSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BlockedPod) DeepCopyInto(out *BlockedPod) {
+	*out = *in
+	in.LastAttemptTime.DeepCopyInto(&out.LastAttemptTime)
+	in.NextAttemptTime.DeepCopyInto(&out.NextAttemptTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BlockedPod.
+func (in *BlockedPod) DeepCopy() *BlockedPod {
+	if in == nil {
+		return nil
+	}
+	out := new(BlockedPod)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BrokenPodPolicy) DeepCopyInto(out *BrokenPodPolicy) {
+	*out = *in
+	if in.Reasons != nil {
+		in, out := &in.Reasons, &out.Reasons
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	out.After = in.After
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BrokenPodPolicy.
+func (in *BrokenPodPolicy) DeepCopy() *BrokenPodPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(BrokenPodPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CleanupRun) DeepCopyInto(out *CleanupRun) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CleanupRun.
+func (in *CleanupRun) DeepCopy() *CleanupRun {
+	if in == nil {
+		return nil
+	}
+	out := new(CleanupRun)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CleanupRun) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CleanupRunList) DeepCopyInto(out *CleanupRunList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CleanupRun, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CleanupRunList.
+func (in *CleanupRunList) DeepCopy() *CleanupRunList {
+	if in == nil {
+		return nil
+	}
+	out := new(CleanupRunList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CleanupRunList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CleanupRunSpec) DeepCopyInto(out *CleanupRunSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CleanupRunSpec.
+func (in *CleanupRunSpec) DeepCopy() *CleanupRunSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CleanupRunSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CleanupRunStatus) DeepCopyInto(out *CleanupRunStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.TotalReclaimedStorage != nil {
+		in, out := &in.TotalReclaimedStorage, &out.TotalReclaimedStorage
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]NamespaceRunResult, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Errors != nil {
+		in, out := &in.Errors, &out.Errors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CleanupRunStatus.
+func (in *CleanupRunStatus) DeepCopy() *CleanupRunStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CleanupRunStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeleteOptions) DeepCopyInto(out *DeleteOptions) {
+	*out = *in
+	if in.GracePeriodSeconds != nil {
+		in, out := &in.GracePeriodSeconds, &out.GracePeriodSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.PropagationPolicy != nil {
+		in, out := &in.PropagationPolicy, &out.PropagationPolicy
+		*out = new(v1.DeletionPropagation)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeleteOptions.
+func (in *DeleteOptions) DeepCopy() *DeleteOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(DeleteOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FilesystemArchive) DeepCopyInto(out *FilesystemArchive) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FilesystemArchive.
+func (in *FilesystemArchive) DeepCopy() *FilesystemArchive {
+	if in == nil {
+		return nil
+	}
+	out := new(FilesystemArchive)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPNotification) DeepCopyInto(out *HTTPNotification) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPNotification.
+func (in *HTTPNotification) DeepCopy() *HTTPNotification {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPNotification)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NamespaceCleaner) DeepCopyInto(out *NamespaceCleaner) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -89,6 +333,79 @@ func (in *NamespaceCleanerList) DeepCopyObject() runtime.Object {
 func (in *NamespaceCleanerSpec) DeepCopyInto(out *NamespaceCleanerSpec) {
 	*out = *in
 	in.Selector.DeepCopyInto(&out.Selector)
+	in.PodPolicy.DeepCopyInto(&out.PodPolicy)
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(RetentionPolicy)
+		**out = **in
+	}
+	if in.StuckTerminating != nil {
+		in, out := &in.StuckTerminating, &out.StuckTerminating
+		*out = new(StuckTerminatingPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OrphanedNode != nil {
+		in, out := &in.OrphanedNode, &out.OrphanedNode
+		*out = new(OrphanedNodePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Unschedulable != nil {
+		in, out := &in.Unschedulable, &out.Unschedulable
+		*out = new(UnschedulablePolicy)
+		**out = **in
+	}
+	if in.BrokenPods != nil {
+		in, out := &in.BrokenPods, &out.BrokenPods
+		*out = new(BrokenPodPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OrphanedConfig != nil {
+		in, out := &in.OrphanedConfig, &out.OrphanedConfig
+		*out = new(OrphanedConfigPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UnusedVolumes != nil {
+		in, out := &in.UnusedVolumes, &out.UnusedVolumes
+		*out = new(UnusedVolumePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReplicaSets != nil {
+		in, out := &in.ReplicaSets, &out.ReplicaSets
+		*out = new(ReplicaSetPolicy)
+		**out = **in
+	}
+	if in.ServiceAccountRef != nil {
+		in, out := &in.ServiceAccountRef, &out.ServiceAccountRef
+		*out = new(ServiceAccountReference)
+		**out = **in
+	}
+	if in.TenantLimits != nil {
+		in, out := &in.TenantLimits, &out.TenantLimits
+		*out = new(TenantLimits)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Archive != nil {
+		in, out := &in.Archive, &out.Archive
+		*out = new(ArchiveSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Notifications != nil {
+		in, out := &in.Notifications, &out.Notifications
+		*out = make([]NotificationSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RunsHistoryLimit != nil {
+		in, out := &in.RunsHistoryLimit, &out.RunsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
 	return
 }
 
@@ -105,6 +422,38 @@ func (in *NamespaceCleanerSpec) DeepCopy() *NamespaceCleanerSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NamespaceCleanerStatus) DeepCopyInto(out *NamespaceCleanerStatus) {
 	*out = *in
+	if in.LastRunTime != nil {
+		in, out := &in.LastRunTime, &out.LastRunTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastManualRunTime != nil {
+		in, out := &in.LastManualRunTime, &out.LastManualRunTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ConflictingCleaners != nil {
+		in, out := &in.ConflictingCleaners, &out.ConflictingCleaners
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.OwnedNamespaces != nil {
+		in, out := &in.OwnedNamespaces, &out.OwnedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.BlockedPods != nil {
+		in, out := &in.BlockedPods, &out.BlockedPods
+		*out = make([]BlockedPod, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -117,3 +466,523 @@ func (in *NamespaceCleanerStatus) DeepCopy() *NamespaceCleanerStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceRunResult) DeepCopyInto(out *NamespaceRunResult) {
+	*out = *in
+	if in.ReclaimedStorage != nil {
+		in, out := &in.ReclaimedStorage, &out.ReclaimedStorage
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Errors != nil {
+		in, out := &in.Errors, &out.Errors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DryRunPreview != nil {
+		in, out := &in.DryRunPreview, &out.DryRunPreview
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceRunResult.
+func (in *NamespaceRunResult) DeepCopy() *NamespaceRunResult {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceRunResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotificationSpec) DeepCopyInto(out *NotificationSpec) {
+	*out = *in
+	if in.On != nil {
+		in, out := &in.On, &out.On
+		*out = make([]RunPhase, len(*in))
+		copy(*out, *in)
+	}
+	if in.Webhook != nil {
+		in, out := &in.Webhook, &out.Webhook
+		*out = new(WebhookNotification)
+		**out = **in
+	}
+	if in.SMTP != nil {
+		in, out := &in.SMTP, &out.SMTP
+		*out = new(SMTPNotification)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(HTTPNotification)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotificationSpec.
+func (in *NotificationSpec) DeepCopy() *NotificationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NotificationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OrphanedConfigPolicy) DeepCopyInto(out *OrphanedConfigPolicy) {
+	*out = *in
+	out.GracePeriod = in.GracePeriod
+	if in.Kinds != nil {
+		in, out := &in.Kinds, &out.Kinds
+		*out = make([]ConfigKind, len(*in))
+		copy(*out, *in)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OrphanedConfigPolicy.
+func (in *OrphanedConfigPolicy) DeepCopy() *OrphanedConfigPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(OrphanedConfigPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OrphanedNodePolicy) DeepCopyInto(out *OrphanedNodePolicy) {
+	*out = *in
+	if in.NotReadyAfter != nil {
+		in, out := &in.NotReadyAfter, &out.NotReadyAfter
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OrphanedNodePolicy.
+func (in *OrphanedNodePolicy) DeepCopy() *OrphanedNodePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(OrphanedNodePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodCleaner) DeepCopyInto(out *PodCleaner) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodCleaner.
+func (in *PodCleaner) DeepCopy() *PodCleaner {
+	if in == nil {
+		return nil
+	}
+	out := new(PodCleaner)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PodCleaner) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodCleanerList) DeepCopyInto(out *PodCleanerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PodCleaner, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodCleanerList.
+func (in *PodCleanerList) DeepCopy() *PodCleanerList {
+	if in == nil {
+		return nil
+	}
+	out := new(PodCleanerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PodCleanerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodCleanerSpec) DeepCopyInto(out *PodCleanerSpec) {
+	*out = *in
+	in.PodPolicy.DeepCopyInto(&out.PodPolicy)
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodCleanerSpec.
+func (in *PodCleanerSpec) DeepCopy() *PodCleanerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PodCleanerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodCleanerStatus) DeepCopyInto(out *PodCleanerStatus) {
+	*out = *in
+	if in.LastRunTime != nil {
+		in, out := &in.LastRunTime, &out.LastRunTime
+		*out = (*in).DeepCopy()
+	}
+	if in.BlockedPods != nil {
+		in, out := &in.BlockedPods, &out.BlockedPods
+		*out = make([]BlockedPod, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Errors != nil {
+		in, out := &in.Errors, &out.Errors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodCleanerStatus.
+func (in *PodCleanerStatus) DeepCopy() *PodCleanerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PodCleanerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodFilter) DeepCopyInto(out *PodFilter) {
+	*out = *in
+	if in.Reasons != nil {
+		in, out := &in.Reasons, &out.Reasons
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TerminationReasons != nil {
+		in, out := &in.TerminationReasons, &out.TerminationReasons
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExitCodes != nil {
+		in, out := &in.ExitCodes, &out.ExitCodes
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+	if in.QOSClasses != nil {
+		in, out := &in.QOSClasses, &out.QOSClasses
+		*out = make([]corev1.PodQOSClass, len(*in))
+		copy(*out, *in)
+	}
+	if in.PriorityClassNames != nil {
+		in, out := &in.PriorityClassNames, &out.PriorityClassNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeNames != nil {
+		in, out := &in.NodeNames, &out.NodeNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodFilter.
+func (in *PodFilter) DeepCopy() *PodFilter {
+	if in == nil {
+		return nil
+	}
+	out := new(PodFilter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodPolicy) DeepCopyInto(out *PodPolicy) {
+	*out = *in
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.PodFilters != nil {
+		in, out := &in.PodFilters, &out.PodFilters
+		*out = make([]PodFilter, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DeleteOptions != nil {
+		in, out := &in.DeleteOptions, &out.DeleteOptions
+		*out = new(DeleteOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodPolicy.
+func (in *PodPolicy) DeepCopy() *PodPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(PodPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReplicaSetPolicy) DeepCopyInto(out *ReplicaSetPolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplicaSetPolicy.
+func (in *ReplicaSetPolicy) DeepCopy() *ReplicaSetPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ReplicaSetPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetentionPolicy) DeepCopyInto(out *RetentionPolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetentionPolicy.
+func (in *RetentionPolicy) DeepCopy() *RetentionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RetentionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *S3Archive) DeepCopyInto(out *S3Archive) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new S3Archive.
+func (in *S3Archive) DeepCopy() *S3Archive {
+	if in == nil {
+		return nil
+	}
+	out := new(S3Archive)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SMTPNotification) DeepCopyInto(out *SMTPNotification) {
+	*out = *in
+	if in.To != nil {
+		in, out := &in.To, &out.To
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SMTPNotification.
+func (in *SMTPNotification) DeepCopy() *SMTPNotification {
+	if in == nil {
+		return nil
+	}
+	out := new(SMTPNotification)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountReference) DeepCopyInto(out *ServiceAccountReference) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountReference.
+func (in *ServiceAccountReference) DeepCopy() *ServiceAccountReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StuckTerminatingPolicy) DeepCopyInto(out *StuckTerminatingPolicy) {
+	*out = *in
+	out.After = in.After
+	if in.RemoveFinalizers != nil {
+		in, out := &in.RemoveFinalizers, &out.RemoveFinalizers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StuckTerminatingPolicy.
+func (in *StuckTerminatingPolicy) DeepCopy() *StuckTerminatingPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(StuckTerminatingPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TenantLimits) DeepCopyInto(out *TenantLimits) {
+	*out = *in
+	if in.MinTTL != nil {
+		in, out := &in.MinTTL, &out.MinTTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TenantLimits.
+func (in *TenantLimits) DeepCopy() *TenantLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(TenantLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UnschedulablePolicy) DeepCopyInto(out *UnschedulablePolicy) {
+	*out = *in
+	out.After = in.After
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UnschedulablePolicy.
+func (in *UnschedulablePolicy) DeepCopy() *UnschedulablePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(UnschedulablePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UnusedVolumePolicy) DeepCopyInto(out *UnusedVolumePolicy) {
+	*out = *in
+	out.UnusedFor = in.UnusedFor
+	if in.Snapshot != nil {
+		in, out := &in.Snapshot, &out.Snapshot
+		*out = new(VolumeSnapshotSpec)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UnusedVolumePolicy.
+func (in *UnusedVolumePolicy) DeepCopy() *UnusedVolumePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(UnusedVolumePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VolumeSnapshotSpec) DeepCopyInto(out *VolumeSnapshotSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeSnapshotSpec.
+func (in *VolumeSnapshotSpec) DeepCopy() *VolumeSnapshotSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VolumeSnapshotSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookNotification) DeepCopyInto(out *WebhookNotification) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookNotification.
+func (in *WebhookNotification) DeepCopy() *WebhookNotification {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookNotification)
+	in.DeepCopyInto(out)
+	return out
+}
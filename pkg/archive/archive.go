@@ -0,0 +1,129 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package archive preserves the logs, events and manifest of pods before the
+// controller deletes them.
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// LocationAnnotation is set on the audit event of an archived pod and points
+// at the location its artifacts were written to.
+const LocationAnnotation = "clusterops.io/archive-location"
+
+// Archiver is a sink that pod artifacts are streamed to.
+type Archiver interface {
+	// Put stores the content of body as the object called name.
+	Put(ctx context.Context, name string, body io.Reader) error
+
+	// Location returns a URI identifying the object called name.
+	Location(name string) string
+}
+
+// Pod streams the manifest, events and container logs (including those of
+// previous container instances) of pod to a, and returns the location of the
+// pod's archive. Logs that the API server cannot serve, e.g. for containers
+// that never started, are skipped.
+func Pod(ctx context.Context, client kubernetes.Interface, a Archiver, pod *corev1.Pod) (string, error) {
+	dir := path.Join(pod.Namespace, fmt.Sprintf("%s-%s", pod.Name, pod.UID))
+
+	manifest := pod.DeepCopy()
+	manifest.APIVersion, manifest.Kind = "v1", "Pod"
+	if err := putYAML(ctx, a, path.Join(dir, "pod.yaml"), manifest); err != nil {
+		return "", err
+	}
+
+	events, err := client.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("involvedObject.uid", string(pod.UID)).String(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list events of pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	events.APIVersion, events.Kind = "v1", "EventList"
+	if err := putYAML(ctx, a, path.Join(dir, "events.yaml"), events); err != nil {
+		return "", err
+	}
+
+	for _, cs := range containerStatuses(pod) {
+		if err := putLogs(ctx, client, a, pod, dir, cs.Name, false); err != nil {
+			return "", err
+		}
+		if cs.RestartCount > 0 {
+			if err := putLogs(ctx, client, a, pod, dir, cs.Name, true); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return a.Location(dir), nil
+}
+
+func putYAML(ctx context.Context, a Archiver, name string, obj interface{}) error {
+	b, err := yaml.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+	if err := a.Put(ctx, name, bytes.NewReader(b)); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", name, err)
+	}
+	return nil
+}
+
+func putLogs(ctx context.Context, client kubernetes.Interface, a Archiver, pod *corev1.Pod, dir, container string, previous bool) error {
+	name := path.Join(dir, "logs", container+".log")
+	if previous {
+		name = path.Join(dir, "logs", container+".previous.log")
+	}
+
+	stream, err := client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: container,
+		Previous:  previous,
+	}).Stream(ctx)
+	if errors.IsBadRequest(err) || errors.IsNotFound(err) {
+		// No logs are available for this container instance.
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to stream logs of %s/%s[%s]: %w", pod.Namespace, pod.Name, container, err)
+	}
+	defer stream.Close()
+
+	if err := a.Put(ctx, name, stream); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", name, err)
+	}
+	return nil
+}
+
+func containerStatuses(pod *corev1.Pod) []corev1.ContainerStatus {
+	statuses := make([]corev1.ContainerStatus, 0,
+		len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses)+len(pod.Status.EphemeralContainerStatuses))
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	statuses = append(statuses, pod.Status.EphemeralContainerStatuses...)
+	return statuses
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPod(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "build", UID: "1234"},
+		Status: corev1.PodStatus{
+			Phase:                 corev1.PodFailed,
+			InitContainerStatuses: []corev1.ContainerStatus{{Name: "setup"}},
+			ContainerStatuses:     []corev1.ContainerStatus{{Name: "main", RestartCount: 2}},
+		},
+	}
+	event := &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: "ci", Name: "build.1"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "ci", Name: "build", UID: "1234"},
+		Reason:         "BackOff",
+	}
+	client := fake.NewClientset(pod, event)
+
+	root := t.TempDir()
+	location, err := Pod(context.Background(), client, NewFilesystem(root), pod)
+	if err != nil {
+		t.Fatalf("Pod() = %v", err)
+	}
+	dir := filepath.Join(root, "ci", "build-1234")
+	if want := "file://" + filepath.ToSlash(dir); location != want {
+		t.Errorf("location = %q, want %q", location, want)
+	}
+
+	for name, want := range map[string]string{
+		"pod.yaml":               "name: build",
+		"events.yaml":            "reason: BackOff",
+		"logs/setup.log":         "fake logs",
+		"logs/main.log":          "fake logs",
+		"logs/main.previous.log": "fake logs",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s was not archived: %v", name, err)
+			continue
+		}
+		if !strings.Contains(string(got), want) {
+			t.Errorf("%s = %q, want it to contain %q", name, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "logs", "setup.previous.log")); !os.IsNotExist(err) {
+		t.Errorf("previous logs of a container that never restarted were archived: %v", err)
+	}
+}
+
+func TestFilesystemPutCancelled(t *testing.T) {
+	root := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	fs := NewFilesystem(root)
+	if err := fs.Put(ctx, "ci/pod.yaml", strings.NewReader("kind: Pod")); err == nil {
+		t.Fatal("Put() = nil, want the context error")
+	}
+	// Neither the object nor its temporary file is left behind.
+	entries, err := os.ReadDir(filepath.Join(root, "ci"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("files left behind: %v", entries)
+	}
+}
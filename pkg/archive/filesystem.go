@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Filesystem archives to a local directory, typically a PersistentVolumeClaim
+// mounted into the controller.
+type Filesystem struct {
+	// Root is the directory the archives are written under.
+	Root string
+}
+
+var _ Archiver = (*Filesystem)(nil)
+
+// NewFilesystem returns an Archiver writing below root.
+func NewFilesystem(root string) *Filesystem {
+	return &Filesystem{Root: root}
+}
+
+// Put implements Archiver. The object is written to a temporary file first
+// and renamed into place, so partially written archives are never visible.
+func (f *Filesystem) Put(ctx context.Context, name string, body io.Reader) error {
+	target := filepath.Join(f.Root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".archive-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, contextReader{ctx: ctx, r: body}); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// Location implements Archiver.
+func (f *Filesystem) Location(name string) string {
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(f.Root, filepath.FromSlash(name)))}
+	return u.String()
+}
+
+// contextReader stops a copy once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// S3 archives to an S3-compatible object store such as AWS S3 or MinIO.
+// Requests use path-style addressing and AWS Signature Version 4.
+type S3 struct {
+	// Endpoint is the base URL of the object store, e.g.
+	// https://s3.eu-west-1.amazonaws.com or http://minio.minio:9000.
+	Endpoint *url.URL
+	Region   string
+	Bucket   string
+	Prefix   string
+
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// Client is used to send requests, http.DefaultClient when nil.
+	Client *http.Client
+}
+
+var _ Archiver = (*S3)(nil)
+
+// NewS3 returns an Archiver uploading to bucket at endpoint.
+func NewS3(endpoint, region, bucket, prefix, accessKeyID, secretAccessKey string) (*S3, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: %w", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: scheme must be http or https", endpoint)
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("S3 bucket must be set")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3{
+		Endpoint:        u,
+		Region:          region,
+		Bucket:          bucket,
+		Prefix:          strings.Trim(prefix, "/"),
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+	}, nil
+}
+
+// Put implements Archiver. S3 needs the length and, for signing, the hash of
+// the payload up front, so the body is spooled to a temporary file first.
+func (s *S3) Put(ctx context.Context, name string, body io.Reader) error {
+	spool, err := os.CreateTemp("", "archive-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, h), contextReader{ctx: ctx, r: body})
+	if err != nil {
+		return err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	u := *s.Endpoint
+	u.Path = "/" + path.Join(s.Bucket, s.key(name))
+	u.RawPath = uriEncodePath(u.Path)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), spool)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	s.sign(req, hex.EncodeToString(h.Sum(nil)), time.Now().UTC())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("PUT %s: %s: %s", u.Path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Location implements Archiver.
+func (s *S3) Location(name string) string {
+	return fmt.Sprintf("s3://%s/%s", s.Bucket, s.key(name))
+}
+
+func (s *S3) key(name string) string {
+	if s.Prefix == "" {
+		return name
+	}
+	return s.Prefix + "/" + name
+}
+
+// sign adds the AWS Signature Version 4 headers for an unqueried request
+// whose payload hashes to payloadHash.
+func (s *S3) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncodePath(req.URL.Path),
+		"",
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(crHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), day)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// uriEncodePath encodes p the way SigV4 canonical requests expect: every byte
+// except unreserved characters and the path separator is percent-encoded.
+func uriEncodePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an object store accepting the PUTs of an S3 archiver whose
+// signature it checks.
+type fakeS3 struct {
+	t      *testing.T
+	secret string
+
+	mu      sync.Mutex
+	objects map[string]string
+}
+
+func newFakeS3(t *testing.T, secret string) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{t: t, secret: secret, objects: map[string]string{}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPut {
+		http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256(body)
+	if got := req.Header.Get("X-Amz-Content-Sha256"); got != hex.EncodeToString(sum[:]) {
+		http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+		return
+	}
+	if !f.validSignature(req) {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[req.URL.EscapedPath()] = string(body)
+}
+
+// validSignature signs req again the way the server sees it, and compares
+// the result with its Authorization header.
+func (f *fakeS3) validSignature(req *http.Request) bool {
+	now, err := time.Parse("20060102T150405Z", req.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	signer := &S3{Region: "us-east-1", AccessKeyID: "access", SecretAccessKey: f.secret}
+	signed, _ := http.NewRequest(req.Method, "http://"+req.Host+req.URL.EscapedPath(), nil)
+	signer.sign(signed, req.Header.Get("X-Amz-Content-Sha256"), now)
+	return signed.Header.Get("Authorization") == req.Header.Get("Authorization")
+}
+
+func TestS3Put(t *testing.T) {
+	store, server := newFakeS3(t, "secret")
+	s3, err := NewS3(server.URL, "", "archives", "/cleaner/", "access", "secret")
+	if err != nil {
+		t.Fatalf("NewS3() = %v", err)
+	}
+
+	name := "ci/build 1/logs/main.log"
+	if err := s3.Put(context.Background(), name, strings.NewReader("hello")); err != nil {
+		t.Fatalf("Put() = %v", err)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if got, want := store.objects["/archives/cleaner/ci/build%201/logs/main.log"], "hello"; got != want {
+		t.Errorf("stored objects = %v, want %q under the prefixed key", store.objects, want)
+	}
+	if got, want := s3.Location("ci/build 1"), "s3://archives/cleaner/ci/build 1"; got != want {
+		t.Errorf("Location() = %q, want %q", got, want)
+	}
+}
+
+func TestS3PutRejected(t *testing.T) {
+	_, server := newFakeS3(t, "other")
+	s3, err := NewS3(server.URL, "", "archives", "", "access", "secret")
+	if err != nil {
+		t.Fatalf("NewS3() = %v", err)
+	}
+
+	err = s3.Put(context.Background(), "ci/pod.yaml", strings.NewReader("kind: Pod"))
+	if err == nil || !strings.Contains(err.Error(), "403 Forbidden: SignatureDoesNotMatch") {
+		t.Fatalf("Put() = %v, want the rejected signature", err)
+	}
+}
+
+func TestNewS3(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		bucket   string
+		wantErr  bool
+	}{
+		{name: "valid", endpoint: "http://minio.minio:9000", bucket: "archives"},
+		{name: "no scheme", endpoint: "minio.minio:9000", bucket: "archives", wantErr: true},
+		{name: "unsupported scheme", endpoint: "ftp://minio", bucket: "archives", wantErr: true},
+		{name: "no bucket", endpoint: "https://s3.eu-west-1.amazonaws.com", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s3, err := NewS3(test.endpoint, "", test.bucket, "", "", "")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewS3() = %v, want error %v", err, test.wantErr)
+			}
+			if err == nil && s3.Region != "us-east-1" {
+				t.Errorf("Region = %q, want the us-east-1 default", s3.Region)
+			}
+		})
+	}
+}
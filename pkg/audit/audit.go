@@ -0,0 +1,245 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit writes a tamper-evident log of what the cleaners delete.
+// Every deletion is one JSON record, chained to the previous record by
+// including its SHA-256 hash, so that records removed, inserted or modified
+// after the fact break the chain that Verifier checks. With a key, the hashes
+// are HMACs, so that only the holders of the key can write a chain that
+// verifies.
+package audit
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Version identifies the format of the records. It is the value of their
+// first field, "audit", which tells records apart from other log lines.
+const Version = "v1"
+
+// Actions recorded.
+const (
+	ActionDelete      = "delete"
+	ActionEvict       = "evict"
+	ActionForceDelete = "force-delete"
+	ActionScaleToZero = "scale-to-zero"
+	// ActionRemoveFinalizers is recorded on its own before the force
+	// delete, which may still fail afterwards.
+	ActionRemoveFinalizers = "remove-finalizers"
+)
+
+// Algorithms the records are hashed with.
+const (
+	// AlgSHA256 is a plain SHA-256 hash, which anyone can recompute. It is
+	// assumed for records without an algorithm.
+	AlgSHA256 = "sha256"
+	// AlgHMACSHA256 is an HMAC-SHA256 keyed with the audit key.
+	AlgHMACSHA256 = "hmac-sha256"
+)
+
+// ObjectRef identifies the object acted on.
+type ObjectRef struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid"`
+}
+
+// Record is the audit record of a single action.
+type Record struct {
+	Version string    `json:"audit"`
+	Seq     uint64    `json:"seq"`
+	Time    time.Time `json:"time"`
+
+	// Action is one of the Action constants.
+	Action string    `json:"action"`
+	Object ObjectRef `json:"object"`
+	// Age is how old the object was when acted on.
+	Age string `json:"age,omitempty"`
+
+	// CleanerKind and Cleaner identify the cleaner acting, Rule and Reason
+	// why it did.
+	CleanerKind string `json:"cleanerKind"`
+	Cleaner     string `json:"cleaner"`
+	Rule        string `json:"rule"`
+	Reason      string `json:"reason,omitempty"`
+	// Run is the CleanupRun the action was taken in.
+	Run string `json:"run,omitempty"`
+	// DryRun records an action that a dry run only reported.
+	DryRun bool `json:"dryRun"`
+	// Archive is where the object was archived before it was deleted.
+	Archive string `json:"archive,omitempty"`
+
+	// Alg is the algorithm of Hash, one of the Alg constants.
+	Alg string `json:"alg,omitempty"`
+	// Prev is the hash of the previous record, empty for the first record
+	// of a chain. Hash is the hash of this record with Hash unset.
+	Prev string `json:"prev,omitempty"`
+	Hash string `json:"hash,omitempty"`
+}
+
+// NewRecord starts the record of taking action on obj of the given
+// apiVersion and kind.
+func NewRecord(action, apiVersion, kind string, obj metav1.Object) Record {
+	r := Record{
+		Action: action,
+		Object: ObjectRef{
+			APIVersion: apiVersion,
+			Kind:       kind,
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+			UID:        obj.GetUID(),
+		},
+	}
+	if created := obj.GetCreationTimestamp(); !created.IsZero() {
+		r.Age = time.Since(created.Time).Round(time.Second).String()
+	}
+	return r
+}
+
+// seal returns the hash of r with the algorithm r names, keyed with key, and
+// the encoding of r with the hash set.
+func seal(r Record, key []byte) (string, []byte, error) {
+	r.Hash = ""
+	body, err := json.Marshal(r)
+	if err != nil {
+		return "", nil, err
+	}
+	switch r.Alg {
+	case "", AlgSHA256:
+		sum := sha256.Sum256(body)
+		r.Hash = hex.EncodeToString(sum[:])
+	case AlgHMACSHA256:
+		if len(key) == 0 {
+			return "", nil, errors.New("a key is needed for HMAC-SHA256")
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(body)
+		r.Hash = hex.EncodeToString(mac.Sum(nil))
+	default:
+		return "", nil, fmt.Errorf("unsupported algorithm %q", r.Alg)
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return "", nil, err
+	}
+	return r.Hash, append(line, '\n'), nil
+}
+
+// Log appends records to the configured sink, chaining each one to the one
+// before. It is safe for concurrent use.
+type Log struct {
+	mu     sync.Mutex
+	config Config
+	sink   sink
+	key    []byte
+	seq    uint64
+	prev   string
+}
+
+// Default is the audit log of the process, shared by all cleaners so that
+// their records form a single chain.
+var Default = NewLog()
+
+// NewLog creates a Log writing to stdout until configured otherwise.
+func NewLog() *Log {
+	return &Log{config: DefaultConfig(), sink: stdoutSink{}}
+}
+
+// Configure switches l to the sink described by cfg, unless it already
+// writes there. A file sink holding records continues their chain if l has
+// not written any yet, so that the chain survives restarts.
+func (l *Log) Configure(cfg Config) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if cfg == l.config {
+		return nil
+	}
+	key, err := ReadKey(cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	s, last, err := open(cfg)
+	if err != nil {
+		return err
+	}
+	if err := l.sink.close(); err != nil {
+		s.close()
+		return err
+	}
+	l.sink, l.config, l.key = s, cfg, key
+	if l.seq == 0 && last != nil {
+		l.seq, l.prev = last.Seq, last.Hash
+	}
+	return nil
+}
+
+// Record appends r to the log. A record that cannot be written still takes
+// its place in the chain, so that it shows up as a gap.
+func (l *Log) Record(r Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	r.Version = Version
+	r.Seq = l.seq
+	r.Time = time.Now().UTC()
+	r.Prev = l.prev
+	r.Alg = AlgSHA256
+	if l.key != nil {
+		r.Alg = AlgHMACSHA256
+	}
+	hash, line, err := seal(r, l.key)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record %d: %w", r.Seq, err)
+	}
+	l.prev = hash
+	if err := l.sink.write(line); err != nil {
+		return fmt.Errorf("failed to write audit record %d: %w", r.Seq, err)
+	}
+	return nil
+}
+
+// ReadKey returns the key in the file at path, without surrounding
+// whitespace, or nil if path is empty.
+func ReadKey(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the audit key: %w", err)
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("the audit key in %s is empty", path)
+	}
+	return key, nil
+}
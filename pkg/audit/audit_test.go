@@ -0,0 +1,297 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// record writes the deletion of pod name to l.
+func record(t *testing.T, l *Log, name string) {
+	t.Helper()
+	obj := &metav1.ObjectMeta{Namespace: "ci", Name: name, UID: types.UID(name + "-uid")}
+	rec := NewRecord(ActionDelete, "v1", "Pod", obj)
+	rec.CleanerKind, rec.Cleaner, rec.Rule = "NamespaceCleaner", "ci", "Finished"
+	if err := l.Record(rec); err != nil {
+		t.Fatalf("Record() = %v", err)
+	}
+}
+
+// chain writes the deletion of every pod in names to a new log at path, and
+// returns the lines of the file.
+func chain(t *testing.T, path string, key []byte, names ...string) [][]byte {
+	t.Helper()
+	cfg := Config{Sink: SinkFile, Path: path, MaxSize: DefaultMaxSize}
+	if key != nil {
+		cfg.KeyFile = filepath.Join(filepath.Dir(path), "key")
+		if err := os.WriteFile(cfg.KeyFile, append(key, '\n'), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l := NewLog()
+	if err := l.Configure(cfg); err != nil {
+		t.Fatalf("Configure() = %v", err)
+	}
+	for _, name := range names {
+		record(t, l, name)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	return lines[:len(lines)-1]
+}
+
+func TestVerify(t *testing.T) {
+	key := []byte("s3cr3t")
+
+	tests := []struct {
+		name string
+		// lines builds the log verified, from a chain of five records.
+		lines         func(t *testing.T, lines [][]byte) [][]byte
+		key           []byte
+		signed        bool
+		allowRestarts bool
+		wantErr       string
+		wantRestarts  int
+	}{{
+		name:  "intact",
+		lines: func(_ *testing.T, lines [][]byte) [][]byte { return lines },
+	}, {
+		name: "other lines and prefixes",
+		lines: func(_ *testing.T, lines [][]byte) [][]byte {
+			out := [][]byte{[]byte("starting controller\n")}
+			for _, line := range lines {
+				out = append(out, append([]byte("<133>1 - host namespacecleaner - audit - "), line...))
+			}
+			return out
+		},
+	}, {
+		name: "modified record",
+		lines: func(_ *testing.T, lines [][]byte) [][]byte {
+			lines[2] = bytes.Replace(lines[2], []byte(`"name":"p3"`), []byte(`"name":"p9"`), 1)
+			return lines
+		},
+		wantErr: "record 3 was modified",
+	}, {
+		name: "removed record",
+		lines: func(_ *testing.T, lines [][]byte) [][]byte {
+			return append(lines[:2:2], lines[3:]...)
+		},
+		wantErr: "record 3 is missing",
+	}, {
+		name: "removed records",
+		lines: func(_ *testing.T, lines [][]byte) [][]byte {
+			return append(lines[:1:1], lines[4:]...)
+		},
+		wantErr: "records 2 to 4 are missing",
+	}, {
+		name: "reordered records",
+		lines: func(_ *testing.T, lines [][]byte) [][]byte {
+			lines[2], lines[3] = lines[3], lines[2]
+			return lines
+		},
+		wantErr: "record 3 is missing",
+	}, {
+		name: "repeated record",
+		lines: func(_ *testing.T, lines [][]byte) [][]byte {
+			return append(lines[:3:3], lines[2:]...)
+		},
+		wantErr: "record 3 repeats or precedes record 3",
+	}, {
+		name: "spliced new chain",
+		lines: func(t *testing.T, lines [][]byte) [][]byte {
+			spliced := chain(t, filepath.Join(t.TempDir(), "audit.log"), nil, "x1", "x2")
+			return append(lines[:2:2], spliced...)
+		},
+		wantErr: "a new chain starts",
+	}, {
+		name: "restart allowed",
+		lines: func(t *testing.T, lines [][]byte) [][]byte {
+			restarted := chain(t, filepath.Join(t.TempDir(), "audit.log"), nil, "x1", "x2")
+			return append(lines, restarted...)
+		},
+		allowRestarts: true,
+		wantRestarts:  1,
+	}, {
+		// Without a key anyone can extend the chain, which is what
+		// signing prevents.
+		name: "unsigned record appended",
+		lines: func(t *testing.T, lines [][]byte) [][]byte {
+			r, _ := parse(lines[4])
+			forged := *r
+			forged.Seq, forged.Prev, forged.Object.Name = 6, r.Hash, "forged"
+			_, line, err := seal(forged, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return append(lines, line)
+		},
+	}, {
+		name:   "signed",
+		lines:  func(_ *testing.T, lines [][]byte) [][]byte { return lines },
+		signed: true,
+		key:    key,
+	}, {
+		name:    "signed without key",
+		lines:   func(_ *testing.T, lines [][]byte) [][]byte { return lines },
+		signed:  true,
+		wantErr: "record 1 is signed",
+	}, {
+		name:    "signed with another key",
+		lines:   func(_ *testing.T, lines [][]byte) [][]byte { return lines },
+		signed:  true,
+		key:     []byte("other"),
+		wantErr: "record 1 was modified or signed with another key",
+	}, {
+		name: "signed record recomputed without the key",
+		lines: func(t *testing.T, lines [][]byte) [][]byte {
+			r, _ := parse(lines[4])
+			forged := *r
+			forged.Seq, forged.Prev, forged.Object.Name, forged.Alg = 6, r.Hash, "forged", AlgSHA256
+			_, line, err := seal(forged, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return append(lines, line)
+		},
+		signed:  true,
+		key:     key,
+		wantErr: "record 6 is not signed with the key",
+	}, {
+		name:    "unsigned with key",
+		lines:   func(_ *testing.T, lines [][]byte) [][]byte { return lines },
+		key:     key,
+		wantErr: "record 1 is not signed with the key",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var signingKey []byte
+			if test.signed {
+				signingKey = key
+			}
+			lines := chain(t, filepath.Join(t.TempDir(), "audit.log"), signingKey, "p1", "p2", "p3", "p4", "p5")
+
+			v := Verifier{Key: test.key, AllowRestarts: test.allowRestarts}
+			err := v.Verify("audit.log", bytes.NewReader(bytes.Join(test.lines(t, lines), nil)))
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Fatalf("Verify() = %v", err)
+			case test.wantErr != "" && err == nil:
+				t.Fatalf("Verify() = nil, want error containing %q", test.wantErr)
+			case test.wantErr != "" && !strings.Contains(err.Error(), test.wantErr):
+				t.Fatalf("Verify() = %v, want error containing %q", err, test.wantErr)
+			}
+			if err == nil && len(v.Restarts) != test.wantRestarts {
+				t.Errorf("Restarts = %v, want %d", v.Restarts, test.wantRestarts)
+			}
+		})
+	}
+}
+
+func TestLogContinuesAfterRotationAndRestart(t *testing.T) {
+	tests := []struct {
+		name string
+		// crash runs between the two processes writing the log.
+		crash func(t *testing.T, path string)
+	}{{
+		name:  "restart",
+		crash: func(*testing.T, string) {},
+	}, {
+		name: "restart right after rotation",
+		crash: func(t *testing.T, path string) {
+			// The file was rotated, but the record that did not fit
+			// was never written.
+			s := &fileSink{path: path, maxBackups: 10}
+			if err := s.open(); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.rotate(); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.close(); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			// Small enough to rotate every few records.
+			cfg := Config{Sink: SinkFile, Path: path, MaxSize: 1024, MaxBackups: 10}
+
+			first := NewLog()
+			if err := first.Configure(cfg); err != nil {
+				t.Fatalf("Configure() = %v", err)
+			}
+			for _, name := range []string{"p1", "p2", "p3", "p4", "p5"} {
+				record(t, first, name)
+			}
+			if err := first.sink.close(); err != nil {
+				t.Fatal(err)
+			}
+			test.crash(t, path)
+
+			second := NewLog()
+			if err := second.Configure(cfg); err != nil {
+				t.Fatalf("Configure() = %v", err)
+			}
+			for _, name := range []string{"p6", "p7", "p8"} {
+				record(t, second, name)
+			}
+
+			files, err := filepath.Glob(path + ".*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) == 0 {
+				t.Fatal("the log was not rotated")
+			}
+			// Oldest first: audit.log.N ... audit.log.1, audit.log.
+			var v Verifier
+			for i := len(files); i >= 0; i-- {
+				name := path
+				if i > 0 {
+					name = path + "." + strconv.Itoa(i)
+				}
+				f, err := os.Open(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = v.Verify(name, f)
+				f.Close()
+				if err != nil {
+					t.Fatalf("Verify() = %v", err)
+				}
+			}
+			if v.Records != 8 || v.First != 1 || v.Last != 8 {
+				t.Errorf("verified %d records, %d to %d, want 8, 1 to 8", v.Records, v.First, v.Last)
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Sinks the audit log can be written to.
+const (
+	SinkStdout = "stdout"
+	SinkFile   = "file"
+	SinkSyslog = "syslog"
+	SinkNone   = "none"
+)
+
+const (
+	// DefaultPath is the file written by the file sink when not configured.
+	DefaultPath = "/var/log/namespacecleaner/audit.log"
+
+	// DefaultMaxSize is the size in bytes beyond which the file is rotated
+	// when not configured.
+	DefaultMaxSize = 100 << 20
+
+	// DefaultMaxBackups is the number of rotated files kept when not
+	// configured.
+	DefaultMaxBackups = 5
+
+	// syslogPriority is the priority of the syslog messages, facility
+	// local0 and severity notice.
+	syslogPriority = 16*8 + 5
+
+	// syslogTimeout bounds connecting to and writing to the syslog server.
+	syslogTimeout = 5 * time.Second
+
+	// tailSize is how much of the end of a file is read to find the record
+	// its chain continues from.
+	tailSize = 64 << 10
+)
+
+// Config selects where the audit log is written.
+type Config struct {
+	// Sink is one of the Sink constants.
+	Sink string
+
+	// Path is the file written by the file sink. Rotated files get a .1,
+	// .2, ... suffix, .1 being the most recent.
+	Path string
+	// MaxSize is the size in bytes beyond which the file is rotated.
+	MaxSize int64
+	// MaxBackups is the number of rotated files kept.
+	MaxBackups int
+
+	// SyslogAddress is the udp:// or tcp:// address of the server the
+	// syslog sink writes to, as RFC 5424 messages.
+	SyslogAddress string
+
+	// KeyFile holds the key the records are signed with using
+	// HMAC-SHA256. Without one they are only hashed with SHA-256.
+	KeyFile string
+}
+
+// DefaultConfig writes the audit log to stdout.
+func DefaultConfig() Config {
+	return Config{
+		Sink:       SinkStdout,
+		Path:       DefaultPath,
+		MaxSize:    DefaultMaxSize,
+		MaxBackups: DefaultMaxBackups,
+	}
+}
+
+// Validate checks that c describes a usable sink.
+func (c Config) Validate() error {
+	switch c.Sink {
+	case SinkStdout, SinkNone:
+	case SinkFile:
+		if c.Path == "" {
+			return errors.New("the file sink needs a path")
+		}
+		if c.MaxSize <= 0 {
+			return fmt.Errorf("max size must be positive, was %d", c.MaxSize)
+		}
+		if c.MaxBackups < 0 {
+			return fmt.Errorf("max backups must not be negative, was %d", c.MaxBackups)
+		}
+	case SinkSyslog:
+		if _, _, err := syslogAddress(c.SyslogAddress); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported sink %q", c.Sink)
+	}
+	return nil
+}
+
+// sink is where records are written to, one line each.
+type sink interface {
+	write(line []byte) error
+	close() error
+}
+
+// open opens the sink cfg describes, and returns the last record it already
+// holds, if known.
+func open(cfg Config) (sink, *Record, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	switch cfg.Sink {
+	case SinkFile:
+		return openFile(cfg)
+	case SinkSyslog:
+		network, address, _ := syslogAddress(cfg.SyslogAddress)
+		return &syslogSink{network: network, address: address}, nil, nil
+	case SinkNone:
+		return noneSink{}, nil, nil
+	default:
+		return stdoutSink{}, nil, nil
+	}
+}
+
+type stdoutSink struct{}
+
+func (stdoutSink) write(line []byte) error {
+	_, err := os.Stdout.Write(line)
+	return err
+}
+
+func (stdoutSink) close() error { return nil }
+
+type noneSink struct{}
+
+func (noneSink) write([]byte) error { return nil }
+
+func (noneSink) close() error { return nil }
+
+// fileSink appends to a local file, rotating it once it grows beyond
+// maxSize.
+type fileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	f    *os.File
+	size int64
+}
+
+func openFile(cfg Config) (*fileSink, *Record, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o750); err != nil {
+		return nil, nil, err
+	}
+	last, err := lastRecord(cfg.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The file is rotated before the record that does not fit is written,
+	// so the chain may end in the most recent backup.
+	if last == nil && cfg.MaxBackups > 0 {
+		if last, err = lastRecord(cfg.Path + ".1"); err != nil {
+			return nil, nil, err
+		}
+	}
+	s := &fileSink{path: cfg.Path, maxSize: cfg.MaxSize, maxBackups: cfg.MaxBackups}
+	if err := s.open(); err != nil {
+		return nil, nil, err
+	}
+	return s, last, nil
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size = f, info.Size()
+	return nil
+}
+
+func (s *fileSink) write(line []byte) error {
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.f.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	// Records are few and must survive a crash of the node.
+	return s.f.Sync()
+}
+
+// rotate shifts the file to .1, .1 to .2 and so on, dropping the oldest.
+func (s *fileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	if s.maxBackups == 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for i := s.maxBackups; i > 0; i-- {
+		from := s.path
+		if i > 1 {
+			from = s.path + "." + strconv.Itoa(i-1)
+		}
+		if err := os.Rename(from, s.path+"."+strconv.Itoa(i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return s.open()
+}
+
+func (s *fileSink) close() error {
+	return s.f.Close()
+}
+
+// lastRecord returns the last record of the file at path, nil if there is
+// none.
+func lastRecord(path string) (*Record, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > tailSize {
+		if _, err := f.Seek(info.Size()-tailSize, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	var last *Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), tailSize)
+	for scanner.Scan() {
+		if r, ok := parse(scanner.Bytes()); ok {
+			last = r
+		}
+	}
+	return last, scanner.Err()
+}
+
+// parse decodes the record in line, if any.
+func parse(line []byte) (*Record, bool) {
+	start := bytes.Index(line, recordPrefix)
+	if start < 0 {
+		return nil, false
+	}
+	var r Record
+	if err := json.Unmarshal(line[start:], &r); err != nil {
+		return nil, false
+	}
+	return &r, true
+}
+
+// recordPrefix starts every record, wherever it appears in a line.
+var recordPrefix = []byte(`{"audit":`)
+
+// syslogSink sends every record as an RFC 5424 message, framed by octet
+// counting over TCP.
+type syslogSink struct {
+	network, address string
+	conn             net.Conn
+}
+
+func (s *syslogSink) write(line []byte) error {
+	hostname, _ := os.Hostname()
+	msg := fmt.Sprintf("<%d>1 %s %s namespacecleaner %d audit - %s",
+		syslogPriority, time.Now().UTC().Format(time.RFC3339Nano), hostname, os.Getpid(), bytes.TrimSuffix(line, []byte("\n")))
+	if s.network == "tcp" {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+
+	// Reconnect once if the server went away since the last record.
+	err := s.send(msg)
+	if err != nil && s.conn != nil {
+		s.close()
+		err = s.send(msg)
+	}
+	return err
+}
+
+func (s *syslogSink) send(msg string) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.address, syslogTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if err := s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(s.conn, msg)
+	return err
+}
+
+func (s *syslogSink) close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// syslogAddress splits a udp:// or tcp:// URL into network and address.
+func syslogAddress(raw string) (string, string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+		return "", "", fmt.Errorf("syslog address must be a udp:// or tcp:// URL, was %q", raw)
+	}
+	return u.Scheme, u.Host, nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxLineSize bounds the lines read by Verifier.
+const maxLineSize = 1 << 20
+
+// Verifier checks that records form an unbroken chain. Lines not holding a
+// record, e.g. other log lines on stdout, are skipped, and records may be
+// prefixed, e.g. by a syslog header.
+type Verifier struct {
+	// Records is the number of records verified.
+	Records int
+	// First and Last are the sequence numbers of the first and last record
+	// verified. Records before First may have been rotated away.
+	First, Last uint64
+	// Restarts lists where a new chain started, because the controller
+	// restarted with nothing to continue the previous chain from.
+	Restarts []string
+
+	// Key verifies records signed with HMAC-SHA256. When set, records
+	// that are only hashed fail verification.
+	Key []byte
+	// AllowRestarts accepts a new chain starting after the first record.
+	// Otherwise it fails verification, since cutting the log and starting
+	// a new chain from there looks the same as a restart.
+	AllowRestarts bool
+
+	prev string
+}
+
+// Verify checks the records read from r, named name in errors, as the
+// continuation of those verified so far. It fails on the first record that
+// was modified, or that does not directly follow the previous one.
+func (v *Verifier) Verify(name string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		where := fmt.Sprintf("%s:%d", name, line)
+		if err := v.verify(where, scanner.Bytes()); err != nil {
+			return fmt.Errorf("%s: %w", where, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func (v *Verifier) verify(where string, line []byte) error {
+	start := bytes.Index(line, recordPrefix)
+	if start < 0 {
+		return nil
+	}
+	var r Record
+	decoder := json.NewDecoder(bytes.NewReader(line[start:]))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&r); err != nil {
+		return fmt.Errorf("malformed record: %w", err)
+	}
+	if r.Version != Version {
+		return fmt.Errorf("record %d has unsupported version %q", r.Seq, r.Version)
+	}
+
+	switch {
+	case r.Alg == AlgHMACSHA256 && v.Key == nil:
+		return fmt.Errorf("record %d is signed, its key is needed to verify it", r.Seq)
+	case r.Alg != AlgHMACSHA256 && v.Key != nil:
+		return fmt.Errorf("record %d is not signed with the key", r.Seq)
+	}
+	hash, _, err := seal(r, v.Key)
+	if err != nil {
+		return fmt.Errorf("record %d: %w", r.Seq, err)
+	}
+	if !hmac.Equal([]byte(hash), []byte(r.Hash)) {
+		if v.Key != nil {
+			return fmt.Errorf("record %d was modified or signed with another key: its hash does not match its content", r.Seq)
+		}
+		return fmt.Errorf("record %d was modified: its hash does not match its content", r.Seq)
+	}
+
+	switch {
+	case v.Records == 0:
+		// The records before the first one verified cannot be checked.
+		v.First = r.Seq
+	case r.Seq == 1 && r.Prev == "":
+		if !v.AllowRestarts {
+			return errors.New("a new chain starts: the log was cut, or the controller restarted")
+		}
+		v.Restarts = append(v.Restarts, where)
+	case r.Seq <= v.Last:
+		return fmt.Errorf("record %d repeats or precedes record %d", r.Seq, v.Last)
+	case r.Seq == v.Last+2:
+		return fmt.Errorf("record %d is missing", v.Last+1)
+	case r.Seq != v.Last+1:
+		return fmt.Errorf("records %d to %d are missing", v.Last+1, r.Seq-1)
+	case r.Prev != v.prev:
+		return fmt.Errorf("record %d does not follow record %d: the chain is broken", r.Seq, v.Last)
+	}
+
+	v.Records++
+	v.Last, v.prev = r.Seq, r.Hash
+	return nil
+}
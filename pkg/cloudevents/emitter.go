@@ -0,0 +1,209 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cloudevents emits CloudEvents describing what cleaners do to an
+// HTTP sink, such as a Knative Eventing broker, in binary content mode.
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// Types of the events emitted.
+const (
+	TypePodDeleted   = "io.clusterops.namespacecleaner.pod.deleted"
+	TypeRunStarted   = "io.clusterops.namespacecleaner.run.started"
+	TypeRunCompleted = "io.clusterops.namespacecleaner.run.completed"
+	TypeRunFailed    = "io.clusterops.namespacecleaner.run.failed"
+)
+
+const (
+	// BufferSize is the number of events waiting for delivery beyond which
+	// new events are dropped.
+	BufferSize = 1000
+
+	// deliveryTimeout bounds the delivery of a single event.
+	deliveryTimeout = 10 * time.Second
+)
+
+// Event is a CloudEvent to be emitted.
+type Event struct {
+	// Type is one of the Type constants.
+	Type string
+	// Source identifies the cleaner, e.g. /apis/clusterops.io/v1alpha1/namespacecleaners/name.
+	Source string
+	// Subject is what the event is about within the source, e.g. a pod.
+	Subject string
+	// Data is marshalled to JSON as the payload.
+	Data interface{}
+}
+
+// PodDeletedData is the payload of pod.deleted events.
+type PodDeletedData struct {
+	Cleaner   string          `json:"cleaner"`
+	Run       string          `json:"run"`
+	Namespace string          `json:"namespace"`
+	Pod       string          `json:"pod"`
+	UID       types.UID       `json:"uid"`
+	Phase     corev1.PodPhase `json:"phase"`
+	Rule      string          `json:"rule"`
+	Reason    string          `json:"reason"`
+}
+
+// PodDeleted builds the pod.deleted event of pod, deleted by cleaner from
+// source in run for rule.
+func PodDeleted(source, cleaner, run string, pod *corev1.Pod, rule, reason string) Event {
+	return Event{
+		Type:    TypePodDeleted,
+		Source:  source,
+		Subject: pod.Namespace + "/" + pod.Name,
+		Data: PodDeletedData{
+			Cleaner:   cleaner,
+			Run:       run,
+			Namespace: pod.Namespace,
+			Pod:       pod.Name,
+			UID:       pod.UID,
+			Phase:     pod.Status.Phase,
+			Rule:      rule,
+			Reason:    reason,
+		},
+	}
+}
+
+// Emitter delivers events to a sink in the background. Emit never blocks:
+// events are buffered up to BufferSize and dropped beyond that, or while no
+// sink is configured.
+type Emitter struct {
+	client *http.Client
+	logger *zap.SugaredLogger
+	queue  chan delivery
+
+	mu   sync.RWMutex
+	sink string
+
+	dropped atomic.Int64
+}
+
+// delivery is an event stamped with its id and time when it was emitted.
+type delivery struct {
+	Event
+	id   string
+	time time.Time
+}
+
+// NewEmitter returns an Emitter without sink; Run delivers its events.
+func NewEmitter(logger *zap.SugaredLogger) *Emitter {
+	return &Emitter{
+		client: &http.Client{Timeout: deliveryTimeout},
+		logger: logger,
+		queue:  make(chan delivery, BufferSize),
+	}
+}
+
+// SetSink sets the URI events are posted to, or disables emitting when empty.
+func (e *Emitter) SetSink(sink string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sink = sink
+}
+
+func (e *Emitter) currentSink() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.sink
+}
+
+// Emit queues event for delivery.
+func (e *Emitter) Emit(event Event) {
+	if e == nil || e.currentSink() == "" {
+		return
+	}
+	select {
+	case e.queue <- delivery{Event: event, id: string(uuid.NewUUID()), time: time.Now()}:
+	default:
+		// Log every thousandth drop only, the sink is down or too slow.
+		if dropped := e.dropped.Add(1); dropped%BufferSize == 1 {
+			e.logger.Warnw("CloudEvents buffer is full, dropping events", zap.Int64("dropped", dropped))
+		}
+	}
+}
+
+// Run delivers the queued events until ctx is done.
+func (e *Emitter) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-e.queue:
+			sink := e.currentSink()
+			if sink == "" {
+				continue
+			}
+			if err := e.deliver(ctx, sink, d); err != nil {
+				e.logger.Warnw("Failed to deliver CloudEvent",
+					zap.String("type", d.Type),
+					zap.String("id", d.id),
+					zap.Error(err))
+			}
+		}
+	}
+}
+
+// deliver posts d to sink in binary content mode: the attributes as ce-
+// headers and the data as the JSON body.
+func (e *Emitter) deliver(ctx context.Context, sink string, d delivery) error {
+	body, err := json.Marshal(d.Data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal data: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Ce-Specversion", "1.0")
+	req.Header.Set("Ce-Id", d.id)
+	req.Header.Set("Ce-Type", d.Type)
+	req.Header.Set("Ce-Source", d.Source)
+	req.Header.Set("Ce-Time", d.time.UTC().Format(time.RFC3339Nano))
+	if d.Subject != "" {
+		req.Header.Set("Ce-Subject", d.Subject)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("sink responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudevents
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// request is what the sink received.
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// newSink answers every request with status and passes it on to the
+// returned channel.
+func newSink(t *testing.T, status int) (chan request, *httptest.Server) {
+	requests := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			t.Errorf("failed to read body: %v", err)
+		}
+		requests <- request{header: req.Header, body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return requests, server
+}
+
+// start runs e until the test ends.
+func start(t *testing.T, e *Emitter) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func receive(t *testing.T, requests chan request) request {
+	t.Helper()
+	select {
+	case r := <-requests:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("the sink received no event")
+		return request{}
+	}
+}
+
+func TestEmit(t *testing.T) {
+	requests, server := newSink(t, http.StatusAccepted)
+	e := NewEmitter(zap.NewNop().Sugar())
+	e.SetSink(server.URL)
+	start(t, e)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "build-1", UID: "uid-1"},
+		Status:     corev1.PodStatus{Phase: corev1.PodFailed},
+	}
+	before := time.Now()
+	e.Emit(PodDeleted("/apis/clusterops.io/v1alpha1/namespacecleaners/ci", "ci", "ci-1", pod, "ttl", "finished 2h ago"))
+	r := receive(t, requests)
+
+	want := map[string]string{
+		"Content-Type":   "application/json",
+		"Ce-Specversion": "1.0",
+		"Ce-Type":        TypePodDeleted,
+		"Ce-Source":      "/apis/clusterops.io/v1alpha1/namespacecleaners/ci",
+		"Ce-Subject":     "ci/build-1",
+	}
+	for header, value := range want {
+		if got := r.header.Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+	}
+	if r.header.Get("Ce-Id") == "" {
+		t.Error("Ce-Id is empty")
+	}
+	if at, err := time.Parse(time.RFC3339Nano, r.header.Get("Ce-Time")); err != nil || at.Before(before.Truncate(time.Second)) {
+		t.Errorf("Ce-Time = %q, want the RFC3339 time the event was emitted", r.header.Get("Ce-Time"))
+	}
+
+	var data PodDeletedData
+	if err := json.Unmarshal(r.body, &data); err != nil {
+		t.Fatalf("malformed body %q: %v", r.body, err)
+	}
+	wantData := PodDeletedData{
+		Cleaner:   "ci",
+		Run:       "ci-1",
+		Namespace: "ci",
+		Pod:       "build-1",
+		UID:       "uid-1",
+		Phase:     corev1.PodFailed,
+		Rule:      "ttl",
+		Reason:    "finished 2h ago",
+	}
+	if data != wantData {
+		t.Errorf("data = %+v, want %+v", data, wantData)
+	}
+}
+
+func TestEmitWithoutSubject(t *testing.T) {
+	requests, server := newSink(t, http.StatusOK)
+	e := NewEmitter(zap.NewNop().Sugar())
+	e.SetSink(server.URL)
+	start(t, e)
+
+	e.Emit(Event{Type: TypeRunStarted, Source: "/source", Data: map[string]string{}})
+	if r := receive(t, requests); r.header["Ce-Subject"] != nil {
+		t.Errorf("Ce-Subject = %q, want none", r.header.Get("Ce-Subject"))
+	}
+}
+
+func TestEmitIDs(t *testing.T) {
+	requests, server := newSink(t, http.StatusOK)
+	e := NewEmitter(zap.NewNop().Sugar())
+	e.SetSink(server.URL)
+	start(t, e)
+
+	e.Emit(Event{Type: TypeRunStarted, Source: "/source"})
+	e.Emit(Event{Type: TypeRunStarted, Source: "/source"})
+	if first, second := receive(t, requests), receive(t, requests); first.header.Get("Ce-Id") == second.header.Get("Ce-Id") {
+		t.Errorf("both events have Ce-Id %q, want distinct ids", first.header.Get("Ce-Id"))
+	}
+}
+
+func TestEmitWithoutSink(t *testing.T) {
+	e := NewEmitter(zap.NewNop().Sugar())
+
+	e.Emit(Event{Type: TypeRunStarted, Source: "/source"})
+	if len(e.queue) != 0 {
+		t.Errorf("%d events queued, want none without a sink", len(e.queue))
+	}
+
+	var nilEmitter *Emitter
+	nilEmitter.Emit(Event{Type: TypeRunStarted, Source: "/source"})
+}
+
+func TestEmitBufferFull(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	e := NewEmitter(zap.New(core).Sugar())
+	// Nothing delivers, so the buffer fills up.
+	e.SetSink("http://sink.invalid")
+
+	for range BufferSize + 5 {
+		e.Emit(Event{Type: TypeRunStarted, Source: "/source"})
+	}
+	if len(e.queue) != BufferSize {
+		t.Errorf("%d events queued, want %d", len(e.queue), BufferSize)
+	}
+	if got := e.dropped.Load(); got != 5 {
+		t.Errorf("%d events dropped, want 5", got)
+	}
+	// Only the first drop of every BufferSize is logged.
+	if got := logs.FilterMessage("CloudEvents buffer is full, dropping events").Len(); got != 1 {
+		t.Errorf("dropping was logged %d times, want once", got)
+	}
+}
+
+func TestRunContinuesAfterRejection(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	requests, server := newSink(t, http.StatusServiceUnavailable)
+	e := NewEmitter(zap.New(core).Sugar())
+	e.SetSink(server.URL)
+	start(t, e)
+
+	e.Emit(Event{Type: TypeRunStarted, Source: "/source"})
+	e.Emit(Event{Type: TypeRunFailed, Source: "/source"})
+	receive(t, requests)
+	if r := receive(t, requests); r.header.Get("Ce-Type") != TypeRunFailed {
+		t.Errorf("Ce-Type = %q, want the second event delivered as well", r.header.Get("Ce-Type"))
+	}
+
+	// The second failure is logged after the response was read.
+	deadline := time.Now().Add(5 * time.Second)
+	for logs.FilterMessage("Failed to deliver CloudEvent").Len() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := logs.FilterMessage("Failed to deliver CloudEvent").Len(); got != 2 {
+		t.Errorf("%d failed deliveries logged, want 2", got)
+	}
+}
+
+func TestRunShutdown(t *testing.T) {
+	// The sink never answers, so the delivery in progress is only ended by
+	// the shutdown.
+	received := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// The request is only cancelled when the client goes away once
+		// its body was read.
+		io.Copy(io.Discard, req.Body)
+		received <- struct{}{}
+		<-req.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	e := NewEmitter(zap.NewNop().Sugar())
+	e.SetSink(server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+
+	e.Emit(Event{Type: TypeRunStarted, Source: "/source"})
+	e.Emit(Event{Type: TypeRunCompleted, Source: "/source"})
+	<-received
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after its context was cancelled")
+	}
+	select {
+	case <-received:
+		t.Error("an event was delivered after the shutdown")
+	default:
+	}
+}
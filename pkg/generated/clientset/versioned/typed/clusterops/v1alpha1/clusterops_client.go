@@ -27,7 +27,9 @@ import (
 
 type ClusteropsV1alpha1Interface interface {
 	RESTClient() rest.Interface
+	CleanupRunsGetter
 	NamespaceCleanersGetter
+	PodCleanersGetter
 }
 
 // ClusteropsV1alpha1Client is used to interact with features provided by the clusterops.io group.
@@ -35,10 +37,18 @@ type ClusteropsV1alpha1Client struct {
 	restClient rest.Interface
 }
 
+func (c *ClusteropsV1alpha1Client) CleanupRuns() CleanupRunInterface {
+	return newCleanupRuns(c)
+}
+
 func (c *ClusteropsV1alpha1Client) NamespaceCleaners() NamespaceCleanerInterface {
 	return newNamespaceCleaners(c)
 }
 
+func (c *ClusteropsV1alpha1Client) PodCleaners(namespace string) PodCleanerInterface {
+	return newPodCleaners(c, namespace)
+}
+
 // NewForConfig creates a new ClusteropsV1alpha1Client for the given config.
 // NewForConfig is equivalent to NewForConfigAndClient(c, httpClient),
 // where httpClient was generated with rest.HTTPClientFor(c).
@@ -27,10 +27,18 @@ type FakeClusteropsV1alpha1 struct {
 	*testing.Fake
 }
 
+func (c *FakeClusteropsV1alpha1) CleanupRuns() v1alpha1.CleanupRunInterface {
+	return newFakeCleanupRuns(c)
+}
+
 func (c *FakeClusteropsV1alpha1) NamespaceCleaners() v1alpha1.NamespaceCleanerInterface {
 	return newFakeNamespaceCleaners(c)
 }
 
+func (c *FakeClusteropsV1alpha1) PodCleaners(namespace string) v1alpha1.PodCleanerInterface {
+	return newFakePodCleaners(c, namespace)
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeClusteropsV1alpha1) RESTClient() rest.Interface {
@@ -17,4 +17,8 @@ limitations under the License.
 
 package v1alpha1
 
+type CleanupRunExpansion interface{}
+
 type NamespaceCleanerExpansion interface{}
+
+type PodCleanerExpansion interface{}
@@ -38,6 +38,8 @@ type NamespaceCleanersGetter interface {
 type NamespaceCleanerInterface interface {
 	Create(ctx context.Context, namespaceCleaner *clusteropsv1alpha1.NamespaceCleaner, opts v1.CreateOptions) (*clusteropsv1alpha1.NamespaceCleaner, error)
 	Update(ctx context.Context, namespaceCleaner *clusteropsv1alpha1.NamespaceCleaner, opts v1.UpdateOptions) (*clusteropsv1alpha1.NamespaceCleaner, error)
+	// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+	UpdateStatus(ctx context.Context, namespaceCleaner *clusteropsv1alpha1.NamespaceCleaner, opts v1.UpdateOptions) (*clusteropsv1alpha1.NamespaceCleaner, error)
 	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
 	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
 	Get(ctx context.Context, name string, opts v1.GetOptions) (*clusteropsv1alpha1.NamespaceCleaner, error)
@@ -23,8 +23,12 @@ import (
 
 // Interface provides access to all the informers in this group version.
 type Interface interface {
+	// CleanupRuns returns a CleanupRunInformer.
+	CleanupRuns() CleanupRunInformer
 	// NamespaceCleaners returns a NamespaceCleanerInformer.
 	NamespaceCleaners() NamespaceCleanerInformer
+	// PodCleaners returns a PodCleanerInformer.
+	PodCleaners() PodCleanerInformer
 }
 
 type version struct {
@@ -38,7 +42,17 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
 }
 
+// CleanupRuns returns a CleanupRunInformer.
+func (v *version) CleanupRuns() CleanupRunInformer {
+	return &cleanupRunInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
 // NamespaceCleaners returns a NamespaceCleanerInformer.
 func (v *version) NamespaceCleaners() NamespaceCleanerInformer {
 	return &namespaceCleanerInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
 }
+
+// PodCleaners returns a PodCleanerInformer.
+func (v *version) PodCleaners() PodCleanerInformer {
+	return &podCleanerInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
@@ -52,8 +52,12 @@ func (f *genericInformer) Lister() cache.GenericLister {
 func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource) (GenericInformer, error) {
 	switch resource {
 	// Group=clusterops.io, Version=v1alpha1
+	case v1alpha1.SchemeGroupVersion.WithResource("cleanupruns"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Clusterops().V1alpha1().CleanupRuns().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("namespacecleaners"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Clusterops().V1alpha1().NamespaceCleaners().Informer()}, nil
+	case v1alpha1.SchemeGroupVersion.WithResource("podcleaners"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Clusterops().V1alpha1().PodCleaners().Informer()}, nil
 
 	}
 
@@ -17,6 +17,18 @@ limitations under the License.
 
 package v1alpha1
 
+// CleanupRunListerExpansion allows custom methods to be added to
+// CleanupRunLister.
+type CleanupRunListerExpansion interface{}
+
 // NamespaceCleanerListerExpansion allows custom methods to be added to
 // NamespaceCleanerLister.
 type NamespaceCleanerListerExpansion interface{}
+
+// PodCleanerListerExpansion allows custom methods to be added to
+// PodCleanerLister.
+type PodCleanerListerExpansion interface{}
+
+// PodCleanerNamespaceListerExpansion allows custom methods to be added to
+// PodCleanerNamespaceLister.
+type PodCleanerNamespaceListerExpansion interface{}
@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Webhook posts notifications to a Slack or Teams compatible incoming
+// webhook, as {"text": message}.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhook returns a Webhook posting to url.
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url, Client: http.DefaultClient}
+}
+
+// Notify implements Notifier.
+func (w *Webhook) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, w.Client, w.URL, "", map[string]string{"text": n.Message})
+}
+
+// HTTP posts notifications as JSON, with the run, to a generic endpoint.
+type HTTP struct {
+	URL string
+	// Authorization is sent as the Authorization header when set.
+	Authorization string
+	Client        *http.Client
+}
+
+// NewHTTP returns an HTTP notifier posting to url.
+func NewHTTP(url, authorization string) *HTTP {
+	return &HTTP{URL: url, Authorization: authorization, Client: http.DefaultClient}
+}
+
+// Notify implements Notifier.
+func (h *HTTP) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, h.Client, h.URL, h.Authorization, struct {
+		Subject string      `json:"subject"`
+		Message string      `json:"message"`
+		Run     interface{} `json:"run"`
+	}{n.Subject, n.Message, n.Run})
+}
+
+// postJSON posts body as JSON to url. Responses other than 2xx fail, those
+// that retrying cannot fix, 4xx except 408 and 429, permanently.
+func postJSON(ctx context.Context, client *http.Client, url, authorization string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return Permanent(fmt.Errorf("failed to marshal notification: %w", err))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return Permanent(fmt.Errorf("failed to create request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post notification: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("notification rejected with %s: %s", resp.Status, bytes.TrimSpace(detail))
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
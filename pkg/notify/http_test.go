@@ -0,0 +1,124 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+// endpoint answers every request with status, recording the last request.
+type endpoint struct {
+	status int
+	header http.Header
+	body   map[string]interface{}
+}
+
+func newEndpoint(t *testing.T, status int) (*endpoint, *httptest.Server) {
+	e := &endpoint{status: status}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		e.header = req.Header
+		if err := json.NewDecoder(req.Body).Decode(&e.body); err != nil {
+			t.Errorf("malformed body: %v", err)
+		}
+		w.WriteHeader(e.status)
+		w.Write([]byte("  detail\n"))
+	}))
+	t.Cleanup(server.Close)
+	return e, server
+}
+
+func TestWebhook(t *testing.T) {
+	e, server := newEndpoint(t, http.StatusOK)
+
+	err := NewWebhook(server.URL).Notify(context.Background(), Notification{Subject: "subject", Message: "message"})
+	if err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+	if got := e.header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if len(e.body) != 1 || e.body["text"] != "message" {
+		t.Errorf("body = %v, want only the message as text", e.body)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	e, server := newEndpoint(t, http.StatusAccepted)
+	run := &v1alpha1.CleanupRun{ObjectMeta: metav1.ObjectMeta{Name: "ci-1"}}
+
+	err := NewHTTP(server.URL, "Bearer token").Notify(context.Background(), Notification{Subject: "subject", Message: "message", Run: run})
+	if err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+	if got := e.header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization = %q, want the configured one", got)
+	}
+	if e.body["subject"] != "subject" || e.body["message"] != "message" {
+		t.Errorf("body = %v, want the subject and message", e.body)
+	}
+	if got, _ := e.body["run"].(map[string]interface{})["metadata"].(map[string]interface{}); got["name"] != "ci-1" {
+		t.Errorf("body = %v, want the run", e.body)
+	}
+}
+
+func TestHTTPRejected(t *testing.T) {
+	tests := []struct {
+		status        int
+		wantPermanent bool
+	}{
+		{status: http.StatusBadRequest, wantPermanent: true},
+		{status: http.StatusNotFound, wantPermanent: true},
+		{status: http.StatusRequestTimeout},
+		{status: http.StatusTooManyRequests},
+		{status: http.StatusInternalServerError},
+		{status: http.StatusBadGateway},
+	}
+	for _, test := range tests {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			_, server := newEndpoint(t, test.status)
+
+			err := NewHTTP(server.URL, "").Notify(context.Background(), Notification{})
+			if err == nil {
+				t.Fatal("Notify() = nil, want an error")
+			}
+			var permanent *permanentError
+			if got := errors.As(err, &permanent); got != test.wantPermanent {
+				t.Errorf("Notify() = %v, permanent %v, want %v", err, got, test.wantPermanent)
+			}
+		})
+	}
+}
+
+func TestHTTPUnreachable(t *testing.T) {
+	_, server := newEndpoint(t, http.StatusOK)
+	server.Close()
+
+	err := NewHTTP(server.URL, "").Notify(context.Background(), Notification{})
+	var permanent *permanentError
+	if err == nil || errors.As(err, &permanent) {
+		t.Errorf("Notify() = %v, want an error worth retrying", err)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify sends the outcome of cleanup runs to chat webhooks, email
+// and HTTP endpoints.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+// DefaultTemplate renders a summary of a run. Templates are executed with
+// the CleanupRun as their data.
+const DefaultTemplate = `NamespaceCleaner {{.Spec.Cleaner}} run {{.Name}} {{.Status.Phase}}
+{{- if .Spec.DryRun}} (dry run){{end}}: {{.Status.TotalDeleted}} pods deleted, {{.Status.TotalSkipped}} skipped, {{.Status.TotalBlocked}} blocked in {{len .Status.Namespaces}} namespaces
+{{- range .Status.Errors}}
+- {{.}}{{end}}
+{{- range .Status.Namespaces}}{{$ns := .Name}}{{range .Errors}}
+- {{$ns}}: {{.}}{{end}}{{end}}`
+
+// Notification is the outcome of a run as delivered by a Notifier.
+type Notification struct {
+	// Subject is a one-line summary, e.g. of an email.
+	Subject string
+	// Message is the rendered template.
+	Message string
+	// Run is the finished run.
+	Run *v1alpha1.CleanupRun
+}
+
+// Notifier delivers notifications to a single destination.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Render renders the notification of run with tmpl, or DefaultTemplate when
+// tmpl is empty.
+func Render(tmpl string, run *v1alpha1.CleanupRun) (Notification, error) {
+	if tmpl == "" {
+		tmpl = DefaultTemplate
+	}
+	t, err := template.New("notification").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return Notification{}, fmt.Errorf("failed to parse template: %w", err)
+	}
+	var message bytes.Buffer
+	if err := t.Execute(&message, run); err != nil {
+		return Notification{}, fmt.Errorf("failed to render template: %w", err)
+	}
+
+	return Notification{
+		Subject: fmt.Sprintf("NamespaceCleaner %s run %s %s", run.Spec.Cleaner, run.Name, run.Status.Phase),
+		Message: strings.TrimSpace(message.String()),
+		Run:     run,
+	}, nil
+}
+
+// permanentError is a failure that retrying does not help, e.g. a rejected
+// request.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Retry is a Notifier retrying the notifications n fails to deliver with an
+// exponential backoff, unless the failure is permanent.
+type Retry struct {
+	Notifier
+	// Attempts is the maximum number of attempts.
+	Attempts int
+	// Backoff is the wait before the first retry, doubled after each one.
+	Backoff time.Duration
+}
+
+// NewRetry returns a Retry making up to 4 attempts, waiting 1s, 2s and 4s
+// in between.
+func NewRetry(n Notifier) *Retry {
+	return &Retry{Notifier: n, Attempts: 4, Backoff: time.Second}
+}
+
+// Notify implements Notifier.
+func (r *Retry) Notify(ctx context.Context, n Notification) error {
+	wait := r.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = r.Notifier.Notify(ctx, n)
+		var permanent *permanentError
+		if err == nil || errors.As(err, &permanent) || attempt >= r.Attempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w, giving up after %d attempts: %w", err, attempt, ctx.Err())
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+// failing is a Notifier failing with the errors in order, then succeeding.
+type failing struct {
+	errs  []error
+	calls int
+}
+
+func (f *failing) Notify(context.Context, Notification) error {
+	f.calls++
+	if f.calls <= len(f.errs) {
+		return f.errs[f.calls-1]
+	}
+	return nil
+}
+
+func TestRetry(t *testing.T) {
+	errFlaky := errors.New("connection refused")
+	errRejected := errors.New("rejected")
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantErr   error
+		wantCalls int
+	}{{
+		name:      "delivered",
+		wantCalls: 1,
+	}, {
+		name:      "delivered after retries",
+		errs:      []error{errFlaky, errFlaky},
+		wantCalls: 3,
+	}, {
+		name:      "gives up",
+		errs:      []error{errFlaky, errFlaky, errFlaky, errFlaky, errFlaky},
+		wantErr:   errFlaky,
+		wantCalls: 4,
+	}, {
+		name:      "permanent",
+		errs:      []error{errFlaky, Permanent(errRejected)},
+		wantErr:   errRejected,
+		wantCalls: 2,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n := &failing{errs: test.errs}
+			r := NewRetry(n)
+			r.Backoff = time.Millisecond
+
+			err := r.Notify(context.Background(), Notification{})
+			if !errors.Is(err, test.wantErr) || (test.wantErr == nil) != (err == nil) {
+				t.Errorf("Notify() = %v, want %v", err, test.wantErr)
+			}
+			if n.calls != test.wantCalls {
+				t.Errorf("attempts = %d, want %d", n.calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	errFlaky := errors.New("connection refused")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	n := &failing{errs: []error{errFlaky, errFlaky}}
+	r := NewRetry(n)
+	r.Backoff = time.Hour
+
+	err := r.Notify(ctx, Notification{})
+	if !errors.Is(err, errFlaky) || !errors.Is(err, context.Canceled) {
+		t.Errorf("Notify() = %v, want both the failure and the cancellation", err)
+	}
+	if n.calls != 1 {
+		t.Errorf("attempts = %d, want 1", n.calls)
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	err := errors.New("rejected")
+	wrapped := Permanent(err)
+	if !errors.Is(wrapped, err) {
+		t.Errorf("Permanent(%v) does not wrap it", err)
+	}
+	if wrapped.Error() != err.Error() {
+		t.Errorf("Error() = %q, want %q", wrapped.Error(), err.Error())
+	}
+	var permanent *permanentError
+	if !errors.As(wrapped, &permanent) {
+		t.Errorf("Permanent(%v) is not permanent", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	run := &v1alpha1.CleanupRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "ci-1"},
+		Spec:       v1alpha1.CleanupRunSpec{Cleaner: "ci", DryRun: true},
+		Status: v1alpha1.CleanupRunStatus{
+			Phase:        v1alpha1.RunPhaseFailed,
+			TotalDeleted: 3,
+			Errors:       []string{"listing failed"},
+			Namespaces: []v1alpha1.NamespaceRunResult{{
+				Name:   "team-a",
+				Errors: []string{"forbidden"},
+			}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		template    string
+		wantMessage string
+		wantErr     bool
+	}{{
+		name: "default",
+		wantMessage: "NamespaceCleaner ci run ci-1 Failed (dry run): 3 pods deleted, 0 skipped, 0 blocked in 1 namespaces\n" +
+			"- listing failed\n" +
+			"- team-a: forbidden",
+	}, {
+		name:        "custom",
+		template:    "{{.Spec.Cleaner}} deleted {{.Status.TotalDeleted}}",
+		wantMessage: "ci deleted 3",
+	}, {
+		name:     "unknown field",
+		template: "{{.Status.Nope}}",
+		wantErr:  true,
+	}, {
+		name:     "malformed",
+		template: "{{.Spec.Cleaner",
+		wantErr:  true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n, err := Render(test.template, run)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Render() = %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if n.Message != test.wantMessage {
+				t.Errorf("Message = %q, want %q", n.Message, test.wantMessage)
+			}
+			if want := "NamespaceCleaner ci run ci-1 Failed"; n.Subject != want {
+				t.Errorf("Subject = %q, want %q", n.Subject, want)
+			}
+			if n.Run != run {
+				t.Errorf("Run = %v, want the rendered run", n.Run)
+			}
+		})
+	}
+}
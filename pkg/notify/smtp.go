@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// SMTP emails notifications through a mail server.
+type SMTP struct {
+	// Address of the server, host:port.
+	Address string
+	From    string
+	To      []string
+	// Username and Password authenticate with PLAIN when set, which the
+	// server must offer over TLS unless it is on localhost.
+	Username string
+	Password string
+}
+
+// Notify implements Notifier.
+func (s *SMTP) Notify(ctx context.Context, n Notification) error {
+	host, _, err := net.SplitHostPort(s.Address)
+	if err != nil {
+		return Permanent(fmt.Errorf("invalid SMTP address %q: %w", s.Address, err))
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", n.Subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Message, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	// smtp.SendMail takes no context, so the context only bounds the wait.
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.Address, auth, s.From, s.To, msg.Bytes())
+	}()
+	select {
+	case err := <-done:
+		var reply *textproto.Error
+		if errors.As(err, &reply) && reply.Code/100 == 5 {
+			return Permanent(fmt.Errorf("email rejected: %w", err))
+		} else if err != nil {
+			return fmt.Errorf("failed to send email: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
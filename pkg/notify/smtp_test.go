@@ -0,0 +1,161 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// smtpServer is a stand-in mail server accepting a single message, or
+// answering RCPT with rcptReply when set.
+type smtpServer struct {
+	rcptReply string
+
+	from, to string
+	data     string
+	done     chan struct{}
+}
+
+func newSMTPServer(t *testing.T, rcptReply string) (*smtpServer, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &smtpServer{rcptReply: rcptReply, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.serve(textproto.NewConn(conn))
+	}()
+	return s, l.Addr().String()
+}
+
+func (s *smtpServer) serve(c *textproto.Conn) {
+	c.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			c.PrintfLine("250 localhost")
+		case "MAIL":
+			s.from = arg
+			c.PrintfLine("250 OK")
+		case "RCPT":
+			if s.rcptReply != "" {
+				c.PrintfLine("%s", s.rcptReply)
+				continue
+			}
+			s.to = arg
+			c.PrintfLine("250 OK")
+		case "DATA":
+			c.PrintfLine("354 Go ahead")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.data = string(data)
+			c.PrintfLine("250 Queued")
+		case "QUIT":
+			c.PrintfLine("221 Bye")
+			return
+		default:
+			c.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	server, address := newSMTPServer(t, "")
+	s := &SMTP{Address: address, From: "cleaner@example.com", To: []string{"ops@example.com"}}
+
+	err := s.Notify(context.Background(), Notification{Subject: "NamespaceCleaner ci run ci-1 Failed", Message: "line 1\nline 2"})
+	if err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+	<-server.done
+
+	if server.from != "FROM:<cleaner@example.com>" || server.to != "TO:<ops@example.com>" {
+		t.Errorf("envelope = %q %q, want the configured sender and recipient", server.from, server.to)
+	}
+	header, err := textproto.NewReader(bufio.NewReader(strings.NewReader(server.data))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("malformed message %q: %v", server.data, err)
+	}
+	for key, want := range map[string]string{
+		"From":         "cleaner@example.com",
+		"To":           "ops@example.com",
+		"Subject":      "NamespaceCleaner ci run ci-1 Failed",
+		"Content-Type": "text/plain; charset=utf-8",
+	} {
+		if got := header.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if _, body, _ := strings.Cut(server.data, "\n\n"); body != "line 1\nline 2\n" {
+		t.Errorf("body = %q, want the message", body)
+	}
+}
+
+func TestSMTPRejected(t *testing.T) {
+	tests := []struct {
+		reply         string
+		wantPermanent bool
+	}{
+		{reply: "550 No such user", wantPermanent: true},
+		{reply: "451 Try again later"},
+	}
+	for _, test := range tests {
+		t.Run(test.reply, func(t *testing.T) {
+			_, address := newSMTPServer(t, test.reply)
+			s := &SMTP{Address: address, From: "cleaner@example.com", To: []string{"ops@example.com"}}
+
+			err := s.Notify(context.Background(), Notification{Subject: "subject", Message: "message"})
+			if err == nil {
+				t.Fatal("Notify() = nil, want an error")
+			}
+			var permanent *permanentError
+			if got := errors.As(err, &permanent); got != test.wantPermanent {
+				t.Errorf("Notify() = %v, permanent %v, want %v", err, got, test.wantPermanent)
+			}
+		})
+	}
+}
+
+func TestSMTPInvalidAddress(t *testing.T) {
+	s := &SMTP{Address: "mail.example.com", From: "cleaner@example.com", To: []string{"ops@example.com"}}
+	err := s.Notify(context.Background(), Notification{})
+	var permanent *permanentError
+	if !errors.As(err, &permanent) {
+		t.Errorf("Notify() = %v, want a permanent error", err)
+	}
+}
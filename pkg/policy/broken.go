@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+// EvaluateBrokenPod decides whether pod has a container waiting for one of
+// the reasons of p, such as CrashLoopBackOff, and its containers have not
+// been ready for longer than p allows at now. A nil p never selects a pod.
+func EvaluateBrokenPod(p *v1alpha1.BrokenPodPolicy, pod *corev1.Pod, now time.Time) PodDecision {
+	if p == nil || pod.DeletionTimestamp != nil {
+		return PodDecision{}
+	}
+	// A finished pod is past crash looping, the pod policy handles it.
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return PodDecision{}
+	}
+
+	status, ok := brokenContainer(p, pod)
+	if !ok {
+		return PodDecision{}
+	}
+
+	broken := now.Sub(notReadySince(pod).Time)
+	if broken <= p.After.Duration {
+		return PodDecision{}
+	}
+
+	return PodDecision{
+		Delete: true,
+		Rule:   RuleBrokenPod,
+		Reason: fmt.Sprintf("container %s in %s with %d restarts, not ready for %s, longer than %s",
+			status.Name, status.State.Waiting.Reason, status.RestartCount, broken.Round(time.Second), p.After.Duration),
+	}
+}
+
+// brokenContainer returns the first container of pod waiting for one of the
+// reasons of p after restarting often enough.
+func brokenContainer(p *v1alpha1.BrokenPodPolicy, pod *corev1.Pod) (corev1.ContainerStatus, bool) {
+	reasons := p.GetReasons()
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.State.Waiting == nil || !slices.Contains(reasons, status.State.Waiting.Reason) {
+				continue
+			}
+			if status.RestartCount < p.MinRestarts {
+				continue
+			}
+			return status, true
+		}
+	}
+	return corev1.ContainerStatus{}, false
+}
+
+// notReadySince returns when the containers of pod were last ready, or when
+// it started if they never were.
+func notReadySince(pod *corev1.Pod) metav1.Time {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.ContainersReady && condition.Status != corev1.ConditionTrue &&
+			!condition.LastTransitionTime.IsZero() {
+			return condition.LastTransitionTime
+		}
+	}
+	if pod.Status.StartTime != nil {
+		return *pod.Status.StartTime
+	}
+	return pod.CreationTimestamp
+}
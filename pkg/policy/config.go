@@ -0,0 +1,241 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+// rootCAConfigMap is published into every namespace by the control plane and
+// mounted by the projected service account token volumes.
+const rootCAConfigMap = "kube-root-ca.crt"
+
+// leaderAnnotation holds the lock of ConfigMap based leader election.
+const leaderAnnotation = "control-plane.alpha.kubernetes.io/leader"
+
+// helmReleaseSecretType is the type of the Secrets Helm stores releases in.
+const helmReleaseSecretType corev1.SecretType = "helm.sh/release.v1"
+
+// ConfigReferences are the names of the ConfigMaps and Secrets of a namespace
+// that its objects refer to.
+type ConfigReferences struct {
+	ConfigMaps sets.Set[string]
+	Secrets    sets.Set[string]
+}
+
+// NewConfigReferences returns an empty ConfigReferences.
+func NewConfigReferences() *ConfigReferences {
+	return &ConfigReferences{ConfigMaps: sets.New[string](), Secrets: sets.New[string]()}
+}
+
+// Referenced reports whether the object of kind with the given name is
+// referred to.
+func (r *ConfigReferences) Referenced(kind v1alpha1.ConfigKind, name string) bool {
+	if kind == v1alpha1.ConfigKindSecret {
+		return r.Secrets.Has(name)
+	}
+	return r.ConfigMaps.Has(name)
+}
+
+// AddPodSpec records the ConfigMaps and Secrets spec mounts, projects, reads
+// environment variables from or pulls images with.
+func (r *ConfigReferences) AddPodSpec(spec *corev1.PodSpec) {
+	for _, secret := range spec.ImagePullSecrets {
+		r.Secrets.Insert(secret.Name)
+	}
+	for i := range spec.Volumes {
+		r.addVolume(&spec.Volumes[i].VolumeSource)
+	}
+	for i := range spec.InitContainers {
+		r.addEnv(spec.InitContainers[i].Env, spec.InitContainers[i].EnvFrom)
+	}
+	for i := range spec.Containers {
+		r.addEnv(spec.Containers[i].Env, spec.Containers[i].EnvFrom)
+	}
+	for i := range spec.EphemeralContainers {
+		r.addEnv(spec.EphemeralContainers[i].Env, spec.EphemeralContainers[i].EnvFrom)
+	}
+}
+
+func (r *ConfigReferences) addVolume(v *corev1.VolumeSource) {
+	secretRef := func(ref *corev1.LocalObjectReference) {
+		if ref != nil {
+			r.Secrets.Insert(ref.Name)
+		}
+	}
+	switch {
+	case v.ConfigMap != nil:
+		r.ConfigMaps.Insert(v.ConfigMap.Name)
+	case v.Secret != nil:
+		r.Secrets.Insert(v.Secret.SecretName)
+	case v.Projected != nil:
+		for _, source := range v.Projected.Sources {
+			if source.ConfigMap != nil {
+				r.ConfigMaps.Insert(source.ConfigMap.Name)
+			}
+			if source.Secret != nil {
+				r.Secrets.Insert(source.Secret.Name)
+			}
+		}
+	case v.CSI != nil:
+		secretRef(v.CSI.NodePublishSecretRef)
+	case v.AzureFile != nil:
+		r.Secrets.Insert(v.AzureFile.SecretName)
+	case v.CephFS != nil:
+		secretRef(v.CephFS.SecretRef)
+	case v.Cinder != nil:
+		secretRef(v.Cinder.SecretRef)
+	case v.FlexVolume != nil:
+		secretRef(v.FlexVolume.SecretRef)
+	case v.ISCSI != nil:
+		secretRef(v.ISCSI.SecretRef)
+	case v.RBD != nil:
+		secretRef(v.RBD.SecretRef)
+	case v.ScaleIO != nil:
+		secretRef(v.ScaleIO.SecretRef)
+	case v.StorageOS != nil:
+		if v.StorageOS.SecretRef != nil {
+			r.Secrets.Insert(v.StorageOS.SecretRef.Name)
+		}
+	}
+}
+
+func (r *ConfigReferences) addEnv(env []corev1.EnvVar, envFrom []corev1.EnvFromSource) {
+	for _, e := range env {
+		if e.ValueFrom == nil {
+			continue
+		}
+		if e.ValueFrom.ConfigMapKeyRef != nil {
+			r.ConfigMaps.Insert(e.ValueFrom.ConfigMapKeyRef.Name)
+		}
+		if e.ValueFrom.SecretKeyRef != nil {
+			r.Secrets.Insert(e.ValueFrom.SecretKeyRef.Name)
+		}
+	}
+	for _, e := range envFrom {
+		if e.ConfigMapRef != nil {
+			r.ConfigMaps.Insert(e.ConfigMapRef.Name)
+		}
+		if e.SecretRef != nil {
+			r.Secrets.Insert(e.SecretRef.Name)
+		}
+	}
+}
+
+// AddServiceAccount records the Secrets sa lists, including its image pull
+// secrets.
+func (r *ConfigReferences) AddServiceAccount(sa *corev1.ServiceAccount) {
+	for _, secret := range sa.Secrets {
+		r.Secrets.Insert(secret.Name)
+	}
+	for _, secret := range sa.ImagePullSecrets {
+		r.Secrets.Insert(secret.Name)
+	}
+}
+
+// AddIngress records the TLS Secrets of ing.
+func (r *ConfigReferences) AddIngress(ing *networkingv1.Ingress) {
+	for _, tls := range ing.Spec.TLS {
+		if tls.SecretName != "" {
+			r.Secrets.Insert(tls.SecretName)
+		}
+	}
+}
+
+// ConfigAction is what a cleaner does about a ConfigMap or Secret.
+type ConfigAction int
+
+const (
+	// ConfigKeep leaves the object alone.
+	ConfigKeep ConfigAction = iota
+	// ConfigMark records that the object became unreferenced.
+	ConfigMark
+	// ConfigUnmark clears the mark of an object referred to again.
+	ConfigUnmark
+	// ConfigDelete deletes an object unreferenced for longer than the
+	// grace period.
+	ConfigDelete
+)
+
+// ConfigDecision explains what a cleaner does about a ConfigMap or Secret.
+type ConfigDecision struct {
+	Action ConfigAction
+	// Reason describes why the object is deleted.
+	Reason string
+}
+
+// EvaluateOrphanedConfig decides what a cleaner with policy p does at now
+// about obj of kind, of secretType for a Secret, given whether anything in
+// its namespace refers to it. Objects outside the selector of p are kept.
+func EvaluateOrphanedConfig(p *v1alpha1.OrphanedConfigPolicy, kind v1alpha1.ConfigKind, obj metav1.Object, secretType corev1.SecretType, referenced bool, now time.Time) ConfigDecision {
+	value, marked := obj.GetAnnotations()[v1alpha1.UnreferencedSinceAnnotation]
+	selected := p.Selector == nil || len(p.Selector.MatchLabels) == 0 || MatchesSelector(obj.GetLabels(), p.Selector.MatchLabels)
+	if referenced || !selected || ProtectedConfig(kind, obj, secretType) {
+		if marked {
+			return ConfigDecision{Action: ConfigUnmark}
+		}
+		return ConfigDecision{}
+	}
+
+	since, err := time.Parse(time.RFC3339, value)
+	if !marked || err != nil {
+		return ConfigDecision{Action: ConfigMark}
+	}
+	unreferenced := now.Sub(since)
+	if unreferenced <= p.GracePeriod.Duration {
+		return ConfigDecision{}
+	}
+	return ConfigDecision{
+		Action: ConfigDelete,
+		Reason: fmt.Sprintf("unreferenced for %s, longer than %s", unreferenced.Round(time.Second), p.GracePeriod.Duration),
+	}
+}
+
+// ProtectedConfig reports whether obj of kind, of secretType for a Secret, is
+// never garbage collected: it is managed by an owner, by the control plane or
+// by Helm, holds a leader election lock, or is annotated to be kept.
+func ProtectedConfig(kind v1alpha1.ConfigKind, obj metav1.Object, secretType corev1.SecretType) bool {
+	if obj.GetDeletionTimestamp() != nil || len(obj.GetOwnerReferences()) > 0 {
+		return true
+	}
+	annotations := obj.GetAnnotations()
+	if annotations[v1alpha1.KeepAnnotation] == "true" {
+		return true
+	}
+	if _, ok := annotations[leaderAnnotation]; ok {
+		return true
+	}
+	switch secretType {
+	case corev1.SecretTypeServiceAccountToken, corev1.SecretTypeBootstrapToken, helmReleaseSecretType:
+		return true
+	}
+	// Helm's ConfigMap and Secret storage drivers label release objects
+	// with their owner, Helm 2 in upper case.
+	labels := obj.GetLabels()
+	if labels["owner"] == "helm" || labels["OWNER"] == "TILLER" {
+		return true
+	}
+	return kind == v1alpha1.ConfigKindConfigMap && obj.GetName() == rootCAConfigMap
+}
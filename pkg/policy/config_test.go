@@ -0,0 +1,274 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+func TestConfigReferences(t *testing.T) {
+	configMapKey := func(name string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}}}
+	}
+	secretKey := func(name string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}}}
+	}
+
+	refs := NewConfigReferences()
+	refs.AddPodSpec(&corev1.PodSpec{
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+		Volumes: []corev1.Volume{{
+			VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "volume-cm"}}},
+		}, {
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "volume-secret"}},
+		}, {
+			VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{{
+				ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "projected-cm"}},
+			}, {
+				Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "projected-secret"}},
+			}}}},
+		}, {
+			VolumeSource: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{NodePublishSecretRef: &corev1.LocalObjectReference{Name: "csi-secret"}}},
+		}, {
+			// A volume without a Secret.
+			VolumeSource: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{}},
+		}},
+		InitContainers: []corev1.Container{{
+			Env: []corev1.EnvVar{{Name: "A", ValueFrom: configMapKey("init-env-cm")}},
+		}},
+		Containers: []corev1.Container{{
+			Env: []corev1.EnvVar{
+				{Name: "PLAIN", Value: "value"},
+				{Name: "B", ValueFrom: secretKey("env-secret")},
+			},
+			EnvFrom: []corev1.EnvFromSource{
+				{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "env-from-cm"}}},
+				{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "env-from-secret"}}},
+			},
+		}},
+		EphemeralContainers: []corev1.EphemeralContainer{{
+			EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+				Env: []corev1.EnvVar{{Name: "C", ValueFrom: secretKey("debug-secret")}},
+			},
+		}},
+	})
+	refs.AddServiceAccount(&corev1.ServiceAccount{
+		Secrets:          []corev1.ObjectReference{{Name: "sa-token"}},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "sa-registry"}},
+	})
+	refs.AddIngress(&networkingv1.Ingress{Spec: networkingv1.IngressSpec{TLS: []networkingv1.IngressTLS{
+		{SecretName: "tls"},
+		// TLS on the controller's default certificate.
+		{Hosts: []string{"example.com"}},
+	}}})
+
+	wantConfigMaps := []string{"env-from-cm", "init-env-cm", "projected-cm", "volume-cm"}
+	wantSecrets := []string{
+		"csi-secret", "debug-secret", "env-from-secret", "env-secret", "projected-secret",
+		"registry", "sa-registry", "sa-token", "tls", "volume-secret",
+	}
+	if got := sets.List(refs.ConfigMaps); !slices.Equal(got, wantConfigMaps) {
+		t.Errorf("ConfigMaps = %v, want %v", got, wantConfigMaps)
+	}
+	if got := sets.List(refs.Secrets); !slices.Equal(got, wantSecrets) {
+		t.Errorf("Secrets = %v, want %v", got, wantSecrets)
+	}
+
+	if !refs.Referenced(v1alpha1.ConfigKindConfigMap, "volume-cm") {
+		t.Error("Referenced(ConfigMap volume-cm) = false")
+	}
+	if refs.Referenced(v1alpha1.ConfigKindSecret, "volume-cm") {
+		t.Error("Referenced(Secret volume-cm) = true for a ConfigMap")
+	}
+	if !refs.Referenced(v1alpha1.ConfigKindSecret, "tls") {
+		t.Error("Referenced(Secret tls) = false")
+	}
+}
+
+func TestProtectedConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		kind       v1alpha1.ConfigKind
+		obj        metav1.ObjectMeta
+		secretType corev1.SecretType
+		want       bool
+	}{{
+		name: "configmap",
+		kind: v1alpha1.ConfigKindConfigMap,
+		obj:  metav1.ObjectMeta{Name: "settings"},
+	}, {
+		name:       "opaque secret",
+		kind:       v1alpha1.ConfigKindSecret,
+		obj:        metav1.ObjectMeta{Name: "password"},
+		secretType: corev1.SecretTypeOpaque,
+	}, {
+		name: "owned",
+		kind: v1alpha1.ConfigKindConfigMap,
+		obj:  metav1.ObjectMeta{Name: "settings", OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web"}}},
+		want: true,
+	}, {
+		name: "deleting",
+		kind: v1alpha1.ConfigKindConfigMap,
+		obj:  metav1.ObjectMeta{Name: "settings", DeletionTimestamp: &metav1.Time{}},
+		want: true,
+	}, {
+		name: "keep annotation",
+		kind: v1alpha1.ConfigKindConfigMap,
+		obj:  metav1.ObjectMeta{Name: "settings", Annotations: map[string]string{v1alpha1.KeepAnnotation: "true"}},
+		want: true,
+	}, {
+		name: "keep annotation false",
+		kind: v1alpha1.ConfigKindConfigMap,
+		obj:  metav1.ObjectMeta{Name: "settings", Annotations: map[string]string{v1alpha1.KeepAnnotation: "false"}},
+	}, {
+		name: "leader election lock",
+		kind: v1alpha1.ConfigKindConfigMap,
+		obj:  metav1.ObjectMeta{Name: "lock", Annotations: map[string]string{leaderAnnotation: "{}"}},
+		want: true,
+	}, {
+		name:       "service account token",
+		kind:       v1alpha1.ConfigKindSecret,
+		obj:        metav1.ObjectMeta{Name: "default-token"},
+		secretType: corev1.SecretTypeServiceAccountToken,
+		want:       true,
+	}, {
+		name:       "bootstrap token",
+		kind:       v1alpha1.ConfigKindSecret,
+		obj:        metav1.ObjectMeta{Name: "bootstrap-token-abcdef"},
+		secretType: corev1.SecretTypeBootstrapToken,
+		want:       true,
+	}, {
+		name:       "helm release secret",
+		kind:       v1alpha1.ConfigKindSecret,
+		obj:        metav1.ObjectMeta{Name: "sh.helm.release.v1.web.v1"},
+		secretType: helmReleaseSecretType,
+		want:       true,
+	}, {
+		name: "helm release configmap",
+		kind: v1alpha1.ConfigKindConfigMap,
+		obj:  metav1.ObjectMeta{Name: "sh.helm.release.v1.web.v1", Labels: map[string]string{"owner": "helm"}},
+		want: true,
+	}, {
+		name: "tiller release configmap",
+		kind: v1alpha1.ConfigKindConfigMap,
+		obj:  metav1.ObjectMeta{Name: "web.v1", Labels: map[string]string{"OWNER": "TILLER"}},
+		want: true,
+	}, {
+		name: "root ca",
+		kind: v1alpha1.ConfigKindConfigMap,
+		obj:  metav1.ObjectMeta{Name: rootCAConfigMap},
+		want: true,
+	}, {
+		name:       "secret named like the root ca",
+		kind:       v1alpha1.ConfigKindSecret,
+		obj:        metav1.ObjectMeta{Name: rootCAConfigMap},
+		secretType: corev1.SecretTypeOpaque,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ProtectedConfig(test.kind, &test.obj, test.secretType); got != test.want {
+				t.Errorf("ProtectedConfig() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateOrphanedConfig(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	p := &v1alpha1.OrphanedConfigPolicy{GracePeriod: metav1.Duration{Duration: 24 * time.Hour}}
+	marked := func(d time.Duration) map[string]string {
+		return map[string]string{v1alpha1.UnreferencedSinceAnnotation: now.Add(-d).Format(time.RFC3339)}
+	}
+
+	tests := []struct {
+		name       string
+		p          *v1alpha1.OrphanedConfigPolicy
+		obj        metav1.ObjectMeta
+		referenced bool
+		want       ConfigAction
+	}{{
+		name:       "referenced",
+		p:          p,
+		referenced: true,
+	}, {
+		name:       "referenced again",
+		p:          p,
+		obj:        metav1.ObjectMeta{Annotations: marked(time.Hour)},
+		referenced: true,
+		want:       ConfigUnmark,
+	}, {
+		name: "unreferenced",
+		p:    p,
+		want: ConfigMark,
+	}, {
+		name: "unparsable mark",
+		p:    p,
+		obj:  metav1.ObjectMeta{Annotations: map[string]string{v1alpha1.UnreferencedSinceAnnotation: "yesterday"}},
+		want: ConfigMark,
+	}, {
+		name: "within the grace period",
+		p:    p,
+		obj:  metav1.ObjectMeta{Annotations: marked(24 * time.Hour)},
+	}, {
+		name: "past the grace period",
+		p:    p,
+		obj:  metav1.ObjectMeta{Annotations: marked(25 * time.Hour)},
+		want: ConfigDelete,
+	}, {
+		name: "protected",
+		p:    p,
+		obj:  metav1.ObjectMeta{Annotations: marked(25 * time.Hour), OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web"}}},
+		want: ConfigUnmark,
+	}, {
+		name: "outside the selector",
+		p: &v1alpha1.OrphanedConfigPolicy{
+			GracePeriod: p.GracePeriod,
+			Selector:    &metav1.LabelSelector{MatchLabels: map[string]string{"gc": "true"}},
+		},
+		obj: metav1.ObjectMeta{Labels: map[string]string{"gc": "false"}},
+	}, {
+		name: "within the selector",
+		p: &v1alpha1.OrphanedConfigPolicy{
+			GracePeriod: p.GracePeriod,
+			Selector:    &metav1.LabelSelector{MatchLabels: map[string]string{"gc": "true"}},
+		},
+		obj:  metav1.ObjectMeta{Labels: map[string]string{"gc": "true"}, Annotations: marked(25 * time.Hour)},
+		want: ConfigDelete,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := EvaluateOrphanedConfig(test.p, v1alpha1.ConfigKindConfigMap, &test.obj, "", test.referenced, now)
+			if got.Action != test.want {
+				t.Errorf("EvaluateOrphanedConfig() = %+v, want action %v", got, test.want)
+			}
+			if (got.Reason != "") != (test.want == ConfigDelete) {
+				t.Errorf("EvaluateOrphanedConfig() reason = %q", got.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+const (
+	// evictionBackoffBase is the wait after the first refused eviction; it
+	// doubles with every further refusal up to evictionBackoffMax.
+	evictionBackoffBase = time.Minute
+	evictionBackoffMax  = time.Hour
+
+	// maxBlockedPods bounds the blocked pods remembered in status.
+	maxBlockedPods = 100
+)
+
+// Remove removes pod as policy p says, deleting or evicting it with the
+// options from DeleteOptions. An eviction refused by a PodDisruptionBudget
+// returns a TooManyRequests error.
+func Remove(ctx context.Context, client kubernetes.Interface, p *v1alpha1.PodPolicy, pod *corev1.Pod) error {
+	opts := DeleteOptions(p, pod)
+	if p.Action != v1alpha1.PodActionEvict {
+		return client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, opts)
+	}
+	return client.PolicyV1().Evictions(pod.Namespace).Evict(ctx, &policyv1.Eviction{
+		ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		DeleteOptions: &opts,
+	})
+}
+
+// BlockedByBudget reports whether err, returned by Remove, is an eviction
+// refused by a PodDisruptionBudget. A TooManyRequests error deleting a pod is
+// API server throttling instead.
+func BlockedByBudget(p *v1alpha1.PodPolicy, err error) bool {
+	return p.Action == v1alpha1.PodActionEvict && apierrs.IsTooManyRequests(err)
+}
+
+// EvictionBackoff spaces out the evictions of pods protected by a
+// PodDisruptionBudget across runs. It starts from the blocked pods recorded
+// by the previous run and collects those of the current one. It is safe for
+// concurrent use.
+type EvictionBackoff struct {
+	mu       sync.Mutex
+	previous map[types.UID]v1alpha1.BlockedPod
+	current  map[types.UID]v1alpha1.BlockedPod
+}
+
+// NewEvictionBackoff resumes the backoff of the given blocked pods.
+func NewEvictionBackoff(blocked []v1alpha1.BlockedPod) *EvictionBackoff {
+	b := &EvictionBackoff{
+		previous: make(map[types.UID]v1alpha1.BlockedPod, len(blocked)),
+		current:  make(map[types.UID]v1alpha1.BlockedPod),
+	}
+	for _, pod := range blocked {
+		b.previous[pod.UID] = pod
+	}
+	return b
+}
+
+// Deferred reports whether the eviction of pod must wait for its backoff,
+// in which case the pod stays blocked.
+func (b *EvictionBackoff) Deferred(pod *corev1.Pod, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	blocked, ok := b.previous[pod.UID]
+	if !ok || !now.Before(blocked.NextAttemptTime.Time) {
+		return false
+	}
+	b.current[pod.UID] = blocked
+	return true
+}
+
+// Blocked records that the eviction of pod was refused at now with err.
+func (b *EvictionBackoff) Blocked(pod *corev1.Pod, now time.Time, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	attempts := b.previous[pod.UID].Attempts + 1
+	wait := evictionBackoffMax
+	if shift := attempts - 1; shift < 6 {
+		wait = min(evictionBackoffBase<<shift, evictionBackoffMax)
+	}
+	b.current[pod.UID] = v1alpha1.BlockedPod{
+		Namespace:       pod.Namespace,
+		Name:            pod.Name,
+		UID:             pod.UID,
+		Attempts:        attempts,
+		LastAttemptTime: metav1.Time{Time: now},
+		NextAttemptTime: metav1.Time{Time: now.Add(wait)},
+		Message:         err.Error(),
+	}
+}
+
+// Result returns the pods still blocked after the run, oldest refusal
+// first. Pods that were not seen again are dropped, unless the run was
+// interrupted before it could see them.
+func (b *EvictionBackoff) Result(interrupted bool) []v1alpha1.BlockedPod {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pods := make([]v1alpha1.BlockedPod, 0, len(b.current))
+	for _, pod := range b.current {
+		pods = append(pods, pod)
+	}
+	if interrupted {
+		for uid, pod := range b.previous {
+			if _, ok := b.current[uid]; !ok {
+				pods = append(pods, pod)
+			}
+		}
+	}
+	if len(pods) == 0 {
+		return nil
+	}
+
+	sort.Slice(pods, func(i, j int) bool {
+		if !pods[i].LastAttemptTime.Equal(&pods[j].LastAttemptTime) {
+			return pods[i].LastAttemptTime.Before(&pods[j].LastAttemptTime)
+		}
+		return pods[i].UID < pods[j].UID
+	})
+	return pods[:min(len(pods), maxBlockedPods)]
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+func blockedPod(name string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: name, UID: types.UID(name + "-uid")}}
+}
+
+var errBudget = apierrs.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+
+func TestEvictionBackoff(t *testing.T) {
+	pod := blockedPod("db-0")
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	// Every run the pod is due again, its eviction is refused once more.
+	var blocked []v1alpha1.BlockedPod
+	for i, want := range []time.Duration{
+		time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 16 * time.Minute,
+		32 * time.Minute, time.Hour, time.Hour, time.Hour,
+	} {
+		b := NewEvictionBackoff(blocked)
+		if b.Deferred(pod, now) {
+			t.Fatalf("attempt %d: Deferred() = true once the backoff elapsed", i+1)
+		}
+		b.Blocked(pod, now, errBudget)
+		blocked = b.Result(false)
+
+		if len(blocked) != 1 {
+			t.Fatalf("attempt %d: Result() = %v, want the pod", i+1, blocked)
+		}
+		got := blocked[0]
+		if got.Attempts != int32(i+1) {
+			t.Errorf("attempt %d: attempts = %d", i+1, got.Attempts)
+		}
+		if wait := got.NextAttemptTime.Sub(got.LastAttemptTime.Time); wait != want {
+			t.Errorf("attempt %d: waits %s, want %s", i+1, wait, want)
+		}
+		if got.Message != errBudget.Error() || got.Name != "db-0" || got.Namespace != "ci" {
+			t.Errorf("attempt %d: blocked pod = %+v", i+1, got)
+		}
+		now = got.NextAttemptTime.Time
+	}
+}
+
+func TestEvictionBackoffDeferred(t *testing.T) {
+	pod := blockedPod("db-0")
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	previous := []v1alpha1.BlockedPod{{
+		Namespace:       "ci",
+		Name:            "db-0",
+		UID:             pod.UID,
+		Attempts:        3,
+		LastAttemptTime: metav1.Time{Time: now.Add(-time.Minute)},
+		NextAttemptTime: metav1.Time{Time: now.Add(3 * time.Minute)},
+	}}
+
+	b := NewEvictionBackoff(previous)
+	if !b.Deferred(pod, now) {
+		t.Fatal("Deferred() = false before the next attempt time")
+	}
+	if b.Deferred(blockedPod("web-0"), now) {
+		t.Error("Deferred() = true for a pod that was never blocked")
+	}
+	// A deferred pod stays blocked as it was.
+	if got := b.Result(false); len(got) != 1 || got[0] != previous[0] {
+		t.Errorf("Result() = %+v, want %+v", got, previous)
+	}
+}
+
+func TestEvictionBackoffResult(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	gone := v1alpha1.BlockedPod{
+		Name:            "gone",
+		UID:             "gone-uid",
+		Attempts:        1,
+		LastAttemptTime: metav1.Time{Time: now.Add(-time.Hour)},
+		NextAttemptTime: metav1.Time{Time: now.Add(-59 * time.Minute)},
+	}
+
+	t.Run("not seen again", func(t *testing.T) {
+		b := NewEvictionBackoff([]v1alpha1.BlockedPod{gone})
+		if got := b.Result(false); got != nil {
+			t.Errorf("Result() = %+v, want pods not seen again dropped", got)
+		}
+	})
+
+	t.Run("interrupted", func(t *testing.T) {
+		b := NewEvictionBackoff([]v1alpha1.BlockedPod{gone})
+		b.Blocked(blockedPod("db-0"), now, errBudget)
+		got := b.Result(true)
+		if len(got) != 2 || got[0] != gone || got[1].Name != "db-0" {
+			t.Errorf("Result() = %+v, want the pods not seen kept, oldest refusal first", got)
+		}
+	})
+
+	t.Run("capped", func(t *testing.T) {
+		b := NewEvictionBackoff(nil)
+		for i := range maxBlockedPods + 5 {
+			// The pods are refused from the newest down to the oldest.
+			b.Blocked(blockedPod(fmt.Sprintf("pod-%03d", i)), now.Add(-time.Duration(i)*time.Second), errBudget)
+		}
+		got := b.Result(false)
+		if len(got) != maxBlockedPods {
+			t.Fatalf("Result() returned %d pods, want %d", len(got), maxBlockedPods)
+		}
+		if first, last := got[0].Name, got[len(got)-1].Name; first != "pod-104" || last != "pod-005" {
+			t.Errorf("Result() runs from %s to %s, want the oldest refusals from pod-104 to pod-005", first, last)
+		}
+	})
+}
+
+func TestBlockedByBudget(t *testing.T) {
+	evict := &v1alpha1.PodPolicy{Action: v1alpha1.PodActionEvict}
+	del := &v1alpha1.PodPolicy{}
+
+	tests := []struct {
+		name string
+		p    *v1alpha1.PodPolicy
+		err  error
+		want bool
+	}{{
+		name: "eviction refused",
+		p:    evict,
+		err:  errBudget,
+		want: true,
+	}, {
+		name: "eviction refused, wrapped",
+		p:    evict,
+		err:  fmt.Errorf("failed to evict pod: %w", errBudget),
+		want: true,
+	}, {
+		name: "delete throttled",
+		p:    del,
+		err:  errBudget,
+	}, {
+		name: "eviction succeeded",
+		p:    evict,
+	}, {
+		name: "eviction forbidden",
+		p:    evict,
+		err:  apierrs.NewForbidden(schema.GroupResource{Resource: "pods/eviction"}, "db-0", errors.New("denied")),
+	}, {
+		name: "eviction of a pod gone",
+		p:    evict,
+		err:  apierrs.NewNotFound(schema.GroupResource{Resource: "pods"}, "db-0"),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := BlockedByBudget(test.p, test.err); got != test.want {
+				t.Errorf("BlockedByBudget(%v) = %v, want %v", test.err, got, test.want)
+			}
+		})
+	}
+}
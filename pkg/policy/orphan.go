@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+// NodeLookup returns the node with the given name, or a NotFound error if it
+// does not exist.
+type NodeLookup func(name string) (*corev1.Node, error)
+
+// EvaluateOrphanedNode decides whether pod is bound to a node that no longer
+// exists, or that has not been Ready for longer than p allows at now. A nil
+// p never selects a pod. Only a NotFound error from nodes means the node is
+// gone; any other error is returned, and the pod left alone.
+func EvaluateOrphanedNode(p *v1alpha1.OrphanedNodePolicy, pod *corev1.Pod, nodes NodeLookup, now time.Time) (PodDecision, error) {
+	if p == nil || pod.Spec.NodeName == "" {
+		return PodDecision{}, nil
+	}
+	// Only a force delete helps a pod that is already being deleted.
+	if pod.DeletionTimestamp != nil && !p.Force {
+		return PodDecision{}, nil
+	}
+
+	node, err := nodes(pod.Spec.NodeName)
+	if apierrs.IsNotFound(err) {
+		return PodDecision{
+			Delete: true,
+			Rule:   RuleOrphanedNode,
+			Reason: fmt.Sprintf("node %s no longer exists", pod.Spec.NodeName),
+		}, nil
+	} else if err != nil {
+		return PodDecision{}, fmt.Errorf("failed to get node %s: %w", pod.Spec.NodeName, err)
+	}
+
+	if p.NotReadyAfter == nil {
+		return PodDecision{}, nil
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type != corev1.NodeReady || condition.Status == corev1.ConditionTrue {
+			continue
+		}
+		notReady := now.Sub(condition.LastTransitionTime.Time)
+		if notReady <= p.NotReadyAfter.Duration {
+			return PodDecision{}, nil
+		}
+		return PodDecision{
+			Delete: true,
+			Rule:   RuleOrphanedNode,
+			Reason: fmt.Sprintf("node %s not Ready for %s, longer than %s",
+				node.Name, notReady.Round(time.Second), p.NotReadyAfter.Duration),
+		}, nil
+	}
+	return PodDecision{}, nil
+}
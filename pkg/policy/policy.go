@@ -0,0 +1,363 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package policy decides which namespaces and pods a NamespaceCleaner acts
+// on. It is shared by the reconciler and the kubectl plugin, so previews
+// match what the controller would actually do.
+package policy
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+const (
+	// ExtendedUntilAnnotation on a namespace holds an RFC3339 timestamp
+	// before which no cleaner touches the namespace.
+	ExtendedUntilAnnotation = "clusterops.io/extended-until"
+
+	// systemNamespacePrefix marks namespaces that are never cleaned.
+	systemNamespacePrefix = "kube-"
+)
+
+// FinishedPhases are the pod phases eligible for cleanup.
+var FinishedPhases = []corev1.PodPhase{corev1.PodSucceeded, corev1.PodFailed}
+
+// NamespaceDecision explains whether a cleaner acts on a namespace.
+type NamespaceDecision struct {
+	Matches bool
+	// Reason is set when a namespace matching the selector is skipped.
+	Reason string
+	// Owner is the cleaner that owns the namespace, set when it is selected.
+	Owner string
+	// Overlapping are the other cleaners that also select the namespace.
+	Overlapping []string
+}
+
+// EvaluateNamespace decides whether nc cleans ns at now. The namespace is
+// owned by a single cleaner among nc and cleaners, see Precedes, and every
+// other cleaner selecting it skips it.
+func EvaluateNamespace(nc *v1alpha1.NamespaceCleaner, cleaners []*v1alpha1.NamespaceCleaner, ns *corev1.Namespace, now time.Time) NamespaceDecision {
+	if !Selects(nc, ns) {
+		return NamespaceDecision{}
+	}
+
+	// nc may be newer than its copy in cleaners, so compare against itself
+	// rather than looking itself up.
+	owner := nc
+	var overlapping []string
+	for _, other := range cleaners {
+		if other.Name == nc.Name || !Selects(other, ns) {
+			continue
+		}
+		overlapping = append(overlapping, other.Name)
+		if Precedes(other, owner) {
+			owner = other
+		}
+	}
+	decision := NamespaceDecision{Owner: owner.Name, Overlapping: overlapping}
+
+	if owner != nc {
+		decision.Reason = "owned by NamespaceCleaner " + owner.Name
+		return decision
+	}
+
+	if until, ok := ExtendedUntil(ns); ok && now.Before(until) {
+		decision.Reason = "extended until " + until.Format(time.RFC3339)
+		return decision
+	}
+
+	decision.Matches = true
+	return decision
+}
+
+// Selects reports whether the selector of nc picks ns, regardless of which
+// cleaner owns it. System namespaces (kube-* prefixed) are never selected,
+// and neither is anything by a cleaner without matchLabels.
+func Selects(nc *v1alpha1.NamespaceCleaner, ns *corev1.Namespace) bool {
+	if strings.HasPrefix(ns.Name, systemNamespacePrefix) {
+		return false
+	}
+	if len(nc.Spec.Selector.MatchLabels) == 0 {
+		return false
+	}
+	return MatchesSelector(ns.Labels, nc.Spec.Selector.MatchLabels)
+}
+
+// Precedes reports whether a takes precedence over b on a namespace both
+// select: a cleaner that is not suspended wins over a suspended one, then
+// the highest spec.priority, then the most specific selector, i.e. the one
+// with the most matchLabels, then the name that sorts first.
+func Precedes(a, b *v1alpha1.NamespaceCleaner) bool {
+	if a.Spec.Suspend != b.Spec.Suspend {
+		return !a.Spec.Suspend
+	}
+	if a.Spec.Priority != b.Spec.Priority {
+		return a.Spec.Priority > b.Spec.Priority
+	}
+	if la, lb := len(a.Spec.Selector.MatchLabels), len(b.Spec.Selector.MatchLabels); la != lb {
+		return la > lb
+	}
+	return a.Name < b.Name
+}
+
+// ExtendedUntil returns the time until which ns is protected from cleanup,
+// if it carries a valid extended-until annotation.
+func ExtendedUntil(ns *corev1.Namespace) (time.Time, bool) {
+	value, ok := ns.Annotations[ExtendedUntilAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// MatchesSelector reports whether labels contain all of selectorLabels.
+func MatchesSelector(labels map[string]string, selectorLabels map[string]string) bool {
+	if labels == nil {
+		return false
+	}
+
+	for key, value := range selectorLabels {
+		if labels[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Rules a NamespaceCleaner acts on pods by.
+const (
+	// RuleFinished deletes finished pods as the pod policy says.
+	RuleFinished = "Finished"
+	// RuleStuckTerminating force deletes pods stuck in Terminating.
+	RuleStuckTerminating = "StuckTerminating"
+	// RuleOrphanedNode deletes pods bound to missing or NotReady nodes.
+	RuleOrphanedNode = "OrphanedNode"
+	// RuleUnschedulable deletes pods that stay Pending and unschedulable.
+	RuleUnschedulable = "Unschedulable"
+	// RuleBrokenPod acts on pods that crash loop or fail to pull their image.
+	RuleBrokenPod = "BrokenPod"
+)
+
+// Rules a NamespaceCleaner deletes other objects than pods by.
+const (
+	// RuleOrphanedConfig deletes ConfigMaps and Secrets nothing refers to.
+	RuleOrphanedConfig = "OrphanedConfig"
+	// RuleUnusedVolume deletes PersistentVolumeClaims no pod mounts.
+	RuleUnusedVolume = "UnusedVolume"
+	// RuleOldReplicaSet deletes ReplicaSets of old Deployment revisions.
+	RuleOldReplicaSet = "OldReplicaSet"
+)
+
+// PodDecision explains whether a cleaner deletes a pod.
+type PodDecision struct {
+	// Delete is set when a rule selects the pod; what a RuleBrokenPod
+	// decision does about it depends on spec.brokenPods.action.
+	Delete bool
+	// Rule is the rule selecting the pod.
+	Rule string
+	// Reason describes why the pod is deleted.
+	Reason string
+}
+
+// EvaluateCleanerPod applies every rule of nc to pod at now, returning the
+// decision of the first rule selecting it. It fails when the node of the pod
+// cannot be looked up.
+func EvaluateCleanerPod(nc *v1alpha1.NamespaceCleaner, pod *corev1.Pod, nodes NodeLookup, now time.Time) (PodDecision, error) {
+	if decision := EvaluateStuckTerminating(nc.Spec.StuckTerminating, pod, now); decision.Delete {
+		return decision, nil
+	}
+	if decision, err := EvaluateOrphanedNode(nc.Spec.OrphanedNode, pod, nodes, now); err != nil || decision.Delete {
+		return decision, err
+	}
+	if decision := EvaluateUnschedulable(nc.Spec.Unschedulable, pod, now); decision.Delete {
+		return decision, nil
+	}
+	if decision := EvaluateBrokenPod(nc.Spec.BrokenPods, pod, now); decision.Delete {
+		return decision, nil
+	}
+	return EvaluatePod(&nc.Spec.PodPolicy, pod, now), nil
+}
+
+// PodFieldSelectors returns the field selectors to list the pods nc may act
+// on with. Usually only completed pods (Succeeded or Failed), and Pending
+// ones for spec.unschedulable, are candidates, so the API server filters on
+// the phase instead of returning every pod.
+func PodFieldSelectors(nc *v1alpha1.NamespaceCleaner) []string {
+	if nc.Spec.StuckTerminating != nil || nc.Spec.OrphanedNode != nil || nc.Spec.BrokenPods != nil {
+		return []string{""}
+	}
+	phases := FinishedPhases
+	if nc.Spec.Unschedulable != nil {
+		phases = append([]corev1.PodPhase{corev1.PodPending}, phases...)
+	}
+	selectors := make([]string, 0, len(phases))
+	for _, phase := range phases {
+		selectors = append(selectors, fields.OneTermEqualSelector("status.phase", string(phase)).String())
+	}
+	return selectors
+}
+
+// EvaluatePod decides whether a cleaner with policy p deletes pod at now.
+func EvaluatePod(p *v1alpha1.PodPolicy, pod *corev1.Pod, now time.Time) PodDecision {
+	// Only delete completed pods (Succeeded or Failed)
+	if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+		return PodDecision{}
+	}
+
+	// Pods already being deleted are left to finish.
+	if pod.DeletionTimestamp != nil {
+		return PodDecision{}
+	}
+
+	ttl := p.GetTTL()
+	reason := fmt.Sprintf("%s pod", pod.Status.Phase)
+	if len(p.PodFilters) > 0 {
+		i := matchingFilter(p.PodFilters, pod)
+		if i < 0 {
+			return PodDecision{}
+		}
+		filter := &p.PodFilters[i]
+		if filter.TTL != nil && filter.TTL.Duration > 0 {
+			ttl = filter.TTL.Duration
+		}
+		name := filter.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		reason = fmt.Sprintf("%s pod matching filter %s", pod.Status.Phase, name)
+	}
+
+	if !pod.CreationTimestamp.Time.Before(now.Add(-ttl)) {
+		return PodDecision{}
+	}
+
+	return PodDecision{
+		Delete: true,
+		Rule:   RuleFinished,
+		Reason: fmt.Sprintf("%s older than %s", reason, ttl),
+	}
+}
+
+// matchingFilter returns the index of the first filter matching pod, or -1.
+func matchingFilter(filters []v1alpha1.PodFilter, pod *corev1.Pod) int {
+	for i := range filters {
+		if matchesFilter(&filters[i], pod) {
+			return i
+		}
+	}
+	return -1
+}
+
+func matchesFilter(f *v1alpha1.PodFilter, pod *corev1.Pod) bool {
+	if len(f.Reasons) > 0 && !slices.Contains(f.Reasons, pod.Status.Reason) {
+		return false
+	}
+	if len(f.QOSClasses) > 0 && !slices.Contains(f.QOSClasses, pod.Status.QOSClass) {
+		return false
+	}
+	if len(f.PriorityClassNames) > 0 && !slices.Contains(f.PriorityClassNames, pod.Spec.PriorityClassName) {
+		return false
+	}
+	if len(f.NodeNames) > 0 && !slices.Contains(f.NodeNames, pod.Spec.NodeName) {
+		return false
+	}
+	if len(f.TerminationReasons) == 0 && len(f.ExitCodes) == 0 {
+		return true
+	}
+
+	// The container conditions must hold for the same container.
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			terminated := status.State.Terminated
+			if terminated == nil {
+				continue
+			}
+			if len(f.TerminationReasons) > 0 && !slices.Contains(f.TerminationReasons, terminated.Reason) {
+				continue
+			}
+			if len(f.ExitCodes) > 0 && !slices.Contains(f.ExitCodes, terminated.ExitCode) {
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteOptions returns the options to delete pod with under policy p. The
+// UID and resourceVersion preconditions make the delete fail with a Conflict
+// if the pod was recreated or changed since it was evaluated.
+func DeleteOptions(p *v1alpha1.PodPolicy, pod *corev1.Pod) metav1.DeleteOptions {
+	opts := metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{
+			UID:             &pod.UID,
+			ResourceVersion: &pod.ResourceVersion,
+		},
+	}
+	if p.DeleteOptions != nil {
+		opts.GracePeriodSeconds = p.DeleteOptions.GracePeriodSeconds
+		opts.PropagationPolicy = p.DeleteOptions.PropagationPolicy
+	}
+	return opts
+}
+
+// TenantMinTTL returns the shortest ttl a PodCleaner in ns may use: the
+// strictest minTTL among the cleaners selecting ns, along with the name of
+// the cleaner setting it. It returns zero if no cleaner limits ns.
+func TenantMinTTL(cleaners []*v1alpha1.NamespaceCleaner, ns *corev1.Namespace) (time.Duration, string) {
+	var minTTL time.Duration
+	var by string
+	for _, nc := range cleaners {
+		if !Selects(nc, ns) || nc.Spec.TenantLimits == nil || nc.Spec.TenantLimits.MinTTL == nil {
+			continue
+		}
+		if ttl := nc.Spec.TenantLimits.MinTTL.Duration; ttl > minTTL || (ttl == minTTL && by != "" && nc.Name < by) {
+			minTTL, by = ttl, nc.Name
+		}
+	}
+	return minTTL, by
+}
+
+// RaiseTTL raises the ttl of p, and of each of its filters, to at least
+// minTTL. It reports whether any was raised.
+func RaiseTTL(p *v1alpha1.PodPolicy, minTTL time.Duration) bool {
+	raised := false
+	if p.GetTTL() < minTTL {
+		p.TTL = &metav1.Duration{Duration: minTTL}
+		raised = true
+	}
+	for i := range p.PodFilters {
+		if ttl := p.PodFilters[i].TTL; ttl != nil && ttl.Duration > 0 && ttl.Duration < minTTL {
+			p.PodFilters[i].TTL = &metav1.Duration{Duration: minTTL}
+			raised = true
+		}
+	}
+	return raised
+}
@@ -0,0 +1,723 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+// cleaner returns a NamespaceCleaner called name selecting matchLabels.
+func cleaner(name string, matchLabels map[string]string) *v1alpha1.NamespaceCleaner {
+	return &v1alpha1.NamespaceCleaner{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1alpha1.NamespaceCleanerSpec{
+			Selector: metav1.LabelSelector{MatchLabels: matchLabels},
+		},
+	}
+}
+
+func suspended(nc *v1alpha1.NamespaceCleaner) *v1alpha1.NamespaceCleaner {
+	nc.Spec.Suspend = true
+	return nc
+}
+
+func withPriority(nc *v1alpha1.NamespaceCleaner, priority int32) *v1alpha1.NamespaceCleaner {
+	nc.Spec.Priority = priority
+	return nc
+}
+
+func TestPrecedes(t *testing.T) {
+	one := map[string]string{"env": "ci"}
+	two := map[string]string{"env": "ci", "team": "a"}
+
+	tests := []struct {
+		name string
+		a, b *v1alpha1.NamespaceCleaner
+		want bool
+	}{{
+		name: "active over suspended",
+		a:    cleaner("z", one),
+		b:    suspended(withPriority(cleaner("a", two), 10)),
+		want: true,
+	}, {
+		name: "suspended under active",
+		a:    suspended(withPriority(cleaner("a", two), 10)),
+		b:    cleaner("z", one),
+		want: false,
+	}, {
+		name: "higher priority over more labels",
+		a:    withPriority(cleaner("z", one), 1),
+		b:    cleaner("a", two),
+		want: true,
+	}, {
+		name: "lower priority",
+		a:    cleaner("a", two),
+		b:    withPriority(cleaner("z", one), 1),
+		want: false,
+	}, {
+		name: "priority among suspended cleaners",
+		a:    suspended(withPriority(cleaner("z", one), 1)),
+		b:    suspended(cleaner("a", two)),
+		want: true,
+	}, {
+		name: "more labels over name",
+		a:    cleaner("z", two),
+		b:    cleaner("a", one),
+		want: true,
+	}, {
+		name: "fewer labels",
+		a:    cleaner("a", one),
+		b:    cleaner("z", two),
+		want: false,
+	}, {
+		name: "name sorting first",
+		a:    cleaner("a", one),
+		b:    cleaner("b", one),
+		want: true,
+	}, {
+		name: "name sorting last",
+		a:    cleaner("b", one),
+		b:    cleaner("a", one),
+		want: false,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Precedes(test.a, test.b); got != test.want {
+				t.Errorf("Precedes(%s, %s) = %v, want %v", test.a.Name, test.b.Name, got, test.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateNamespace(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	ci := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "ci-1",
+		Labels: map[string]string{"env": "ci", "team": "a"},
+	}}
+
+	tests := []struct {
+		name     string
+		nc       *v1alpha1.NamespaceCleaner
+		cleaners []*v1alpha1.NamespaceCleaner
+		ns       *corev1.Namespace
+		want     NamespaceDecision
+	}{{
+		name: "sole cleaner",
+		nc:   cleaner("ci", map[string]string{"env": "ci"}),
+		ns:   ci,
+		want: NamespaceDecision{Matches: true, Owner: "ci"},
+	}, {
+		name: "not selected",
+		nc:   cleaner("prod", map[string]string{"env": "prod"}),
+		ns:   ci,
+		want: NamespaceDecision{},
+	}, {
+		name: "no matchLabels",
+		nc:   cleaner("all", nil),
+		ns:   ci,
+		want: NamespaceDecision{},
+	}, {
+		name: "system namespace",
+		nc:   cleaner("ci", map[string]string{"env": "ci"}),
+		ns: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "kube-ci",
+			Labels: map[string]string{"env": "ci"},
+		}},
+		want: NamespaceDecision{},
+	}, {
+		name: "owned by a more specific cleaner",
+		nc:   cleaner("ci", map[string]string{"env": "ci"}),
+		cleaners: []*v1alpha1.NamespaceCleaner{
+			cleaner("ci", map[string]string{"env": "ci"}),
+			cleaner("team-a", map[string]string{"env": "ci", "team": "a"}),
+			cleaner("prod", map[string]string{"env": "prod"}),
+		},
+		ns: ci,
+		want: NamespaceDecision{
+			Owner:       "team-a",
+			Reason:      "owned by NamespaceCleaner team-a",
+			Overlapping: []string{"team-a"},
+		},
+	}, {
+		name: "owning over a suspended cleaner",
+		nc:   cleaner("ci", map[string]string{"env": "ci"}),
+		cleaners: []*v1alpha1.NamespaceCleaner{
+			suspended(withPriority(cleaner("team-a", map[string]string{"env": "ci", "team": "a"}), 10)),
+		},
+		ns:   ci,
+		want: NamespaceDecision{Matches: true, Owner: "ci", Overlapping: []string{"team-a"}},
+	}, {
+		// The cleaner being evaluated may be newer than its listed copy.
+		name: "compared as evaluated",
+		nc:   withPriority(cleaner("ci", map[string]string{"env": "ci"}), 5),
+		cleaners: []*v1alpha1.NamespaceCleaner{
+			cleaner("ci", map[string]string{"env": "ci"}),
+			withPriority(cleaner("team-a", map[string]string{"env": "ci", "team": "a"}), 1),
+		},
+		ns:   ci,
+		want: NamespaceDecision{Matches: true, Owner: "ci", Overlapping: []string{"team-a"}},
+	}, {
+		name: "extended",
+		nc:   cleaner("ci", map[string]string{"env": "ci"}),
+		ns: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "ci-1",
+			Labels:      map[string]string{"env": "ci"},
+			Annotations: map[string]string{ExtendedUntilAnnotation: "2026-10-02T00:00:00Z"},
+		}},
+		want: NamespaceDecision{Owner: "ci", Reason: "extended until 2026-10-02T00:00:00Z"},
+	}, {
+		name: "extension expired",
+		nc:   cleaner("ci", map[string]string{"env": "ci"}),
+		ns: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "ci-1",
+			Labels:      map[string]string{"env": "ci"},
+			Annotations: map[string]string{ExtendedUntilAnnotation: "2026-10-01T00:00:00Z"},
+		}},
+		want: NamespaceDecision{Matches: true, Owner: "ci"},
+	}, {
+		name: "invalid extension",
+		nc:   cleaner("ci", map[string]string{"env": "ci"}),
+		ns: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "ci-1",
+			Labels:      map[string]string{"env": "ci"},
+			Annotations: map[string]string{ExtendedUntilAnnotation: "tomorrow"},
+		}},
+		want: NamespaceDecision{Matches: true, Owner: "ci"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := EvaluateNamespace(test.nc, test.cleaners, test.ns, now)
+			if got.Matches != test.want.Matches || got.Owner != test.want.Owner || got.Reason != test.want.Reason ||
+				!slices.Equal(got.Overlapping, test.want.Overlapping) {
+				t.Errorf("EvaluateNamespace() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDeleteOptions(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "build-1", UID: "build-1-uid", ResourceVersion: "42"}}
+	background := metav1.DeletePropagationBackground
+
+	tests := []struct {
+		name        string
+		p           *v1alpha1.PodPolicy
+		gracePeriod *int64
+		propagation *metav1.DeletionPropagation
+	}{{
+		name: "defaults",
+		p:    &v1alpha1.PodPolicy{},
+	}, {
+		name: "grace period",
+		p: &v1alpha1.PodPolicy{DeleteOptions: &v1alpha1.DeleteOptions{
+			GracePeriodSeconds: ptr(int64(0)),
+		}},
+		gracePeriod: ptr(int64(0)),
+	}, {
+		name: "propagation",
+		p: &v1alpha1.PodPolicy{DeleteOptions: &v1alpha1.DeleteOptions{
+			GracePeriodSeconds: ptr(int64(30)),
+			PropagationPolicy:  &background,
+		}},
+		gracePeriod: ptr(int64(30)),
+		propagation: &background,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := DeleteOptions(test.p, pod)
+			if pre := got.Preconditions; pre == nil || pre.UID == nil || *pre.UID != pod.UID ||
+				pre.ResourceVersion == nil || *pre.ResourceVersion != pod.ResourceVersion {
+				t.Errorf("DeleteOptions() preconditions = %+v, want the UID and resourceVersion of the pod", pre)
+			}
+			if !equalPtr(got.GracePeriodSeconds, test.gracePeriod) {
+				t.Errorf("DeleteOptions() grace period = %v, want %v", got.GracePeriodSeconds, test.gracePeriod)
+			}
+			if !equalPtr(got.PropagationPolicy, test.propagation) {
+				t.Errorf("DeleteOptions() propagation = %v, want %v", got.PropagationPolicy, test.propagation)
+			}
+		})
+	}
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+func TestEvaluatePod(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	// pod returns a pod created age ago, finished in phase.
+	pod := func(phase corev1.PodPhase, age time.Duration, mutate ...func(*corev1.Pod)) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "build-1", CreationTimestamp: metav1.Time{Time: now.Add(-age)}},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+		for _, m := range mutate {
+			m(p)
+		}
+		return p
+	}
+	terminated := func(init bool, reason string, exitCode int32) func(*corev1.Pod) {
+		return func(p *corev1.Pod) {
+			status := corev1.ContainerStatus{State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				Reason:   reason,
+				ExitCode: exitCode,
+			}}}
+			if init {
+				p.Status.InitContainerStatuses = append(p.Status.InitContainerStatuses, status)
+			} else {
+				p.Status.ContainerStatuses = append(p.Status.ContainerStatuses, status)
+			}
+		}
+	}
+	hour := &metav1.Duration{Duration: time.Hour}
+	filters := func(filters ...v1alpha1.PodFilter) *v1alpha1.PodPolicy {
+		return &v1alpha1.PodPolicy{TTL: hour, PodFilters: filters}
+	}
+
+	tests := []struct {
+		name   string
+		p      *v1alpha1.PodPolicy
+		pod    *corev1.Pod
+		reason string
+	}{{
+		name:   "succeeded",
+		p:      &v1alpha1.PodPolicy{TTL: hour},
+		pod:    pod(corev1.PodSucceeded, 2*time.Hour),
+		reason: "Succeeded pod older than 1h0m0s",
+	}, {
+		name:   "failed",
+		p:      &v1alpha1.PodPolicy{TTL: hour},
+		pod:    pod(corev1.PodFailed, 2*time.Hour),
+		reason: "Failed pod older than 1h0m0s",
+	}, {
+		name: "ttl not reached",
+		p:    &v1alpha1.PodPolicy{TTL: hour},
+		pod:  pod(corev1.PodSucceeded, time.Hour),
+	}, {
+		name:   "default ttl",
+		p:      &v1alpha1.PodPolicy{},
+		pod:    pod(corev1.PodSucceeded, time.Minute),
+		reason: "Succeeded pod older than 30s",
+	}, {
+		name: "running",
+		p:    &v1alpha1.PodPolicy{TTL: hour},
+		pod:  pod(corev1.PodRunning, 2*time.Hour),
+	}, {
+		name: "pending",
+		p:    &v1alpha1.PodPolicy{TTL: hour},
+		pod:  pod(corev1.PodPending, 2*time.Hour),
+	}, {
+		name: "deleting",
+		p:    &v1alpha1.PodPolicy{TTL: hour},
+		pod: pod(corev1.PodSucceeded, 2*time.Hour, func(p *corev1.Pod) {
+			p.DeletionTimestamp = &metav1.Time{Time: now}
+		}),
+	}, {
+		name: "first match wins",
+		p: filters(
+			v1alpha1.PodFilter{Name: "evicted", Reasons: []string{"Evicted"}, TTL: &metav1.Duration{Duration: time.Minute}},
+			v1alpha1.PodFilter{Name: "failed", TTL: &metav1.Duration{Duration: 3 * time.Hour}},
+		),
+		pod: pod(corev1.PodFailed, 2*time.Hour, func(p *corev1.Pod) {
+			p.Status.Reason = "Evicted"
+		}),
+		reason: "Failed pod matching filter evicted older than 1m0s",
+	}, {
+		name: "later filter ttl",
+		p: filters(
+			v1alpha1.PodFilter{Name: "evicted", Reasons: []string{"Evicted"}, TTL: &metav1.Duration{Duration: time.Minute}},
+			v1alpha1.PodFilter{Name: "failed", TTL: &metav1.Duration{Duration: 3 * time.Hour}},
+		),
+		pod: pod(corev1.PodFailed, 2*time.Hour),
+	}, {
+		name:   "filter without a name or ttl",
+		p:      filters(v1alpha1.PodFilter{Reasons: []string{"NodeShutdown"}}),
+		pod:    pod(corev1.PodFailed, 2*time.Hour, func(p *corev1.Pod) { p.Status.Reason = "NodeShutdown" }),
+		reason: "Failed pod matching filter #0 older than 1h0m0s",
+	}, {
+		name: "no filter matches",
+		p:    filters(v1alpha1.PodFilter{Reasons: []string{"Evicted"}}),
+		pod:  pod(corev1.PodFailed, 2*time.Hour),
+	}, {
+		name:   "qos class",
+		p:      filters(v1alpha1.PodFilter{Name: "besteffort", QOSClasses: []corev1.PodQOSClass{corev1.PodQOSBestEffort}}),
+		pod:    pod(corev1.PodSucceeded, 2*time.Hour, func(p *corev1.Pod) { p.Status.QOSClass = corev1.PodQOSBestEffort }),
+		reason: "Succeeded pod matching filter besteffort older than 1h0m0s",
+	}, {
+		name: "other qos class",
+		p:    filters(v1alpha1.PodFilter{QOSClasses: []corev1.PodQOSClass{corev1.PodQOSBestEffort}}),
+		pod:  pod(corev1.PodSucceeded, 2*time.Hour, func(p *corev1.Pod) { p.Status.QOSClass = corev1.PodQOSGuaranteed }),
+	}, {
+		name:   "priority class",
+		p:      filters(v1alpha1.PodFilter{Name: "batch", PriorityClassNames: []string{"batch"}}),
+		pod:    pod(corev1.PodSucceeded, 2*time.Hour, func(p *corev1.Pod) { p.Spec.PriorityClassName = "batch" }),
+		reason: "Succeeded pod matching filter batch older than 1h0m0s",
+	}, {
+		name: "other priority class",
+		p:    filters(v1alpha1.PodFilter{PriorityClassNames: []string{"batch"}}),
+		pod:  pod(corev1.PodSucceeded, 2*time.Hour),
+	}, {
+		name:   "node",
+		p:      filters(v1alpha1.PodFilter{Name: "spot", NodeNames: []string{"spot-1", "spot-2"}}),
+		pod:    pod(corev1.PodFailed, 2*time.Hour, func(p *corev1.Pod) { p.Spec.NodeName = "spot-2" }),
+		reason: "Failed pod matching filter spot older than 1h0m0s",
+	}, {
+		name: "other node",
+		p:    filters(v1alpha1.PodFilter{NodeNames: []string{"spot-1"}}),
+		pod:  pod(corev1.PodFailed, 2*time.Hour, func(p *corev1.Pod) { p.Spec.NodeName = "on-demand-1" }),
+	}, {
+		name:   "termination reason",
+		p:      filters(v1alpha1.PodFilter{Name: "oom", TerminationReasons: []string{"OOMKilled"}}),
+		pod:    pod(corev1.PodFailed, 2*time.Hour, terminated(false, "Completed", 0), terminated(false, "OOMKilled", 137)),
+		reason: "Failed pod matching filter oom older than 1h0m0s",
+	}, {
+		name:   "termination reason of an init container",
+		p:      filters(v1alpha1.PodFilter{Name: "oom", TerminationReasons: []string{"OOMKilled"}}),
+		pod:    pod(corev1.PodFailed, 2*time.Hour, terminated(true, "OOMKilled", 137)),
+		reason: "Failed pod matching filter oom older than 1h0m0s",
+	}, {
+		name: "other termination reason",
+		p:    filters(v1alpha1.PodFilter{TerminationReasons: []string{"OOMKilled"}}),
+		pod:  pod(corev1.PodFailed, 2*time.Hour, terminated(false, "Error", 1)),
+	}, {
+		name:   "exit code",
+		p:      filters(v1alpha1.PodFilter{Name: "sigkill", ExitCodes: []int32{137}}),
+		pod:    pod(corev1.PodFailed, 2*time.Hour, terminated(false, "Error", 137)),
+		reason: "Failed pod matching filter sigkill older than 1h0m0s",
+	}, {
+		name: "other exit code",
+		p:    filters(v1alpha1.PodFilter{ExitCodes: []int32{137}}),
+		pod:  pod(corev1.PodFailed, 2*time.Hour, terminated(false, "Error", 1)),
+	}, {
+		name:   "reason and exit code of the same container",
+		p:      filters(v1alpha1.PodFilter{Name: "oom", TerminationReasons: []string{"OOMKilled"}, ExitCodes: []int32{137}}),
+		pod:    pod(corev1.PodFailed, 2*time.Hour, terminated(false, "Error", 1), terminated(false, "OOMKilled", 137)),
+		reason: "Failed pod matching filter oom older than 1h0m0s",
+	}, {
+		name: "reason and exit code of different containers",
+		p:    filters(v1alpha1.PodFilter{TerminationReasons: []string{"OOMKilled"}, ExitCodes: []int32{137}}),
+		pod:  pod(corev1.PodFailed, 2*time.Hour, terminated(false, "OOMKilled", 1), terminated(true, "Error", 137)),
+	}, {
+		name: "container not terminated",
+		p:    filters(v1alpha1.PodFilter{ExitCodes: []int32{0}}),
+		pod: pod(corev1.PodFailed, 2*time.Hour, func(p *corev1.Pod) {
+			p.Status.ContainerStatuses = []corev1.ContainerStatus{{State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}}
+		}),
+	}, {
+		name: "every matcher of a filter",
+		p: filters(v1alpha1.PodFilter{
+			Name:       "evicted-spot",
+			Reasons:    []string{"Evicted"},
+			NodeNames:  []string{"spot-1"},
+			QOSClasses: []corev1.PodQOSClass{corev1.PodQOSBurstable},
+		}),
+		pod: pod(corev1.PodFailed, 2*time.Hour, func(p *corev1.Pod) {
+			p.Status.Reason = "Evicted"
+			p.Spec.NodeName = "spot-1"
+		}),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := EvaluatePod(test.p, test.pod, now)
+			want := PodDecision{}
+			if test.reason != "" {
+				want = PodDecision{Delete: true, Rule: RuleFinished, Reason: test.reason}
+			}
+			if got != want {
+				t.Errorf("EvaluatePod() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestEvaluateCleanerPod(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	hour := metav1.Duration{Duration: time.Hour}
+	longAgo := metav1.Time{Time: now.Add(-2 * time.Hour)}
+	nc := &v1alpha1.NamespaceCleaner{Spec: v1alpha1.NamespaceCleanerSpec{
+		PodPolicy:        v1alpha1.PodPolicy{TTL: &hour},
+		StuckTerminating: &v1alpha1.StuckTerminatingPolicy{After: hour},
+		OrphanedNode:     &v1alpha1.OrphanedNodePolicy{NotReadyAfter: &hour, Force: true},
+		Unschedulable:    &v1alpha1.UnschedulablePolicy{After: hour},
+		BrokenPods:       &v1alpha1.BrokenPodPolicy{After: hour},
+	}}
+	nodes := func(name string) (*corev1.Node, error) {
+		switch name {
+		case "ready":
+			return &corev1.Node{Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{{
+				Type:   corev1.NodeReady,
+				Status: corev1.ConditionTrue,
+			}}}}, nil
+		case "flaky":
+			return nil, apierrs.NewServiceUnavailable("etcd is down")
+		}
+		return nil, apierrs.NewNotFound(schema.GroupResource{Resource: "nodes"}, name)
+	}
+
+	// Each mutation makes the pod selected by one more rule.
+	pod := func(phase corev1.PodPhase, mutate ...func(*corev1.Pod)) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "build-1", CreationTimestamp: longAgo},
+			Spec:       corev1.PodSpec{NodeName: "ready"},
+			Status:     corev1.PodStatus{Phase: phase, StartTime: &longAgo},
+		}
+		for _, m := range mutate {
+			m(p)
+		}
+		return p
+	}
+	stuck := func(p *corev1.Pod) {
+		p.DeletionTimestamp = &longAgo
+	}
+	orphaned := func(p *corev1.Pod) {
+		p.Spec.NodeName = "gone"
+	}
+	unschedulable := func(p *corev1.Pod) {
+		p.Status.Conditions = append(p.Status.Conditions, corev1.PodCondition{
+			Type:               corev1.PodScheduled,
+			Status:             corev1.ConditionFalse,
+			Reason:             corev1.PodReasonUnschedulable,
+			LastTransitionTime: longAgo,
+		})
+	}
+	broken := func(p *corev1.Pod) {
+		p.Status.ContainerStatuses = append(p.Status.ContainerStatuses, corev1.ContainerStatus{
+			Name:         "build",
+			RestartCount: 12,
+			State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		})
+	}
+
+	tests := []struct {
+		name    string
+		nc      *v1alpha1.NamespaceCleaner
+		pod     *corev1.Pod
+		rule    string
+		wantErr bool
+	}{{
+		name: "stuck before orphaned",
+		pod:  pod(corev1.PodRunning, stuck, orphaned),
+		rule: RuleStuckTerminating,
+	}, {
+		name: "stuck before finished",
+		pod:  pod(corev1.PodSucceeded, stuck),
+		rule: RuleStuckTerminating,
+	}, {
+		name: "orphaned before unschedulable",
+		pod:  pod(corev1.PodPending, orphaned, unschedulable, broken),
+		rule: RuleOrphanedNode,
+	}, {
+		name: "orphaned before finished",
+		pod:  pod(corev1.PodSucceeded, orphaned),
+		rule: RuleOrphanedNode,
+	}, {
+		name: "unschedulable before broken",
+		pod:  pod(corev1.PodPending, unschedulable, broken),
+		rule: RuleUnschedulable,
+	}, {
+		name: "broken",
+		pod:  pod(corev1.PodRunning, broken),
+		rule: RuleBrokenPod,
+	}, {
+		name: "finished",
+		pod:  pod(corev1.PodFailed),
+		rule: RuleFinished,
+	}, {
+		name: "finished without other rules",
+		nc:   &v1alpha1.NamespaceCleaner{Spec: v1alpha1.NamespaceCleanerSpec{PodPolicy: v1alpha1.PodPolicy{TTL: &hour}}},
+		pod:  pod(corev1.PodFailed, orphaned, broken),
+		rule: RuleFinished,
+	}, {
+		name: "healthy",
+		pod:  pod(corev1.PodRunning),
+	}, {
+		name:    "node lookup failed",
+		pod:     pod(corev1.PodSucceeded, func(p *corev1.Pod) { p.Spec.NodeName = "flaky" }),
+		wantErr: true,
+	}, {
+		name: "stuck despite a failed node lookup",
+		pod:  pod(corev1.PodRunning, stuck, func(p *corev1.Pod) { p.Spec.NodeName = "flaky" }),
+		rule: RuleStuckTerminating,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cleaner := nc
+			if test.nc != nil {
+				cleaner = test.nc
+			}
+			got, err := EvaluateCleanerPod(cleaner, test.pod, nodes, now)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("EvaluateCleanerPod() = %v, wantErr %v", err, test.wantErr)
+			}
+			if got.Rule != test.rule || got.Delete != (test.rule != "") {
+				t.Errorf("EvaluateCleanerPod() = %+v, want rule %q", got, test.rule)
+			}
+		})
+	}
+}
+
+func TestTenantMinTTL(t *testing.T) {
+	limited := func(nc *v1alpha1.NamespaceCleaner, minTTL time.Duration) *v1alpha1.NamespaceCleaner {
+		nc.Spec.TenantLimits = &v1alpha1.TenantLimits{MinTTL: &metav1.Duration{Duration: minTTL}}
+		return nc
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"tier": "dev", "team": "a"}}}
+
+	tests := []struct {
+		name     string
+		cleaners []*v1alpha1.NamespaceCleaner
+		want     time.Duration
+		by       string
+	}{{
+		name: "no cleaners",
+	}, {
+		name:     "no limits",
+		cleaners: []*v1alpha1.NamespaceCleaner{cleaner("dev", map[string]string{"tier": "dev"})},
+	}, {
+		name: "strictest limit",
+		cleaners: []*v1alpha1.NamespaceCleaner{
+			limited(cleaner("dev", map[string]string{"tier": "dev"}), time.Hour),
+			limited(cleaner("team-a", map[string]string{"team": "a"}), 2*time.Hour),
+			cleaner("unlimited", map[string]string{"team": "a"}),
+		},
+		want: 2 * time.Hour,
+		by:   "team-a",
+	}, {
+		name: "not selecting the namespace",
+		cleaners: []*v1alpha1.NamespaceCleaner{
+			limited(cleaner("dev", map[string]string{"tier": "dev"}), time.Hour),
+			limited(cleaner("prod", map[string]string{"tier": "prod"}), 24*time.Hour),
+		},
+		want: time.Hour,
+		by:   "dev",
+	}, {
+		name: "ties by name",
+		cleaners: []*v1alpha1.NamespaceCleaner{
+			limited(cleaner("zeta", map[string]string{"tier": "dev"}), time.Hour),
+			limited(cleaner("alpha", map[string]string{"team": "a"}), time.Hour),
+		},
+		want: time.Hour,
+		by:   "alpha",
+	}, {
+		name: "suspended cleaners still limit",
+		cleaners: []*v1alpha1.NamespaceCleaner{
+			suspended(limited(cleaner("dev", map[string]string{"tier": "dev"}), time.Hour)),
+		},
+		want: time.Hour,
+		by:   "dev",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, by := TenantMinTTL(test.cleaners, ns)
+			if got != test.want || by != test.by {
+				t.Errorf("TenantMinTTL() = %s, %q, want %s, %q", got, by, test.want, test.by)
+			}
+		})
+	}
+}
+
+func TestRaiseTTL(t *testing.T) {
+	duration := func(d time.Duration) *metav1.Duration {
+		return &metav1.Duration{Duration: d}
+	}
+	filterTTLs := func(p *v1alpha1.PodPolicy) []*metav1.Duration {
+		var ttls []*metav1.Duration
+		for _, f := range p.PodFilters {
+			ttls = append(ttls, f.TTL)
+		}
+		return ttls
+	}
+
+	tests := []struct {
+		name       string
+		p          *v1alpha1.PodPolicy
+		minTTL     time.Duration
+		raised     bool
+		ttl        time.Duration
+		filterTTLs []*metav1.Duration
+	}{{
+		name: "no limit",
+		p:    &v1alpha1.PodPolicy{TTL: duration(time.Minute)},
+		ttl:  time.Minute,
+	}, {
+		name:   "within the limit",
+		p:      &v1alpha1.PodPolicy{TTL: duration(2 * time.Hour)},
+		minTTL: time.Hour,
+		ttl:    2 * time.Hour,
+	}, {
+		name:   "at the limit",
+		p:      &v1alpha1.PodPolicy{TTL: duration(time.Hour)},
+		minTTL: time.Hour,
+		ttl:    time.Hour,
+	}, {
+		name:   "below the limit",
+		p:      &v1alpha1.PodPolicy{TTL: duration(time.Minute)},
+		minTTL: time.Hour,
+		raised: true,
+		ttl:    time.Hour,
+	}, {
+		name:   "default ttl",
+		p:      &v1alpha1.PodPolicy{},
+		minTTL: time.Hour,
+		raised: true,
+		ttl:    time.Hour,
+	}, {
+		name: "filters",
+		p: &v1alpha1.PodPolicy{TTL: duration(2 * time.Hour), PodFilters: []v1alpha1.PodFilter{
+			{TTL: duration(time.Minute)},
+			{TTL: duration(3 * time.Hour)},
+			// Filters without a ttl of their own use the raised one.
+			{},
+			{TTL: duration(0)},
+		}},
+		minTTL:     time.Hour,
+		raised:     true,
+		ttl:        2 * time.Hour,
+		filterTTLs: []*metav1.Duration{duration(time.Hour), duration(3 * time.Hour), nil, duration(0)},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := RaiseTTL(test.p, test.minTTL); got != test.raised {
+				t.Errorf("RaiseTTL() = %v, want %v", got, test.raised)
+			}
+			if got := test.p.GetTTL(); got != test.ttl {
+				t.Errorf("ttl = %s, want %s", got, test.ttl)
+			}
+			got := filterTTLs(test.p)
+			if !slices.EqualFunc(got, test.filterTTLs, equalPtr[metav1.Duration]) {
+				t.Errorf("filter ttls = %v, want %v", got, test.filterTTLs)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+// revisionAnnotation is set by the Deployment controller on a Deployment and
+// its ReplicaSets to the revision of their pod template.
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// Revision returns the Deployment revision of rs, or 0 if it has none.
+func Revision(rs *appsv1.ReplicaSet) int64 {
+	revision, err := strconv.ParseInt(rs.Annotations[revisionAnnotation], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return revision
+}
+
+// DeploymentOf returns the controller reference of rs if it is controlled by
+// an apps Deployment, or nil otherwise. Deployments of other API groups are
+// left alone, their controllers may not manage ReplicaSets the same way.
+func DeploymentOf(rs *appsv1.ReplicaSet) *metav1.OwnerReference {
+	owner := metav1.GetControllerOf(rs)
+	if owner == nil || owner.Kind != "Deployment" {
+		return nil
+	}
+	gv, err := schema.ParseGroupVersion(owner.APIVersion)
+	if err != nil || gv.Group != appsv1.GroupName {
+		return nil
+	}
+	return owner
+}
+
+// ControlledBy reports whether rs is controlled by deployment, and not by an
+// earlier Deployment of the same name.
+func ControlledBy(rs *appsv1.ReplicaSet, deployment *appsv1.Deployment) bool {
+	owner := DeploymentOf(rs)
+	return owner != nil && owner.UID == deployment.UID
+}
+
+// RollingOut reports whether the Deployment controller has not yet caught up
+// with deployment, or is still replacing its pods.
+func RollingOut(deployment *appsv1.Deployment) bool {
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return true
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.UpdatedReplicas < replicas ||
+		deployment.Status.Replicas > deployment.Status.UpdatedReplicas
+}
+
+// PrunableReplicaSets returns the ReplicaSets among owned that p deletes: the
+// old revisions controlled by deployment that run no pods, beyond the
+// p.KeepRevisions most recent of them. The current revision is always kept,
+// and nothing is pruned while the Deployment rolls out.
+func PrunableReplicaSets(p *v1alpha1.ReplicaSetPolicy, deployment *appsv1.Deployment, owned []*appsv1.ReplicaSet) []*appsv1.ReplicaSet {
+	if RollingOut(deployment) {
+		return nil
+	}
+	current, err := strconv.ParseInt(deployment.Annotations[revisionAnnotation], 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	old := make([]*appsv1.ReplicaSet, 0, len(owned))
+	for _, rs := range owned {
+		revision := Revision(rs)
+		if !ControlledBy(rs, deployment) || revision == 0 || revision >= current || rs.DeletionTimestamp != nil {
+			continue
+		}
+		if (rs.Spec.Replicas != nil && *rs.Spec.Replicas > 0) || rs.Status.Replicas > 0 {
+			continue
+		}
+		old = append(old, rs)
+	}
+	keep := max(int(p.KeepRevisions), 0)
+	if len(old) <= keep {
+		return nil
+	}
+
+	// Newest first, so the revisions kept come first.
+	slices.SortFunc(old, func(a, b *appsv1.ReplicaSet) int {
+		return cmp.Compare(Revision(b), Revision(a))
+	})
+	return old[keep:]
+}
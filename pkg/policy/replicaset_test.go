@@ -0,0 +1,204 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+func TestPrunableReplicaSets(t *testing.T) {
+	deployment := func(revision int, mutate ...func(*appsv1.Deployment)) *appsv1.Deployment {
+		d := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "web",
+				UID:         "web-uid",
+				Generation:  3,
+				Annotations: map[string]string{revisionAnnotation: strconv.Itoa(revision)},
+			},
+			Spec: appsv1.DeploymentSpec{Replicas: ptr(int32(2))},
+			Status: appsv1.DeploymentStatus{
+				ObservedGeneration: 3,
+				Replicas:           2,
+				UpdatedReplicas:    2,
+			},
+		}
+		for _, m := range mutate {
+			m(d)
+		}
+		return d
+	}
+	rs := func(revision int, mutate ...func(*appsv1.ReplicaSet)) *appsv1.ReplicaSet {
+		r := &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "web-" + strconv.Itoa(revision),
+				Annotations: map[string]string{revisionAnnotation: strconv.Itoa(revision)},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
+					Name:       "web",
+					UID:        "web-uid",
+					Controller: ptr(true),
+				}},
+			},
+			Spec: appsv1.ReplicaSetSpec{Replicas: ptr(int32(0))},
+		}
+		for _, m := range mutate {
+			m(r)
+		}
+		return r
+	}
+	running := func(r *appsv1.ReplicaSet) {
+		r.Spec.Replicas = ptr(int32(1))
+	}
+	// Scaled down, but its pods are still terminating.
+	terminating := func(r *appsv1.ReplicaSet) {
+		r.Status.Replicas = 1
+	}
+	owner := func(apiVersion string, uid types.UID) func(*appsv1.ReplicaSet) {
+		return func(r *appsv1.ReplicaSet) {
+			r.OwnerReferences[0].APIVersion = apiVersion
+			r.OwnerReferences[0].UID = uid
+		}
+	}
+	history := func(mutate map[int]func(*appsv1.ReplicaSet)) []*appsv1.ReplicaSet {
+		var owned []*appsv1.ReplicaSet
+		for revision := 1; revision <= 5; revision++ {
+			if m, ok := mutate[revision]; ok {
+				owned = append(owned, rs(revision, m))
+			} else {
+				owned = append(owned, rs(revision))
+			}
+		}
+		return owned
+	}
+	keep := func(n int32) *v1alpha1.ReplicaSetPolicy {
+		return &v1alpha1.ReplicaSetPolicy{KeepRevisions: n}
+	}
+
+	tests := []struct {
+		name       string
+		p          *v1alpha1.ReplicaSetPolicy
+		deployment *appsv1.Deployment
+		owned      []*appsv1.ReplicaSet
+		want       []string
+	}{{
+		name:       "keep revisions",
+		p:          keep(2),
+		deployment: deployment(5),
+		owned:      history(nil),
+		want:       []string{"web-2", "web-1"},
+	}, {
+		name:       "keep none",
+		p:          keep(0),
+		deployment: deployment(5),
+		owned:      history(nil),
+		want:       []string{"web-4", "web-3", "web-2", "web-1"},
+	}, {
+		name:       "keep more than there are",
+		p:          keep(10),
+		deployment: deployment(5),
+		owned:      history(nil),
+	}, {
+		name:       "running pods",
+		p:          keep(1),
+		deployment: deployment(5),
+		owned:      history(map[int]func(*appsv1.ReplicaSet){4: running, 2: terminating}),
+		want:       []string{"web-1"},
+	}, {
+		name:       "wrong owner uid",
+		p:          keep(0),
+		deployment: deployment(5),
+		owned:      history(map[int]func(*appsv1.ReplicaSet){1: owner("apps/v1", "earlier-web-uid")}),
+		want:       []string{"web-4", "web-3", "web-2"},
+	}, {
+		name:       "wrong owner group",
+		p:          keep(0),
+		deployment: deployment(5),
+		owned:      history(map[int]func(*appsv1.ReplicaSet){1: owner("example.com/v1", "web-uid")}),
+		want:       []string{"web-4", "web-3", "web-2"},
+	}, {
+		name:       "deleting",
+		p:          keep(0),
+		deployment: deployment(5),
+		owned: history(map[int]func(*appsv1.ReplicaSet){1: func(r *appsv1.ReplicaSet) {
+			r.DeletionTimestamp = &metav1.Time{}
+		}}),
+		want: []string{"web-4", "web-3", "web-2"},
+	}, {
+		name:       "without a revision",
+		p:          keep(0),
+		deployment: deployment(5),
+		owned: history(map[int]func(*appsv1.ReplicaSet){1: func(r *appsv1.ReplicaSet) {
+			delete(r.Annotations, revisionAnnotation)
+		}}),
+		want: []string{"web-4", "web-3", "web-2"},
+	}, {
+		name:       "rollback to an older revision",
+		p:          keep(0),
+		deployment: deployment(3),
+		owned:      history(nil),
+		want:       []string{"web-2", "web-1"},
+	}, {
+		name: "generation not observed",
+		p:    keep(0),
+		deployment: deployment(5, func(d *appsv1.Deployment) {
+			d.Generation = 4
+		}),
+		owned: history(nil),
+	}, {
+		name: "pods not updated",
+		p:    keep(0),
+		deployment: deployment(5, func(d *appsv1.Deployment) {
+			d.Status.UpdatedReplicas = 1
+		}),
+		owned: history(nil),
+	}, {
+		name: "old pods remaining",
+		p:    keep(0),
+		deployment: deployment(5, func(d *appsv1.Deployment) {
+			d.Status.Replicas = 3
+		}),
+		owned: history(nil),
+	}, {
+		name: "deployment without a revision",
+		p:    keep(0),
+		deployment: deployment(5, func(d *appsv1.Deployment) {
+			d.Annotations = nil
+		}),
+		owned: history(nil),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, rs := range PrunableReplicaSets(test.p, test.deployment, test.owned) {
+				got = append(got, rs.Name)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("PrunableReplicaSets() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+// JobLookup returns the Job with the given name in the namespace of the pods
+// being evaluated, or false if it does not exist.
+type JobLookup func(name string) (*batchv1.Job, bool)
+
+// RetentionGroup returns the group whose most recent pods p keeps that pod
+// belongs to: the value of p.GroupByLabel, or otherwise its controller, the
+// pods of a Job created by a CronJob being grouped by the CronJob. Pods in no
+// group, "", are only subject to the TTL.
+func RetentionGroup(p *v1alpha1.RetentionPolicy, pod *corev1.Pod, jobs JobLookup) string {
+	if p.GroupByLabel != "" {
+		value, ok := pod.Labels[p.GroupByLabel]
+		if !ok {
+			return ""
+		}
+		return "label/" + value
+	}
+
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return ""
+	}
+	if owner.APIVersion == "batch/v1" && owner.Kind == "Job" {
+		if job, ok := jobs(owner.Name); ok {
+			if cronJob := metav1.GetControllerOf(job); cronJob != nil {
+				owner = cronJob
+			}
+		}
+	}
+	return owner.Kind + "/" + owner.Name
+}
+
+// FinishTime returns when pod finished: when its last container terminated,
+// or when it was created if none reported so.
+func FinishTime(pod *corev1.Pod) time.Time {
+	finished := pod.CreationTimestamp.Time
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if t := status.State.Terminated; t != nil && t.FinishedAt.After(finished) {
+				finished = t.FinishedAt.Time
+			}
+		}
+	}
+	return finished
+}
+
+// Retention tracks the most recently finished pods of each group, which a
+// RetentionPolicy keeps however old they are. Every finished pod is observed
+// before any is asked about, since a pod is only known to be among the last
+// N once all of its group was seen.
+type Retention struct {
+	p      *v1alpha1.RetentionPolicy
+	newest map[retentionKey][]retainedPod
+
+	// observed pods, since a list restarted after its continue token
+	// expired returns some of them again.
+	observed sets.Set[types.UID]
+}
+
+type retentionKey struct {
+	group string
+	phase corev1.PodPhase
+}
+
+type retainedPod struct {
+	uid      types.UID
+	name     string
+	finished time.Time
+}
+
+// NewRetention returns a Retention applying p.
+func NewRetention(p *v1alpha1.RetentionPolicy) *Retention {
+	return &Retention{p: p, newest: map[retentionKey][]retainedPod{}, observed: sets.New[types.UID]()}
+}
+
+// keep returns how many pods finished in phase are kept per group.
+func (r *Retention) keep(phase corev1.PodPhase) int {
+	switch phase {
+	case corev1.PodSucceeded:
+		return int(r.p.KeepLastSucceeded)
+	case corev1.PodFailed:
+		return int(r.p.KeepLastFailed)
+	}
+	return 0
+}
+
+// Observe records the finished pod as a member of group.
+func (r *Retention) Observe(pod *corev1.Pod, group string) {
+	n := r.keep(pod.Status.Phase)
+	if group == "" || n <= 0 || r.observed.Has(pod.UID) {
+		return
+	}
+	r.observed.Insert(pod.UID)
+
+	key := retentionKey{group: group, phase: pod.Status.Phase}
+	candidate := retainedPod{uid: pod.UID, name: pod.Name, finished: FinishTime(pod)}
+	newest := r.newest[key]
+	i, _ := slices.BinarySearchFunc(newest, candidate, func(a, b retainedPod) int {
+		// Newest first, ties broken by name so the result does not depend
+		// on the list order.
+		if c := b.finished.Compare(a.finished); c != 0 {
+			return c
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	if i >= n {
+		return
+	}
+	newest = slices.Insert(newest, i, candidate)
+	if len(newest) > n {
+		newest = newest[:n]
+	}
+	r.newest[key] = newest
+}
+
+// Retains reports whether pod is among the most recently finished pods of
+// group that are kept.
+func (r *Retention) Retains(pod *corev1.Pod, group string) bool {
+	if group == "" {
+		return false
+	}
+	return slices.ContainsFunc(r.newest[retentionKey{group: group, phase: pod.Status.Phase}], func(p retainedPod) bool {
+		return p.uid == pod.UID
+	})
+}
+
+// ExpiredPod is a finished pod past its TTL, deleted unless retained.
+type ExpiredPod struct {
+	Pod      *corev1.Pod
+	Decision PodDecision
+	group    string
+}
+
+// Expiry holds back the finished pods past their TTL found while listing a
+// namespace, until every pod of it was seen and a RetentionPolicy knows which
+// of them it keeps.
+type Expiry struct {
+	p         *v1alpha1.RetentionPolicy
+	jobs      JobLookup
+	retention *Retention
+	expired   []ExpiredPod
+}
+
+// NewExpiry returns an Expiry applying p, looking up the Jobs of the pods
+// with jobs.
+func NewExpiry(p *v1alpha1.RetentionPolicy, jobs JobLookup) *Expiry {
+	return &Expiry{p: p, jobs: jobs, retention: NewRetention(p)}
+}
+
+// Hold observes pod, reporting whether decision, a RuleFinished one, is held
+// back until Release. A pod held before, as a restarted list may return it
+// again, is only reported held.
+func (e *Expiry) Hold(pod *corev1.Pod, decision PodDecision) bool {
+	if !slices.Contains(FinishedPhases, pod.Status.Phase) {
+		return false
+	}
+	group := RetentionGroup(e.p, pod, e.jobs)
+	e.retention.Observe(pod, group)
+	if !decision.Delete || decision.Rule != RuleFinished {
+		return false
+	}
+	if !slices.ContainsFunc(e.expired, func(x ExpiredPod) bool { return x.Pod.UID == pod.UID }) {
+		e.expired = append(e.expired, ExpiredPod{Pod: pod, Decision: decision, group: group})
+	}
+	return true
+}
+
+// Release returns the held pods, in the order they were held, that are not
+// retained, and how many are.
+func (e *Expiry) Release() (expired []ExpiredPod, retained int) {
+	for _, x := range e.expired {
+		if e.retention.Retains(x.Pod, x.group) {
+			retained++
+			continue
+		}
+		expired = append(expired, x)
+	}
+	return expired, retained
+}
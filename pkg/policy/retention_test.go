@@ -0,0 +1,298 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+var retentionEpoch = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// finishedPod returns a pod that finished in phase minutes after the epoch.
+func finishedPod(name string, phase corev1.PodPhase, minutes int) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			UID:               types.UID(name + "-uid"),
+			CreationTimestamp: metav1.Time{Time: retentionEpoch},
+		},
+		Status: corev1.PodStatus{
+			Phase: phase,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					FinishedAt: metav1.Time{Time: retentionEpoch.Add(time.Duration(minutes) * time.Minute)},
+				}},
+			}},
+		},
+	}
+}
+
+func controlledBy(pod *corev1.Pod, apiVersion, kind, name string) *corev1.Pod {
+	pod.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Name:       name,
+		Controller: ptr(true),
+	}}
+	return pod
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func noJobs(string) (*batchv1.Job, bool) {
+	return nil, false
+}
+
+func TestRetentionGroup(t *testing.T) {
+	cronJob := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name: "backup-28000",
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: "batch/v1",
+			Kind:       "CronJob",
+			Name:       "backup",
+			Controller: ptr(true),
+		}},
+	}}
+	jobs := func(name string) (*batchv1.Job, bool) {
+		switch name {
+		case "backup-28000":
+			return cronJob, true
+		case "migrate":
+			return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "migrate"}}, true
+		}
+		return nil, false
+	}
+	pod := func() *corev1.Pod {
+		return finishedPod("p", corev1.PodSucceeded, 0)
+	}
+	labelled := pod()
+	labelled.Labels = map[string]string{"pipeline": "build"}
+
+	tests := []struct {
+		name string
+		p    *v1alpha1.RetentionPolicy
+		pod  *corev1.Pod
+		want string
+	}{{
+		name: "label",
+		p:    &v1alpha1.RetentionPolicy{GroupByLabel: "pipeline"},
+		pod:  controlledBy(labelled, "batch/v1", "Job", "migrate"),
+		want: "label/build",
+	}, {
+		name: "label missing",
+		p:    &v1alpha1.RetentionPolicy{GroupByLabel: "pipeline"},
+		pod:  controlledBy(pod(), "batch/v1", "Job", "migrate"),
+	}, {
+		name: "controller",
+		p:    &v1alpha1.RetentionPolicy{},
+		pod:  controlledBy(pod(), "tekton.dev/v1", "TaskRun", "build-1"),
+		want: "TaskRun/build-1",
+	}, {
+		name: "job of a cronjob",
+		p:    &v1alpha1.RetentionPolicy{},
+		pod:  controlledBy(pod(), "batch/v1", "Job", "backup-28000"),
+		want: "CronJob/backup",
+	}, {
+		name: "job without a cronjob",
+		p:    &v1alpha1.RetentionPolicy{},
+		pod:  controlledBy(pod(), "batch/v1", "Job", "migrate"),
+		want: "Job/migrate",
+	}, {
+		name: "job gone",
+		p:    &v1alpha1.RetentionPolicy{},
+		pod:  controlledBy(pod(), "batch/v1", "Job", "gone"),
+		want: "Job/gone",
+	}, {
+		name: "no controller",
+		p:    &v1alpha1.RetentionPolicy{},
+		pod:  pod(),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := RetentionGroup(test.p, test.pod, jobs); got != test.want {
+				t.Errorf("RetentionGroup() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFinishTime(t *testing.T) {
+	pod := finishedPod("p", corev1.PodSucceeded, 5)
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			FinishedAt: metav1.Time{Time: retentionEpoch.Add(time.Minute)},
+		}},
+	}}
+	if got, want := FinishTime(pod), retentionEpoch.Add(5*time.Minute); !got.Equal(want) {
+		t.Errorf("FinishTime() = %v, want %v", got, want)
+	}
+
+	pod.Status.ContainerStatuses = nil
+	pod.Status.InitContainerStatuses = nil
+	if got := FinishTime(pod); !got.Equal(retentionEpoch) {
+		t.Errorf("FinishTime() = %v, want the creation time %v", got, retentionEpoch)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	job := func(pod *corev1.Pod) *corev1.Pod {
+		return controlledBy(pod, "batch/v1", "Job", "migrate")
+	}
+	pods := []*corev1.Pod{
+		job(finishedPod("ok-1", corev1.PodSucceeded, 1)),
+		job(finishedPod("ok-3", corev1.PodSucceeded, 3)),
+		job(finishedPod("ok-2", corev1.PodSucceeded, 2)),
+		job(finishedPod("failed-1", corev1.PodFailed, 1)),
+		job(finishedPod("failed-2", corev1.PodFailed, 2)),
+		// Another group, its pods kept apart.
+		controlledBy(finishedPod("other-1", corev1.PodSucceeded, 0), "batch/v1", "Job", "other"),
+		// No group, only subject to the TTL.
+		finishedPod("single", corev1.PodSucceeded, 9),
+	}
+
+	tests := []struct {
+		name string
+		p    *v1alpha1.RetentionPolicy
+		want []string
+	}{{
+		name: "succeeded",
+		p:    &v1alpha1.RetentionPolicy{KeepLastSucceeded: 2},
+		want: []string{"ok-3", "ok-2", "other-1"},
+	}, {
+		name: "failed",
+		p:    &v1alpha1.RetentionPolicy{KeepLastFailed: 1},
+		want: []string{"failed-2"},
+	}, {
+		name: "both",
+		p:    &v1alpha1.RetentionPolicy{KeepLastSucceeded: 1, KeepLastFailed: 5},
+		want: []string{"ok-3", "failed-1", "failed-2", "other-1"},
+	}, {
+		name: "none",
+		p:    &v1alpha1.RetentionPolicy{},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewRetention(test.p)
+			for _, pod := range pods {
+				r.Observe(pod, RetentionGroup(test.p, pod, noJobs))
+			}
+			var got []string
+			for _, pod := range pods {
+				if r.Retains(pod, RetentionGroup(test.p, pod, noJobs)) {
+					got = append(got, pod.Name)
+				}
+			}
+			slices.Sort(got)
+			slices.Sort(test.want)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("retained %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRetentionTies(t *testing.T) {
+	p := &v1alpha1.RetentionPolicy{KeepLastSucceeded: 1}
+	a := finishedPod("a", corev1.PodSucceeded, 1)
+	b := finishedPod("b", corev1.PodSucceeded, 1)
+
+	// The pod kept does not depend on the list order.
+	for _, order := range [][]*corev1.Pod{{a, b}, {b, a}} {
+		r := NewRetention(p)
+		for _, pod := range order {
+			r.Observe(pod, "Job/migrate")
+		}
+		if !r.Retains(a, "Job/migrate") || r.Retains(b, "Job/migrate") {
+			t.Errorf("observing %s then %s: want a retained", order[0].Name, order[1].Name)
+		}
+	}
+}
+
+func TestRetentionDedupe(t *testing.T) {
+	p := &v1alpha1.RetentionPolicy{KeepLastSucceeded: 2}
+	newest := finishedPod("newest", corev1.PodSucceeded, 3)
+	older := finishedPod("older", corev1.PodSucceeded, 2)
+
+	r := NewRetention(p)
+	// A restarted list returns the newest pod again, which must not take
+	// the place of the older one.
+	for _, pod := range []*corev1.Pod{newest, newest, older} {
+		r.Observe(pod, "Job/migrate")
+	}
+	for _, pod := range []*corev1.Pod{newest, older} {
+		if !r.Retains(pod, "Job/migrate") {
+			t.Errorf("Retains(%s) = false, want true", pod.Name)
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	p := &v1alpha1.RetentionPolicy{KeepLastSucceeded: 1}
+	expired := PodDecision{Delete: true, Rule: RuleFinished, Reason: "expired"}
+	job := func(pod *corev1.Pod) *corev1.Pod {
+		return controlledBy(pod, "batch/v1", "Job", "migrate")
+	}
+	old := job(finishedPod("old", corev1.PodSucceeded, 1))
+	// The most recent pod is not expired yet, but still takes the place of
+	// the pods it is more recent than.
+	recent := job(finishedPod("recent", corev1.PodSucceeded, 9))
+	stuck := job(finishedPod("stuck", corev1.PodFailed, 2))
+	running := job(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "running", UID: "running-uid"}, Status: corev1.PodStatus{Phase: corev1.PodRunning}})
+
+	e := NewExpiry(p, noJobs)
+	if !e.Hold(old, expired) {
+		t.Error("Hold(old) = false, want an expired finished pod held")
+	}
+	// Returned again by a restarted list.
+	if !e.Hold(old, expired) {
+		t.Error("Hold(old) = false the second time")
+	}
+	if e.Hold(recent, PodDecision{}) {
+		t.Error("Hold(recent) = true for a pod not expired")
+	}
+	if e.Hold(stuck, PodDecision{Delete: true, Rule: RuleBrokenPod}) {
+		t.Error("Hold(stuck) = true for a pod deleted by another rule")
+	}
+	if e.Hold(running, PodDecision{Delete: true, Rule: RuleFinished}) {
+		t.Error("Hold(running) = true for a pod not finished")
+	}
+
+	got, retained := e.Release()
+	if len(got) != 1 || got[0].Pod != old || got[0].Decision != expired || retained != 0 {
+		t.Errorf("Release() = %v, %d, want old once and none retained", got, retained)
+	}
+
+	// Without a more recent pod the old one is the one retained.
+	e = NewExpiry(p, noJobs)
+	e.Hold(old, expired)
+	if got, retained := e.Release(); len(got) != 0 || retained != 1 {
+		t.Errorf("Release() = %v, %d, want old retained", got, retained)
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+// EvaluateStuckTerminating decides whether pod has been terminating for
+// longer than p allows at now, and must be force deleted. A nil p never
+// selects a pod.
+func EvaluateStuckTerminating(p *v1alpha1.StuckTerminatingPolicy, pod *corev1.Pod, now time.Time) PodDecision {
+	if p == nil || pod.DeletionTimestamp == nil {
+		return PodDecision{}
+	}
+
+	terminating := now.Sub(pod.DeletionTimestamp.Time)
+	if terminating <= p.After.Duration {
+		return PodDecision{}
+	}
+
+	return PodDecision{
+		Delete: true,
+		Rule:   RuleStuckTerminating,
+		Reason: fmt.Sprintf("terminating for %s, longer than %s", terminating.Round(time.Second), p.After.Duration),
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+// EvaluateUnschedulable decides whether pod has been Pending, with its
+// PodScheduled condition False for reason Unschedulable, for longer than p
+// allows at now. A nil p never selects a pod.
+func EvaluateUnschedulable(p *v1alpha1.UnschedulablePolicy, pod *corev1.Pod, now time.Time) PodDecision {
+	if p == nil || pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodPending {
+		return PodDecision{}
+	}
+	if p.BarePodsOnly && metav1.GetControllerOf(pod) != nil {
+		return PodDecision{}
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type != corev1.PodScheduled || condition.Status != corev1.ConditionFalse ||
+			condition.Reason != corev1.PodReasonUnschedulable {
+			continue
+		}
+		unschedulable := now.Sub(condition.LastTransitionTime.Time)
+		if unschedulable <= p.After.Duration {
+			return PodDecision{}
+		}
+		return PodDecision{
+			Delete: true,
+			Rule:   RuleUnschedulable,
+			Reason: fmt.Sprintf("unschedulable for %s, longer than %s", unschedulable.Round(time.Second), p.After.Duration),
+		}
+	}
+	return PodDecision{}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+// LastUsedResolution is how stale the last-used annotation of a claim in use
+// may get before it is refreshed, so that a claim is not patched every run.
+const LastUsedResolution = time.Hour
+
+// ClaimUse records which PersistentVolumeClaims of a namespace its pods and
+// StatefulSets refer to.
+type ClaimUse struct {
+	lastUsed  map[string]time.Time
+	templates []string
+}
+
+// NewClaimUse creates an empty ClaimUse.
+func NewClaimUse() *ClaimUse {
+	return &ClaimUse{lastUsed: map[string]time.Time{}}
+}
+
+// AddPod records the claims pod mounts as used at now if it still runs, or
+// when it finished otherwise, so that the claims of Jobs are not seen as
+// unused between two of their runs.
+func (u *ClaimUse) AddPod(pod *corev1.Pod, now time.Time) {
+	used := now
+	if slices.Contains(FinishedPhases, pod.Status.Phase) {
+		used = FinishTime(pod)
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if claim := volume.PersistentVolumeClaim; claim != nil && used.After(u.lastUsed[claim.ClaimName]) {
+			u.lastUsed[claim.ClaimName] = used
+		}
+	}
+}
+
+// AddStatefulSet records the claims created from the volumeClaimTemplates of
+// sts, named <template>-<statefulset>-<ordinal>, which it mounts again when
+// scaled back up.
+func (u *ClaimUse) AddStatefulSet(sts *appsv1.StatefulSet) {
+	for _, template := range sts.Spec.VolumeClaimTemplates {
+		u.templates = append(u.templates, template.Name+"-"+sts.Name+"-")
+	}
+}
+
+// LastUsed returns when a pod last used the claim called name, if any did.
+func (u *ClaimUse) LastUsed(name string) (time.Time, bool) {
+	used, ok := u.lastUsed[name]
+	return used, ok
+}
+
+// Templated reports whether the claim called name belongs to a StatefulSet.
+func (u *ClaimUse) Templated(name string) bool {
+	for _, prefix := range u.templates {
+		if ordinal, ok := strings.CutPrefix(name, prefix); ok {
+			if _, err := strconv.Atoi(ordinal); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// VolumeAction is what a cleaner does about a PersistentVolumeClaim.
+type VolumeAction int
+
+const (
+	// VolumeKeep leaves the claim alone.
+	VolumeKeep VolumeAction = iota
+	// VolumeMarkUsed records the last use of the claim: a pod used it since
+	// it was last recorded, or it is not tracked yet.
+	VolumeMarkUsed
+	// VolumeDelete deletes a claim unused for longer than allowed.
+	VolumeDelete
+)
+
+// VolumeDecision explains what a cleaner does about a PersistentVolumeClaim.
+type VolumeDecision struct {
+	Action VolumeAction
+	// LastUsed is the last use recorded by VolumeMarkUsed.
+	LastUsed time.Time
+	// Reason describes why the claim is deleted.
+	Reason string
+}
+
+// EvaluateVolumeClaim decides what a cleaner with policy p does at now about
+// pvc, given the use use records of it. Since nothing records when a claim
+// was last mounted, its use is tracked in the LastUsedAnnotation from the
+// first time the cleaner sees it.
+func EvaluateVolumeClaim(p *v1alpha1.UnusedVolumePolicy, pvc *corev1.PersistentVolumeClaim, use *ClaimUse, now time.Time) VolumeDecision {
+	if pvc.DeletionTimestamp != nil || len(pvc.OwnerReferences) > 0 ||
+		pvc.Annotations[v1alpha1.KeepAnnotation] == "true" || use.Templated(pvc.Name) {
+		return VolumeDecision{}
+	}
+
+	lastUsed, err := time.Parse(time.RFC3339, pvc.Annotations[v1alpha1.LastUsedAnnotation])
+	tracked := err == nil
+	if podUsed, ok := use.LastUsed(pvc.Name); ok && podUsed.After(lastUsed) {
+		if !tracked || podUsed.Sub(lastUsed) > LastUsedResolution {
+			return VolumeDecision{Action: VolumeMarkUsed, LastUsed: podUsed}
+		}
+		lastUsed = podUsed
+	}
+
+	// Only a Bound claim holds on to storage.
+	if pvc.Status.Phase != corev1.ClaimBound {
+		return VolumeDecision{}
+	}
+	if !tracked {
+		return VolumeDecision{Action: VolumeMarkUsed, LastUsed: now}
+	}
+	unused := now.Sub(lastUsed)
+	if unused <= p.UnusedFor.Duration {
+		return VolumeDecision{}
+	}
+	return VolumeDecision{
+		Action: VolumeDelete,
+		Reason: fmt.Sprintf("not mounted for %s, longer than %s", unused.Round(time.Second), p.UnusedFor.Duration),
+	}
+}
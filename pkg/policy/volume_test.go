@@ -0,0 +1,212 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+func mounting(pod *corev1.Pod, claims ...string) *corev1.Pod {
+	for _, claim := range claims {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim}},
+		})
+	}
+	return pod
+}
+
+func TestClaimUse(t *testing.T) {
+	now := retentionEpoch.Add(time.Hour)
+	use := NewClaimUse()
+	use.AddPod(mounting(&corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning}}, "data"), now)
+	// A Job's claim is used when its last pod finished.
+	use.AddPod(mounting(finishedPod("job-1", corev1.PodSucceeded, 10), "cache"), now)
+	use.AddPod(mounting(finishedPod("job-2", corev1.PodFailed, 20), "cache"), now)
+	use.AddPod(mounting(finishedPod("job-0", corev1.PodSucceeded, 5), "cache"), now)
+	use.AddStatefulSet(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db"},
+		Spec: appsv1.StatefulSetSpec{VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+			{ObjectMeta: metav1.ObjectMeta{Name: "data"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "wal"}},
+		}},
+	})
+
+	tests := []struct {
+		claim string
+		want  time.Time
+		used  bool
+	}{{
+		claim: "data",
+		want:  now,
+		used:  true,
+	}, {
+		claim: "cache",
+		want:  retentionEpoch.Add(20 * time.Minute),
+		used:  true,
+	}, {
+		claim: "scratch",
+	}}
+	for _, test := range tests {
+		got, ok := use.LastUsed(test.claim)
+		if ok != test.used || !got.Equal(test.want) {
+			t.Errorf("LastUsed(%s) = %v, %v, want %v, %v", test.claim, got, ok, test.want, test.used)
+		}
+	}
+
+	for claim, want := range map[string]bool{
+		"data-db-0":    true,
+		"wal-db-12":    true,
+		"data-db-":     false,
+		"data-db-x":    false,
+		"data-dbx-0":   false,
+		"logs-db-0":    false,
+		"data-db-0-x":  false,
+		"data-other-0": false,
+	} {
+		if got := use.Templated(claim); got != want {
+			t.Errorf("Templated(%s) = %v, want %v", claim, got, want)
+		}
+	}
+}
+
+func TestEvaluateVolumeClaim(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	p := &v1alpha1.UnusedVolumePolicy{UnusedFor: metav1.Duration{Duration: 7 * 24 * time.Hour}}
+	claim := func(name string, lastUsed time.Duration, annotations ...string) *corev1.PersistentVolumeClaim {
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{}},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+		}
+		if lastUsed >= 0 {
+			pvc.Annotations[v1alpha1.LastUsedAnnotation] = now.Add(-lastUsed).Format(time.RFC3339)
+		}
+		for i := 0; i+1 < len(annotations); i += 2 {
+			pvc.Annotations[annotations[i]] = annotations[i+1]
+		}
+		return pvc
+	}
+	const untracked = -1
+
+	use := NewClaimUse()
+	// In use for a while, by a running pod.
+	use.AddPod(mounting(&corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning}}, "running"), now)
+	// Used by a Job 30 minutes ago, and an hour and a half ago.
+	job := mounting(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.Time{Time: now.Add(-time.Hour)}},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodSucceeded,
+			ContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				FinishedAt: metav1.Time{Time: now.Add(-30 * time.Minute)},
+			}}}},
+		},
+	}, "job", "job-stale")
+	use.AddPod(job, now)
+	use.AddStatefulSet(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db"},
+		Spec:       appsv1.StatefulSetSpec{VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "data"}}}},
+	})
+
+	pending := claim("pending", untracked)
+	pending.Status.Phase = corev1.ClaimPending
+	deleting := claim("deleting", 30*24*time.Hour)
+	deleting.DeletionTimestamp = &metav1.Time{Time: now}
+	owned := claim("owned", 30*24*time.Hour)
+	owned.OwnerReferences = []metav1.OwnerReference{{Kind: "Workspace", Name: "ws"}}
+
+	tests := []struct {
+		name     string
+		pvc      *corev1.PersistentVolumeClaim
+		want     VolumeAction
+		lastUsed time.Time
+	}{{
+		name:     "untracked",
+		pvc:      claim("scratch", untracked),
+		want:     VolumeMarkUsed,
+		lastUsed: now,
+	}, {
+		name: "unused within the limit",
+		pvc:  claim("scratch", 7*24*time.Hour),
+	}, {
+		name: "unused past the limit",
+		pvc:  claim("scratch", 7*24*time.Hour+time.Second),
+		want: VolumeDelete,
+	}, {
+		name:     "in use, record stale",
+		pvc:      claim("running", 2*time.Hour),
+		want:     VolumeMarkUsed,
+		lastUsed: now,
+	}, {
+		name: "in use, record within the resolution",
+		pvc:  claim("running", time.Hour),
+	}, {
+		name:     "in use, untracked",
+		pvc:      claim("running", untracked),
+		want:     VolumeMarkUsed,
+		lastUsed: now,
+	}, {
+		name: "used by a finished pod since the record",
+		pvc:  claim("job", time.Hour),
+	}, {
+		name:     "used by a finished pod, record stale",
+		pvc:      claim("job-stale", 2*time.Hour),
+		want:     VolumeMarkUsed,
+		lastUsed: now.Add(-30 * time.Minute),
+	}, {
+		name: "statefulset claim",
+		pvc:  claim("data-db-0", 30*24*time.Hour),
+	}, {
+		name: "claim named like a statefulset's",
+		pvc:  claim("data-db-main", 30*24*time.Hour),
+		want: VolumeDelete,
+	}, {
+		name: "keep annotation",
+		pvc:  claim("scratch", 30*24*time.Hour, v1alpha1.KeepAnnotation, "true"),
+	}, {
+		name: "deleting",
+		pvc:  deleting,
+	}, {
+		name: "owned",
+		pvc:  owned,
+	}, {
+		name: "not bound",
+		pvc:  pending,
+	}, {
+		name:     "unparsable record",
+		pvc:      claim("scratch", untracked, v1alpha1.LastUsedAnnotation, "last week"),
+		want:     VolumeMarkUsed,
+		lastUsed: now,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := EvaluateVolumeClaim(p, test.pvc, use, now)
+			if got.Action != test.want || !got.LastUsed.Equal(test.lastUsed) {
+				t.Errorf("EvaluateVolumeClaim() = %+v, want action %v last used %v", got, test.want, test.lastUsed)
+			}
+			if (got.Reason != "") != (test.want == VolumeDelete) {
+				t.Errorf("EvaluateVolumeClaim() reason = %q", got.Reason)
+			}
+		})
+	}
+}
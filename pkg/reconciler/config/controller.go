@@ -0,0 +1,157 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	cm "knative.dev/pkg/configmap/parser"
+
+	"github.com/infernus01/knative-demo/pkg/audit"
+)
+
+const (
+	// ControllerConfigName is the name of the ConfigMap holding the
+	// controller-wide settings.
+	ControllerConfigName = "config-namespacecleaner"
+
+	maxConcurrentNamespacesKey     = "max-concurrent-namespaces"
+	defaultNamespaceConcurrencyKey = "default-namespace-concurrency"
+	listPageSizeKey                = "list-page-size"
+	cloudEventsSinkKey             = "cloudevents-sink"
+	auditSinkKey                   = "audit-sink"
+	auditFilePathKey               = "audit-file-path"
+	auditFileMaxSizeKey            = "audit-file-max-size"
+	auditFileMaxBackupsKey         = "audit-file-max-backups"
+	auditSyslogAddressKey          = "audit-syslog-address"
+	auditKeyFileKey                = "audit-key-file"
+	allowControllerIdentityKey     = "allow-controller-identity"
+
+	// DefaultMaxConcurrentNamespaces is the number of namespaces processed
+	// in parallel across all cleaners when not configured.
+	DefaultMaxConcurrentNamespaces = 16
+
+	// DefaultNamespaceConcurrency is the number of namespaces a single
+	// cleaner processes in parallel when neither the cleaner nor the
+	// ConfigMap set it.
+	DefaultNamespaceConcurrency = 4
+
+	// DefaultListPageSize is the number of objects requested per page when
+	// listing namespaces and pods.
+	DefaultListPageSize = 500
+)
+
+// Controller holds the controller-wide settings read from
+// config-namespacecleaner.
+type Controller struct {
+	// MaxConcurrentNamespaces bounds the number of namespaces being cleaned
+	// at the same time, summed over all cleaners.
+	MaxConcurrentNamespaces int
+
+	// DefaultNamespaceConcurrency is the per-cleaner limit used when a
+	// NamespaceCleaner does not set spec.concurrency.
+	DefaultNamespaceConcurrency int
+
+	// ListPageSize is the Limit used for paginated list calls.
+	ListPageSize int64
+
+	// CloudEventsSink is the URI CloudEvents are posted to, empty when
+	// none are emitted.
+	CloudEventsSink string
+
+	// Audit selects where the audit log of every deletion is written.
+	Audit audit.Config
+
+	// AllowControllerIdentity lets NamespaceCleaners without
+	// spec.serviceAccountRef clean with the controller's own permissions.
+	// Otherwise they do not run.
+	AllowControllerIdentity bool
+}
+
+// DeepCopy returns a copy of the Controller config.
+func (c *Controller) DeepCopy() *Controller {
+	out := *c
+	return &out
+}
+
+// NewControllerConfigFromMap creates a Controller config from the supplied map.
+func NewControllerConfigFromMap(data map[string]string) (*Controller, error) {
+	c := &Controller{
+		MaxConcurrentNamespaces:     DefaultMaxConcurrentNamespaces,
+		DefaultNamespaceConcurrency: DefaultNamespaceConcurrency,
+		ListPageSize:                DefaultListPageSize,
+		Audit:                       audit.DefaultConfig(),
+	}
+
+	if err := cm.Parse(data,
+		cm.As(maxConcurrentNamespacesKey, &c.MaxConcurrentNamespaces),
+		cm.As(defaultNamespaceConcurrencyKey, &c.DefaultNamespaceConcurrency),
+		cm.As(listPageSizeKey, &c.ListPageSize),
+		cm.As(cloudEventsSinkKey, &c.CloudEventsSink),
+		cm.As(auditSinkKey, &c.Audit.Sink),
+		cm.As(auditFilePathKey, &c.Audit.Path),
+		cm.AsFunc(auditFileMaxSizeKey, &c.Audit.MaxSize, parseBytes),
+		cm.As(auditFileMaxBackupsKey, &c.Audit.MaxBackups),
+		cm.As(auditSyslogAddressKey, &c.Audit.SyslogAddress),
+		cm.As(auditKeyFileKey, &c.Audit.KeyFile),
+		cm.As(allowControllerIdentityKey, &c.AllowControllerIdentity),
+	); err != nil {
+		return nil, err
+	}
+
+	if c.MaxConcurrentNamespaces < 1 {
+		return nil, fmt.Errorf("%s must be at least 1, was %d", maxConcurrentNamespacesKey, c.MaxConcurrentNamespaces)
+	}
+	if c.DefaultNamespaceConcurrency < 1 {
+		return nil, fmt.Errorf("%s must be at least 1, was %d", defaultNamespaceConcurrencyKey, c.DefaultNamespaceConcurrency)
+	}
+
+	if c.ListPageSize < 1 {
+		return nil, fmt.Errorf("%s must be at least 1, was %d", listPageSizeKey, c.ListPageSize)
+	}
+
+	if c.CloudEventsSink != "" {
+		sink, err := url.Parse(c.CloudEventsSink)
+		if err != nil || (sink.Scheme != "http" && sink.Scheme != "https") || sink.Host == "" {
+			return nil, fmt.Errorf("%s must be an absolute http or https URI, was %q", cloudEventsSinkKey, c.CloudEventsSink)
+		}
+	}
+
+	if err := c.Audit.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid audit configuration: %w", err)
+	}
+
+	return c, nil
+}
+
+// parseBytes parses a quantity such as 100Mi as a number of bytes.
+func parseBytes(s string) (int64, error) {
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return 0, err
+	}
+	return q.Value(), nil
+}
+
+// NewControllerConfigFromConfigMap creates a Controller config from the
+// supplied ConfigMap.
+func NewControllerConfigFromConfigMap(configMap *corev1.ConfigMap) (*Controller, error) {
+	return NewControllerConfigFromMap(configMap.Data)
+}
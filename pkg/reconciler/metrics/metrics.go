@@ -0,0 +1,115 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics defines the OpenTelemetry instruments shared by the
+// cleaner reconcilers. They are exported through the meter provider that
+// sharedmain configures from config-observability.
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"knative.dev/pkg/observability/attributekey"
+)
+
+const scopeName = "github.com/infernus01/knative-demo/pkg/reconciler"
+
+// Outcomes of acting on a pod.
+const (
+	OutcomeDeleted = "deleted"
+	OutcomeSkipped = "skipped"
+	OutcomeFailed  = "failed"
+	// OutcomeBlocked means a PodDisruptionBudget refused the eviction.
+	OutcomeBlocked = "blocked"
+)
+
+// Reasons a pod deletion is skipped.
+const (
+	// SkipConflict means a delete precondition failed: the pod was
+	// recreated or changed after it was evaluated.
+	SkipConflict = "conflict"
+	// SkipNotFound means the pod was already gone.
+	SkipNotFound = "not_found"
+)
+
+// SkipReason reports whether a delete error means the deletion should be
+// skipped rather than failed, and why: the pod is gone, or a precondition
+// failed because it was recreated or changed since it was evaluated.
+func SkipReason(err error) (string, bool) {
+	switch {
+	case apierrs.IsNotFound(err):
+		return SkipNotFound, true
+	case apierrs.IsConflict(err):
+		return SkipConflict, true
+	default:
+		return "", false
+	}
+}
+
+var (
+	KindAttr    = attributekey.String("clusterops.cleaner.kind")
+	CleanerAttr = attributekey.String("clusterops.cleaner.name")
+	OutcomeAttr = attributekey.String("clusterops.pod.outcome")
+	ReasonAttr  = attributekey.String("clusterops.pod.skip_reason")
+)
+
+// Recorder records what the cleaners do to pods.
+type Recorder struct {
+	pods metric.Int64Counter
+}
+
+// NewRecorder creates the instruments from the global meter provider.
+func NewRecorder() *Recorder {
+	meter := otel.GetMeterProvider().Meter(scopeName)
+
+	pods, err := meter.Int64Counter(
+		"clusterops.cleaner.pods",
+		metric.WithDescription("The number of pods acted on by cleaners, by outcome."),
+		metric.WithUnit("{pod}"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Recorder{pods: pods}
+}
+
+// Deleted records a pod deleted by cleaner of the given kind.
+func (r *Recorder) Deleted(ctx context.Context, kind, cleaner string) {
+	r.pods.Add(ctx, 1, metric.WithAttributes(
+		KindAttr.With(kind), CleanerAttr.With(cleaner), OutcomeAttr.With(OutcomeDeleted)))
+}
+
+// Skipped records a pod deletion skipped for reason.
+func (r *Recorder) Skipped(ctx context.Context, kind, cleaner, reason string) {
+	r.pods.Add(ctx, 1, metric.WithAttributes(
+		KindAttr.With(kind), CleanerAttr.With(cleaner), OutcomeAttr.With(OutcomeSkipped), ReasonAttr.With(reason)))
+}
+
+// Failed records a pod that could not be deleted.
+func (r *Recorder) Failed(ctx context.Context, kind, cleaner string) {
+	r.pods.Add(ctx, 1, metric.WithAttributes(
+		KindAttr.With(kind), CleanerAttr.With(cleaner), OutcomeAttr.With(OutcomeFailed)))
+}
+
+// Blocked records a pod whose eviction a PodDisruptionBudget refused.
+func (r *Recorder) Blocked(ctx context.Context, kind, cleaner string) {
+	r.pods.Add(ctx, 1, metric.WithAttributes(
+		KindAttr.With(kind), CleanerAttr.With(cleaner), OutcomeAttr.With(OutcomeBlocked)))
+}
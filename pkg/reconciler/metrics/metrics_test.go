@@ -0,0 +1,72 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestSkipReason(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+
+	tests := []struct {
+		name   string
+		err    error
+		reason string
+		skip   bool
+	}{{
+		name: "deleted",
+	}, {
+		name:   "not found",
+		err:    apierrs.NewNotFound(pods, "build-1"),
+		reason: SkipNotFound,
+		skip:   true,
+	}, {
+		name:   "precondition failed",
+		err:    apierrs.NewConflict(pods, "build-1", errors.New("the UID in the precondition does not match")),
+		reason: SkipConflict,
+		skip:   true,
+	}, {
+		name:   "wrapped",
+		err:    fmt.Errorf("failed to delete pod: %w", apierrs.NewNotFound(pods, "build-1")),
+		reason: SkipNotFound,
+		skip:   true,
+	}, {
+		name: "forbidden",
+		err:  apierrs.NewForbidden(pods, "build-1", errors.New("denied")),
+	}, {
+		name: "too many requests",
+		err:  apierrs.NewTooManyRequests("disruption budget", 0),
+	}, {
+		name: "other",
+		err:  errors.New("connection refused"),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reason, skip := SkipReason(test.err)
+			if reason != test.reason || skip != test.skip {
+				t.Errorf("SkipReason() = %q, %v, want %q, %v", reason, skip, test.reason, test.skip)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/system"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/archive"
+)
+
+const (
+	// Keys of the credentials Secret referenced by spec.archive.s3.
+	accessKeyIDKey     = "accessKeyID"
+	secretAccessKeyKey = "secretAccessKey"
+)
+
+// archiverFor builds the Archiver configured by spec, or returns nil when
+// archiving is disabled.
+func (r *Reconciler) archiverFor(ctx context.Context, spec *v1alpha1.ArchiveSpec) (archive.Archiver, error) {
+	switch {
+	case spec == nil:
+		return nil, nil
+
+	case spec.Filesystem != nil && spec.S3 != nil:
+		return nil, fmt.Errorf("spec.archive must set only one of filesystem and s3")
+
+	case spec.Filesystem != nil:
+		if spec.Filesystem.Path == "" {
+			return nil, fmt.Errorf("spec.archive.filesystem.path must be set")
+		}
+		return archive.NewFilesystem(spec.Filesystem.Path), nil
+
+	case spec.S3 != nil:
+		secret, err := r.kubeclientset.CoreV1().Secrets(system.Namespace()).Get(ctx, spec.S3.CredentialsSecret, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get archive credentials: %w", err)
+		}
+		return archive.NewS3(spec.S3.Endpoint, spec.S3.Region, spec.S3.Bucket, spec.S3.Prefix,
+			string(secret.Data[accessKeyIDKey]), string(secret.Data[secretAccessKeyKey]))
+
+	default:
+		return nil, fmt.Errorf("spec.archive must set one of filesystem and s3")
+	}
+}
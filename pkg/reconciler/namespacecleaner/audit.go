@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/logging"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/audit"
+	"github.com/infernus01/knative-demo/pkg/policy"
+	"github.com/infernus01/knative-demo/pkg/reconciler/tracing"
+)
+
+// Annotations of the audit events recorded on a NamespaceCleaner for the
+// forceful actions it takes, so they can be told apart from other events.
+const (
+	auditPodAnnotation  = "clusterops.io/audit-pod"
+	auditUIDAnnotation  = "clusterops.io/audit-pod-uid"
+	auditRuleAnnotation = "clusterops.io/audit-rule"
+)
+
+// audit records on the cleaner why rule acted on pod.
+func (c *podCleanup) audit(pod *corev1.Pod, rule, message string) {
+	c.recorder.AnnotatedEventf(c.nc, map[string]string{
+		auditPodAnnotation:  pod.Namespace + "/" + pod.Name,
+		auditUIDAnnotation:  string(pod.UID),
+		auditRuleAnnotation: rule,
+	}, corev1.EventTypeNormal, "Audit", "%s acted on pod %s/%s: %s", rule, pod.Namespace, pod.Name, message)
+}
+
+// recordAudit appends rec, an action nc took by rule, to the audit log. An
+// audit record that cannot be written is an error of the namespace, the
+// action it records is not undone though.
+func (r *Reconciler) recordAudit(ctx context.Context, nc *v1alpha1.NamespaceCleaner, result *v1alpha1.NamespaceRunResult, rec audit.Record, rule, reason string) {
+	rec.CleanerKind = kind
+	rec.Cleaner = nc.Name
+	rec.Rule = rule
+	rec.Reason = reason
+	rec.Run = tracing.RunFrom(ctx)
+	rec.DryRun = nc.Spec.DryRun
+	if err := r.auditLog.Record(rec); err != nil {
+		logging.FromContext(ctx).Errorw("Failed to write audit record", zap.Error(err))
+		addError(&result.Errors, err)
+	}
+}
+
+// recordPod appends the deletion of pod as decided to the audit log, with
+// the location it was archived to, if any.
+func (c *podCleanup) recordPod(ctx context.Context, pod *corev1.Pod, decision policy.PodDecision, archived string) {
+	action := audit.ActionDelete
+	switch {
+	case decision.Rule == policy.RuleStuckTerminating:
+		action = audit.ActionForceDelete
+	case decision.Rule == policy.RuleOrphanedNode && c.nc.Spec.OrphanedNode.Force:
+		action = audit.ActionForceDelete
+	case decision.Rule == policy.RuleOrphanedNode:
+	case c.nc.Spec.Action == v1alpha1.PodActionEvict:
+		action = audit.ActionEvict
+	}
+	rec := audit.NewRecord(action, "v1", "Pod", pod)
+	rec.Archive = archived
+	c.recordAudit(ctx, c.nc, c.result, rec, decision.Rule, decision.Reason)
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/audit"
+	"github.com/infernus01/knative-demo/pkg/policy"
+)
+
+// handleBroken acts on a pod that crash loops or fails to pull its image as
+// spec.brokenPods.action says. Pods the action does not apply to, those with
+// a controller for Delete and those not owned by a Deployment for
+// ScaleOwnerToZero, are reported instead.
+func (c *podCleanup) handleBroken(ctx context.Context, pod *corev1.Pod, decision policy.PodDecision) {
+	owner, err := c.brokenOwner(ctx, pod)
+	if err := c.kube.check(err); err != nil {
+		addError(&c.result.Errors, fmt.Errorf("failed to find the owner of pod %s: %w", pod.Name, err))
+		return
+	}
+
+	// Each workload is acted on once per run, however many of its pods
+	// are broken.
+	if owner != nil {
+		key := owner.Kind + "/" + owner.Name
+		if c.brokenOwners.Has(key) {
+			if !c.nc.Spec.DryRun {
+				c.result.Broken++
+			}
+			return
+		}
+		c.brokenOwners.Insert(key)
+	}
+
+	switch action := c.nc.Spec.BrokenPods.GetAction(); {
+	case action == v1alpha1.BrokenPodActionDelete && owner == nil:
+		if c.deletePod(ctx, pod, decision) {
+			c.result.Broken++
+			c.audit(pod, decision.Rule, decision.Reason)
+		}
+	case action == v1alpha1.BrokenPodActionScaleOwnerToZero && isDeployment(owner):
+		c.scaleOwnerToZero(ctx, pod, owner, decision)
+	default:
+		c.reportBroken(ctx, pod, owner, decision)
+	}
+}
+
+// brokenOwner returns the workload pod belongs to: the Deployment of its
+// ReplicaSet if any, otherwise its controller, or nil for a bare pod.
+func (c *podCleanup) brokenOwner(ctx context.Context, pod *corev1.Pod) (*metav1.OwnerReference, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.APIVersion != "apps/v1" || owner.Kind != "ReplicaSet" {
+		return owner, nil
+	}
+	rs, err := c.kube.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if deployment := metav1.GetControllerOf(rs); isDeployment(deployment) {
+		return deployment, nil
+	}
+	return owner, nil
+}
+
+func isDeployment(owner *metav1.OwnerReference) bool {
+	return owner != nil && owner.APIVersion == "apps/v1" && owner.Kind == "Deployment"
+}
+
+// reportBroken records a warning event on pod and annotates its owner, or
+// the pod itself when it has none, with why. A pod stays reported as long as
+// the annotation names it, so later runs neither annotate nor announce it
+// again.
+func (c *podCleanup) reportBroken(ctx context.Context, pod *corev1.Pod, owner *metav1.OwnerReference, decision policy.PodDecision) {
+	if c.nc.Spec.DryRun {
+		c.logger.Infow("Dry run: would report broken pod",
+			zap.String("pod", pod.Name),
+			zap.String("reason", decision.Reason))
+		return
+	}
+
+	// The reason changes every run with how long the pod has been broken,
+	// only who reported which pod tells whether the report is current.
+	reported := fmt.Sprintf("pod %s reported by NamespaceCleaner %s: ", pod.Name, c.nc.Name)
+	current, err := c.brokenAnnotation(ctx, pod, owner)
+	if err != nil {
+		addError(&c.result.Errors, fmt.Errorf("failed to get the owner of pod %s: %w", pod.Name, err))
+		return
+	}
+	c.result.Broken++
+	if strings.HasPrefix(current, reported) {
+		return
+	}
+
+	c.logger.Infow("Reporting broken pod",
+		zap.String("pod", pod.Name),
+		zap.String("reason", decision.Reason))
+	c.recorder.Eventf(pod, corev1.EventTypeWarning, "BrokenPod",
+		"Reported by NamespaceCleaner %s: %s", c.nc.Name, decision.Reason)
+	if err := c.annotateOwner(ctx, pod, owner, reported+decision.Reason); err != nil {
+		c.logger.Errorw("Failed to annotate the owner of broken pod",
+			zap.String("pod", pod.Name),
+			zap.Error(err))
+		addError(&c.result.Errors, fmt.Errorf("failed to annotate the owner of pod %s: %w", pod.Name, err))
+	}
+}
+
+// scaleOwnerToZero scales the Deployment owning pod to zero replicas,
+// recording the replicas it had and why on the Deployment.
+func (c *podCleanup) scaleOwnerToZero(ctx context.Context, pod *corev1.Pod, owner *metav1.OwnerReference, decision policy.PodDecision) {
+	deployment, err := c.kube.AppsV1().Deployments(pod.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+	if err := c.kube.check(err); err != nil {
+		addError(&c.result.Errors, fmt.Errorf("failed to get Deployment %s: %w", owner.Name, err))
+		return
+	}
+	if deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == 0 {
+		return
+	}
+
+	record := audit.NewRecord(audit.ActionScaleToZero, "apps/v1", "Deployment", deployment)
+	if c.nc.Spec.DryRun {
+		c.logger.Infow("Dry run: would scale Deployment to zero",
+			zap.String("deployment", deployment.Name),
+			zap.String("pod", pod.Name),
+			zap.String("reason", decision.Reason))
+		c.recordAudit(ctx, c.nc, c.result, record, decision.Rule, decision.Reason)
+		return
+	}
+	c.result.Broken++
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	message := fmt.Sprintf("scaled to zero by NamespaceCleaner %s, pod %s: %s", c.nc.Name, pod.Name, decision.Reason)
+	c.logger.Infow("Scaling Deployment of broken pod to zero",
+		zap.String("deployment", deployment.Name),
+		zap.String("pod", pod.Name),
+		zap.Int32("replicas", replicas),
+		zap.String("reason", decision.Reason))
+
+	// One patch, guarded by the resourceVersion, scales and annotates the
+	// Deployment so neither happens without the other.
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": deployment.ResourceVersion,
+			"annotations": map[string]string{
+				v1alpha1.BrokenPodAnnotation:          message,
+				v1alpha1.ScaledFromReplicasAnnotation: strconv.Itoa(int(replicas)),
+			},
+		},
+		"spec": map[string]interface{}{
+			"replicas": 0,
+		},
+	})
+	if err != nil {
+		addError(&c.result.Errors, err)
+		return
+	}
+	_, err = c.kube.AppsV1().Deployments(pod.Namespace).Patch(ctx, deployment.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err := c.kube.check(err); err != nil {
+		c.logger.Errorw("Failed to scale Deployment to zero",
+			zap.String("deployment", deployment.Name),
+			zap.Error(err))
+		addError(&c.result.Errors, fmt.Errorf("failed to scale Deployment %s to zero: %w", deployment.Name, err))
+		return
+	}
+
+	c.recordAudit(ctx, c.nc, c.result, record, decision.Rule, decision.Reason)
+	c.recorder.Eventf(deployment, corev1.EventTypeWarning, "ScaledToZero",
+		"Scaled from %d to zero replicas by NamespaceCleaner %s: pod %s %s", replicas, c.nc.Name, pod.Name, decision.Reason)
+	c.audit(pod, decision.Rule, message)
+}
+
+// reportedKind returns the API version and kind of owner, or "" when it is
+// nil. Broken pods are reported on owners of the kinds the cleaner patches,
+// and on the pod itself otherwise.
+func reportedKind(owner *metav1.OwnerReference) string {
+	if owner == nil {
+		return ""
+	}
+	return owner.APIVersion + "/" + owner.Kind
+}
+
+// brokenAnnotation returns the BrokenPodAnnotation of the object pod is
+// reported on, see annotateOwner.
+func (c *podCleanup) brokenAnnotation(ctx context.Context, pod *corev1.Pod, owner *metav1.OwnerReference) (string, error) {
+	var (
+		obj metav1.Object
+		err error
+	)
+	opts := metav1.GetOptions{}
+	switch reportedKind(owner) {
+	case "apps/v1/Deployment":
+		obj, err = c.kube.AppsV1().Deployments(pod.Namespace).Get(ctx, owner.Name, opts)
+	case "apps/v1/ReplicaSet":
+		obj, err = c.kube.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, owner.Name, opts)
+	case "apps/v1/StatefulSet":
+		obj, err = c.kube.AppsV1().StatefulSets(pod.Namespace).Get(ctx, owner.Name, opts)
+	case "apps/v1/DaemonSet":
+		obj, err = c.kube.AppsV1().DaemonSets(pod.Namespace).Get(ctx, owner.Name, opts)
+	case "batch/v1/Job":
+		obj, err = c.kube.BatchV1().Jobs(pod.Namespace).Get(ctx, owner.Name, opts)
+	default:
+		obj = pod
+	}
+	if err := c.kube.check(err); err != nil {
+		return "", err
+	}
+	return obj.GetAnnotations()[v1alpha1.BrokenPodAnnotation], nil
+}
+
+// annotateOwner sets the BrokenPodAnnotation on owner, or on pod when it has
+// no owner or one of a kind the cleaner does not patch.
+func (c *podCleanup) annotateOwner(ctx context.Context, pod *corev1.Pod, owner *metav1.OwnerReference, message string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{v1alpha1.BrokenPodAnnotation: message},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	opts := metav1.PatchOptions{}
+	switch reportedKind(owner) {
+	case "apps/v1/Deployment":
+		_, err = c.kube.AppsV1().Deployments(pod.Namespace).Patch(ctx, owner.Name, types.MergePatchType, patch, opts)
+	case "apps/v1/ReplicaSet":
+		_, err = c.kube.AppsV1().ReplicaSets(pod.Namespace).Patch(ctx, owner.Name, types.MergePatchType, patch, opts)
+	case "apps/v1/StatefulSet":
+		_, err = c.kube.AppsV1().StatefulSets(pod.Namespace).Patch(ctx, owner.Name, types.MergePatchType, patch, opts)
+	case "apps/v1/DaemonSet":
+		_, err = c.kube.AppsV1().DaemonSets(pod.Namespace).Patch(ctx, owner.Name, types.MergePatchType, patch, opts)
+	case "batch/v1/Job":
+		_, err = c.kube.BatchV1().Jobs(pod.Namespace).Patch(ctx, owner.Name, types.MergePatchType, patch, opts)
+	default:
+		_, err = c.kube.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, opts)
+	}
+	return c.kube.check(err)
+}
@@ -0,0 +1,258 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgotesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/audit"
+	"github.com/infernus01/knative-demo/pkg/policy"
+)
+
+var brokenDecision = policy.PodDecision{Delete: true, Rule: policy.RuleBrokenPod, Reason: "container web in CrashLoopBackOff"}
+
+// brokenCleanup returns the cleanup of namespace ci by a cleaner acting on
+// broken pods with action, along with its client and recorder.
+func brokenCleanup(t *testing.T, action v1alpha1.BrokenPodAction, dryRun bool, objects ...runtime.Object) (*podCleanup, *fake.Clientset, *record.FakeRecorder) {
+	t.Helper()
+	auditLog := audit.NewLog()
+	if err := auditLog.Configure(audit.Config{Sink: audit.SinkNone}); err != nil {
+		t.Fatal("Configure() =", err)
+	}
+	client := fake.NewClientset(objects...)
+	recorder := record.NewFakeRecorder(10)
+	c := &podCleanup{
+		Reconciler: &Reconciler{auditLog: auditLog},
+		nc: &v1alpha1.NamespaceCleaner{
+			ObjectMeta: metav1.ObjectMeta{Name: "crashes"},
+			Spec: v1alpha1.NamespaceCleanerSpec{
+				DryRun:     dryRun,
+				BrokenPods: &v1alpha1.BrokenPodPolicy{Action: action},
+			},
+		},
+		kube:         &cleanerClient{Interface: client},
+		result:       &v1alpha1.NamespaceRunResult{},
+		logger:       logtesting.TestLogger(t),
+		recorder:     recorder,
+		brokenOwners: sets.New[string](),
+	}
+	return c, client, recorder
+}
+
+func controllerRef(apiVersion, kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: name, Controller: &controller}}
+}
+
+func brokenPod(name string, owners []metav1.OwnerReference) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: name, OwnerReferences: owners}}
+}
+
+func deploymentWithReplicaSet(apiVersion string, replicas int32) (*appsv1.Deployment, *appsv1.ReplicaSet) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "web"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+	rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Namespace:       "ci",
+		Name:            "web-7d4b9",
+		OwnerReferences: controllerRef(apiVersion, "Deployment", "web"),
+	}}
+	return deployment, rs
+}
+
+// patches returns the resources of the patches made through client.
+func patches(client *fake.Clientset) []string {
+	var resources []string
+	for _, action := range client.Actions() {
+		if patch, ok := action.(clientgotesting.PatchAction); ok {
+			resources = append(resources, patch.GetResource().Resource+"/"+patch.GetName())
+		}
+	}
+	return resources
+}
+
+func TestScaleOwnerToZero(t *testing.T) {
+	ctx := logtesting.TestContextWithLogger(t)
+	deployment, rs := deploymentWithReplicaSet("apps/v1", 3)
+	pods := []*corev1.Pod{
+		brokenPod("web-7d4b9-a", controllerRef("apps/v1", "ReplicaSet", rs.Name)),
+		brokenPod("web-7d4b9-b", controllerRef("apps/v1", "ReplicaSet", rs.Name)),
+	}
+	c, client, recorder := brokenCleanup(t, v1alpha1.BrokenPodActionScaleOwnerToZero, false, deployment, rs)
+
+	for _, pod := range pods {
+		c.handleBroken(ctx, pod, brokenDecision)
+	}
+
+	got, err := client.AppsV1().Deployments("ci").Get(ctx, "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("Get(Deployment) =", err)
+	}
+	if *got.Spec.Replicas != 0 {
+		t.Errorf("replicas = %d, want 0", *got.Spec.Replicas)
+	}
+	if scaledFrom := got.Annotations[v1alpha1.ScaledFromReplicasAnnotation]; scaledFrom != "3" {
+		t.Errorf("scaled-from annotation = %q, want 3", scaledFrom)
+	}
+	if got.Annotations[v1alpha1.BrokenPodAnnotation] == "" {
+		t.Error("broken-pod annotation not set")
+	}
+	// The Deployment is scaled once, for both of its pods.
+	if got := patches(client); len(got) != 1 {
+		t.Errorf("patches = %v, want the Deployment once", got)
+	}
+	if c.result.Broken != 2 || len(c.result.Errors) != 0 {
+		t.Errorf("result = %+v, want 2 broken pods", c.result)
+	}
+	// The ScaledToZero event on the Deployment, and the audit event.
+	if len(recorder.Events) != 2 {
+		t.Errorf("recorded %d events, want 2", len(recorder.Events))
+	}
+
+	// A later run finds the Deployment scaled down already.
+	c, client, _ = brokenCleanup(t, v1alpha1.BrokenPodActionScaleOwnerToZero, false, got, rs)
+	c.handleBroken(ctx, pods[0], brokenDecision)
+	if got := patches(client); len(got) != 0 {
+		t.Errorf("patches = %v, want none once scaled to zero", got)
+	}
+}
+
+func TestScaleOwnerToZeroReports(t *testing.T) {
+	ctx := logtesting.TestContextWithLogger(t)
+	foreign, foreignRS := deploymentWithReplicaSet("example.com/v1", 3)
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		pod     *corev1.Pod
+		// reported is the object annotated instead of scaling.
+		reported string
+	}{{
+		name:     "statefulset",
+		objects:  []runtime.Object{&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "db"}}},
+		pod:      brokenPod("db-0", controllerRef("apps/v1", "StatefulSet", "db")),
+		reported: "statefulsets/db",
+	}, {
+		name:     "deployment of another group",
+		objects:  []runtime.Object{foreign, foreignRS},
+		pod:      brokenPod("web-7d4b9-a", controllerRef("apps/v1", "ReplicaSet", foreignRS.Name)),
+		reported: "replicasets/web-7d4b9",
+	}, {
+		name:     "bare pod",
+		pod:      brokenPod("debug", nil),
+		reported: "pods/debug",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objects := append(test.objects, test.pod)
+			c, client, recorder := brokenCleanup(t, v1alpha1.BrokenPodActionScaleOwnerToZero, false, objects...)
+			c.handleBroken(ctx, test.pod, brokenDecision)
+
+			got := patches(client)
+			if len(got) != 1 || got[0] != test.reported {
+				t.Errorf("patches = %v, want %s annotated", got, test.reported)
+			}
+			if len(recorder.Events) != 1 {
+				t.Errorf("recorded %d events, want the BrokenPod event", len(recorder.Events))
+			}
+			if c.result.Broken != 1 {
+				t.Errorf("broken = %d, want 1", c.result.Broken)
+			}
+		})
+	}
+}
+
+func TestReportBrokenOnce(t *testing.T) {
+	ctx := logtesting.TestContextWithLogger(t)
+	pod := brokenPod("db-0", controllerRef("apps/v1", "StatefulSet", "db"))
+	c, client, recorder := brokenCleanup(t, v1alpha1.BrokenPodActionReport, false,
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "db"}}, pod)
+
+	c.handleBroken(ctx, pod, brokenDecision)
+	if got := patches(client); len(got) != 1 || len(recorder.Events) != 1 {
+		t.Fatalf("first run: patches = %v, %d events, want the StatefulSet annotated once", got, len(recorder.Events))
+	}
+
+	// The next run, the pod has been broken for longer but is reported
+	// already.
+	client.ClearActions()
+	c.brokenOwners.Clear()
+	later := brokenDecision
+	later.Reason += ", not ready for 7h"
+	c.handleBroken(ctx, pod, later)
+	if got := patches(client); len(got) != 0 || len(recorder.Events) != 1 {
+		t.Errorf("second run: patches = %v, %d events, want none", got, len(recorder.Events))
+	}
+	if c.result.Broken != 2 {
+		t.Errorf("broken = %d, want the pod counted each run", c.result.Broken)
+	}
+
+	// Another pod of the StatefulSet is reported in turn.
+	other := brokenPod("db-1", pod.OwnerReferences)
+	c.brokenOwners.Clear()
+	c.handleBroken(ctx, other, brokenDecision)
+	if got := patches(client); len(got) != 1 || len(recorder.Events) != 2 {
+		t.Errorf("other pod: patches = %v, %d events, want it reported", got, len(recorder.Events))
+	}
+}
+
+func TestBrokenDryRun(t *testing.T) {
+	for _, action := range []v1alpha1.BrokenPodAction{
+		v1alpha1.BrokenPodActionReport,
+		v1alpha1.BrokenPodActionDelete,
+		v1alpha1.BrokenPodActionScaleOwnerToZero,
+	} {
+		t.Run(string(action), func(t *testing.T) {
+			ctx := logtesting.TestContextWithLogger(t)
+			deployment, rs := deploymentWithReplicaSet("apps/v1", 3)
+			pods := []*corev1.Pod{
+				brokenPod("web-7d4b9-a", controllerRef("apps/v1", "ReplicaSet", rs.Name)),
+				brokenPod("web-7d4b9-b", controllerRef("apps/v1", "ReplicaSet", rs.Name)),
+				brokenPod("debug", nil),
+			}
+			c, client, recorder := brokenCleanup(t, action, true, deployment, rs, pods[0], pods[1], pods[2])
+
+			for _, pod := range pods {
+				c.handleBroken(ctx, pod, brokenDecision)
+			}
+			for _, a := range client.Actions() {
+				if a.GetVerb() != "get" {
+					t.Errorf("dry run made a %s of %s", a.GetVerb(), a.GetResource().Resource)
+				}
+			}
+			if len(recorder.Events) != 0 {
+				t.Errorf("dry run recorded %d events", len(recorder.Events))
+			}
+			if c.result.Broken != 0 {
+				t.Errorf("dry run counted %d broken pods", c.result.Broken)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/cloudevents"
+)
+
+// runData is the payload of run.started, run.completed and run.failed events.
+type runData struct {
+	Cleaner        string              `json:"cleaner"`
+	Run            string              `json:"run"`
+	Trigger        v1alpha1.RunTrigger `json:"trigger"`
+	DryRun         bool                `json:"dryRun,omitempty"`
+	Phase          v1alpha1.RunPhase   `json:"phase"`
+	StartTime      *metav1.Time        `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time        `json:"completionTime,omitempty"`
+	Namespaces     int                 `json:"namespaces"`
+	TotalDeleted   int32               `json:"totalDeleted"`
+	TotalSkipped   int32               `json:"totalSkipped"`
+	TotalBlocked   int32               `json:"totalBlocked"`
+	Errors         []string            `json:"errors,omitempty"`
+}
+
+// eventSource identifies nc as the source of CloudEvents.
+func eventSource(nc *v1alpha1.NamespaceCleaner) string {
+	return "/apis/" + v1alpha1.SchemeGroupVersion.String() + "/namespacecleaners/" + nc.Name
+}
+
+// runEvent builds the CloudEvent of type about run of nc.
+func runEvent(eventType string, nc *v1alpha1.NamespaceCleaner, run *v1alpha1.CleanupRun) cloudevents.Event {
+	return cloudevents.Event{
+		Type:    eventType,
+		Source:  eventSource(nc),
+		Subject: run.Name,
+		Data: runData{
+			Cleaner:        nc.Name,
+			Run:            run.Name,
+			Trigger:        run.Spec.Trigger,
+			DryRun:         run.Spec.DryRun,
+			Phase:          run.Status.Phase,
+			StartTime:      run.Status.StartTime,
+			CompletionTime: run.Status.CompletionTime,
+			Namespaces:     len(run.Status.Namespaces),
+			TotalDeleted:   run.Status.TotalDeleted,
+			TotalSkipped:   run.Status.TotalSkipped,
+			TotalBlocked:   run.Status.TotalBlocked,
+			Errors:         run.Status.Errors,
+		},
+	}
+}
@@ -19,13 +19,31 @@ package namespacecleaner
 import (
 	"context"
 
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
+	"knative.dev/pkg/injection"
+	"knative.dev/pkg/injection/clients/dynamicclient"
 	"knative.dev/pkg/logging"
 
+	"github.com/infernus01/knative-demo/pkg/audit"
+	"github.com/infernus01/knative-demo/pkg/cloudevents"
+	versionedscheme "github.com/infernus01/knative-demo/pkg/generated/clientset/versioned/scheme"
+	"github.com/infernus01/knative-demo/pkg/reconciler/config"
+	"github.com/infernus01/knative-demo/pkg/reconciler/metrics"
+
+	clusteropsclient "github.com/infernus01/knative-demo/pkg/client/injection/client"
+	cleanupruninformer "github.com/infernus01/knative-demo/pkg/client/injection/informers/clusterops/v1alpha1/cleanuprun"
 	namespacecleanerinformer "github.com/infernus01/knative-demo/pkg/client/injection/informers/clusterops/v1alpha1/namespacecleaner"
 
 	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	nodeinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/node"
 )
 
 const (
@@ -34,6 +52,11 @@ const (
 	controllerAgentName = "namespacecleaner-controller"
 )
 
+func init() {
+	// Register our types so events can reference NamespaceCleaners.
+	utilruntime.Must(versionedscheme.AddToScheme(scheme.Scheme))
+}
+
 // NewController creates a Reconciler and returns the result of NewImpl.
 func NewController(
 	ctx context.Context,
@@ -42,13 +65,68 @@ func NewController(
 	logger := logging.FromContext(ctx)
 
 	namespacecleanerInformer := namespacecleanerinformer.Get(ctx)
+	cleanuprunInformer := cleanupruninformer.Get(ctx)
+
+	recorder := controller.GetEventRecorder(ctx)
+	if recorder == nil {
+		logger.Debug("Creating event broadcaster")
+		eventBroadcaster := record.NewBroadcaster()
+		watches := []watch.Interface{
+			eventBroadcaster.StartLogging(logger.Named("event-broadcaster").Infof),
+			eventBroadcaster.StartRecordingToSink(
+				&typedcorev1.EventSinkImpl{Interface: kubeclient.Get(ctx).CoreV1().Events("")}),
+		}
+		recorder = eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
+		go func() {
+			<-ctx.Done()
+			for _, w := range watches {
+				w.Stop()
+			}
+		}()
+	}
 
 	c := &Reconciler{
 		kubeclientset:          kubeclient.Get(ctx),
+		dynamicclientset:       dynamicclient.Get(ctx),
+		clientset:              clusteropsclient.Get(ctx),
+		restConfig:             injection.GetConfig(ctx),
+		impersonated:           make(map[string]clients),
 		namespacecleanerLister: namespacecleanerInformer.Lister(),
+		cleanuprunLister:       cleanuprunInformer.Lister(),
+		nodeLister:             nodeinformer.Get(ctx).Lister(),
+		recorder:               recorder,
+		metrics:                metrics.NewRecorder(),
+		auditLog:               audit.Default,
+		events:                 cloudevents.NewEmitter(logger.Named("cloudevents")),
+		limiter:                newFairLimiter(config.DefaultMaxConcurrentNamespaces),
 	}
+	c.PromoteFunc = c.promote
+	c.DemoteFunc = c.demote
+	go c.events.Run(ctx)
+
+	// The ConfigMap watcher starts after the controller is built, so impl is
+	// set before the first update.
+	var impl *controller.Impl
+	allowControllerIdentity := false
+	configStore := config.NewStore(logger.Named("config-store"), func(name string, value interface{}) {
+		if cfg, ok := value.(*config.Controller); ok {
+			// Cleaners skipped for lack of a ServiceAccount run as soon as
+			// the controller may act for them.
+			if cfg.AllowControllerIdentity != allowControllerIdentity {
+				allowControllerIdentity = cfg.AllowControllerIdentity
+				impl.GlobalResync(namespacecleanerInformer.Informer())
+			}
+			c.limiter.SetLimit(cfg.MaxConcurrentNamespaces)
+			c.events.SetSink(cfg.CloudEventsSink)
+			if err := c.auditLog.Configure(cfg.Audit); err != nil {
+				logger.Errorw("Failed to configure the audit log", zap.Error(err))
+			}
+		}
+	})
+	configStore.WatchConfigs(cmw)
+	c.configStore = configStore
 
-	impl := controller.NewContext(ctx, c, controller.ControllerOptions{
+	impl = controller.NewContext(ctx, c, controller.ControllerOptions{
 		WorkQueueName: controllerAgentName,
 		Logger:        logger,
 	})
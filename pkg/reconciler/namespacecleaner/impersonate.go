@@ -0,0 +1,179 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/reconciler/config"
+)
+
+// clients are the clients a cleaner acts through.
+type clients struct {
+	kube    kubernetes.Interface
+	dynamic dynamic.Interface
+}
+
+// cleanerClient is the kube client a cleaner lists and deletes through. It
+// remembers the requests that RBAC denied during a run.
+type cleanerClient struct {
+	kubernetes.Interface
+
+	// dynamic reaches the resources without a typed client, such as
+	// VolumeSnapshots, as the same user.
+	dynamic dynamic.Interface
+
+	// username the requests are made as, empty for the controller itself.
+	username string
+
+	mu        sync.Mutex
+	forbidden int
+	first     error
+}
+
+// check records err if it is a Forbidden error and returns it unchanged.
+func (c *cleanerClient) check(err error) error {
+	if apierrs.IsForbidden(err) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.forbidden == 0 {
+			c.first = err
+		}
+		c.forbidden++
+	}
+	return err
+}
+
+// clientFor returns the client nc acts through: one impersonating
+// spec.serviceAccountRef so that the ServiceAccount's RBAC bounds what the
+// cleaner may touch, or the controller's own client when the ref is unset,
+// which reconcileServiceAccount only lets through if allow-controller-identity
+// is set.
+func (r *Reconciler) clientFor(nc *v1alpha1.NamespaceCleaner) (*cleanerClient, error) {
+	ref := nc.Spec.ServiceAccountRef
+	if ref == nil {
+		return &cleanerClient{Interface: r.kubeclientset, dynamic: r.dynamicclientset}, nil
+	}
+
+	username := ref.Username()
+	r.impersonatedMu.Lock()
+	defer r.impersonatedMu.Unlock()
+	if c, ok := r.impersonated[username]; ok {
+		return &cleanerClient{Interface: c.kube, dynamic: c.dynamic, username: username}, nil
+	}
+
+	// The API server adds the ServiceAccount's groups when impersonating
+	// its username, so group bindings apply as well.
+	cfg := rest.CopyConfig(r.restConfig)
+	cfg.Impersonate = rest.ImpersonationConfig{UserName: username}
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client impersonating %s: %w", username, err)
+	}
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client impersonating %s: %w", username, err)
+	}
+	r.impersonated[username] = clients{kube: kube, dynamic: dyn}
+	return &cleanerClient{Interface: kube, dynamic: dyn, username: username}, nil
+}
+
+// reconcileServiceAccount sets the NoServiceAccount condition, warning when it
+// becomes True, and reports whether nc may run: it must reference a
+// ServiceAccount unless the controller may clean with its own permissions.
+func (r *Reconciler) reconcileServiceAccount(ctx context.Context, nc *v1alpha1.NamespaceCleaner) (bool, error) {
+	allowed := nc.Spec.ServiceAccountRef != nil || config.FromContextOrDefaults(ctx).Controller.AllowControllerIdentity
+
+	condition := metav1.Condition{
+		Type:               v1alpha1.ConditionNoServiceAccount,
+		Status:             metav1.ConditionFalse,
+		Reason:             "ServiceAccountSet",
+		Message:            "The cleaner acts as spec.serviceAccountRef",
+		ObservedGeneration: nc.Generation,
+	}
+	if nc.Spec.ServiceAccountRef == nil {
+		condition.Reason = "ControllerIdentity"
+		condition.Message = "The cleaner acts with the controller's own permissions, allowed by allow-controller-identity"
+	}
+	if !allowed {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "ServiceAccountRequired"
+		condition.Message = "Not running: spec.serviceAccountRef is unset and allow-controller-identity is not set"
+
+		if !meta.IsStatusConditionTrue(nc.Status.Conditions, condition.Type) {
+			r.recorder.Event(nc, corev1.EventTypeWarning, "NoServiceAccount", condition.Message)
+		}
+	}
+
+	current := meta.FindStatusCondition(nc.Status.Conditions, condition.Type)
+	if current != nil && current.Status == condition.Status && current.Message == condition.Message &&
+		current.ObservedGeneration == condition.ObservedGeneration {
+		return allowed, nil
+	}
+	return allowed, r.updateStatus(ctx, nc.Name, func(status *v1alpha1.NamespaceCleanerStatus) {
+		meta.SetStatusCondition(&status.Conditions, condition)
+	})
+}
+
+// reconcileForbidden sets the Forbidden condition from the requests denied
+// to client during the last run, warning when it becomes True.
+func (r *Reconciler) reconcileForbidden(ctx context.Context, nc *v1alpha1.NamespaceCleaner, client *cleanerClient) error {
+	client.mu.Lock()
+	forbidden, first := client.forbidden, client.first
+	client.mu.Unlock()
+
+	condition := metav1.Condition{
+		Type:               v1alpha1.ConditionForbidden,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Permitted",
+		Message:            "No request was denied during the last run",
+		ObservedGeneration: nc.Generation,
+	}
+	if forbidden > 0 {
+		subject := "the controller"
+		if client.username != "" {
+			subject = client.username
+		}
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "RBACDenied"
+		condition.Message = fmt.Sprintf("%d requests made as %s were denied during the last run, first: %v", forbidden, subject, first)
+
+		if !meta.IsStatusConditionTrue(nc.Status.Conditions, condition.Type) {
+			r.recorder.Event(nc, corev1.EventTypeWarning, "Forbidden", condition.Message)
+		}
+	}
+
+	current := meta.FindStatusCondition(nc.Status.Conditions, condition.Type)
+	if current != nil && current.Status == condition.Status && current.Message == condition.Message &&
+		current.ObservedGeneration == condition.ObservedGeneration {
+		return nil
+	}
+	return r.updateStatus(ctx, nc.Name, func(status *v1alpha1.NamespaceCleanerStatus) {
+		meta.SetStatusCondition(&status.Conditions, condition)
+	})
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"context"
+	"sync"
+)
+
+// fairLimiter bounds the number of namespaces being cleaned at the same time
+// across all cleaners. Free slots are handed out round-robin between the
+// cleaners that are waiting, so a cleaner matching hundreds of namespaces
+// cannot starve the others.
+type fairLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	active int
+
+	// owners lists the cleaners with pending waiters in round-robin order,
+	// next is the index of the owner served by the next free slot.
+	owners  []string
+	next    int
+	waiters map[string][]chan struct{}
+}
+
+func newFairLimiter(limit int) *fairLimiter {
+	return &fairLimiter{
+		limit:   limit,
+		waiters: make(map[string][]chan struct{}),
+	}
+}
+
+// SetLimit changes the number of slots, e.g. after the controller ConfigMap
+// was updated. Running holders are not interrupted when the limit shrinks.
+func (l *fairLimiter) SetLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = limit
+	l.dispatchLocked()
+}
+
+// Acquire blocks until a slot is granted to owner or ctx is done. Every
+// successful Acquire must be paired with a Release.
+func (l *fairLimiter) Acquire(ctx context.Context, owner string) error {
+	ready := make(chan struct{})
+
+	l.mu.Lock()
+	if len(l.waiters[owner]) == 0 {
+		l.owners = append(l.owners, owner)
+	}
+	l.waiters[owner] = append(l.waiters[owner], ready)
+	l.dispatchLocked()
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-ready:
+		// The slot was granted while we were giving up, hand it back.
+		l.active--
+		l.dispatchLocked()
+	default:
+		l.removeWaiterLocked(owner, ready)
+	}
+	return ctx.Err()
+}
+
+// Release returns a slot obtained through Acquire.
+func (l *fairLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	l.dispatchLocked()
+}
+
+func (l *fairLimiter) dispatchLocked() {
+	for l.active < l.limit && len(l.owners) > 0 {
+		if l.next >= len(l.owners) {
+			l.next = 0
+		}
+		owner := l.owners[l.next]
+		queue := l.waiters[owner]
+
+		close(queue[0])
+		l.active++
+
+		if len(queue) == 1 {
+			// The owner has no more waiters, so it leaves the rotation and
+			// next already points at the following owner.
+			delete(l.waiters, owner)
+			l.owners = append(l.owners[:l.next], l.owners[l.next+1:]...)
+		} else {
+			l.waiters[owner] = queue[1:]
+			l.next++
+		}
+	}
+}
+
+func (l *fairLimiter) removeWaiterLocked(owner string, ready chan struct{}) {
+	queue := l.waiters[owner]
+	for i, ch := range queue {
+		if ch == ready {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(queue) > 0 {
+		l.waiters[owner] = queue
+		return
+	}
+
+	delete(l.waiters, owner)
+	for i, o := range l.owners {
+		if o == owner {
+			l.owners = append(l.owners[:i], l.owners[i+1:]...)
+			if i < l.next {
+				l.next--
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// grant is the outcome of an Acquire made in the background.
+type grant struct {
+	owner string
+	err   error
+}
+
+// acquire calls Acquire for owner in the background, returning once it is
+// queued or granted, and sends the outcome to granted.
+func acquire(t *testing.T, ctx context.Context, l *fairLimiter, owner string, granted chan<- grant) {
+	t.Helper()
+	l.mu.Lock()
+	queued, active := len(l.waiters[owner]), l.active
+	l.mu.Unlock()
+
+	go func() {
+		granted <- grant{owner: owner, err: l.Acquire(ctx, owner)}
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		done := len(l.waiters[owner]) > queued || l.active > active
+		l.mu.Unlock()
+		if done {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Acquire(%s) neither queued nor granted", owner)
+}
+
+func next(t *testing.T, granted <-chan grant) grant {
+	t.Helper()
+	select {
+	case g := <-granted:
+		return g
+	case <-time.After(5 * time.Second):
+		t.Fatal("no Acquire returned")
+		return grant{}
+	}
+}
+
+func none(t *testing.T, granted <-chan grant) {
+	t.Helper()
+	select {
+	case g := <-granted:
+		t.Fatalf("Acquire(%s) returned %v, want it to wait", g.owner, g.err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFairLimiterRoundRobin(t *testing.T) {
+	l := newFairLimiter(1)
+	granted := make(chan grant, 10)
+	ctx := context.Background()
+
+	acquire(t, ctx, l, "a", granted)
+	if g := next(t, granted); g.err != nil {
+		t.Fatalf("Acquire(a) = %v", g.err)
+	}
+	// a queues many namespaces before b and c queue one each.
+	for _, owner := range []string{"a", "a", "a", "b", "c"} {
+		acquire(t, ctx, l, owner, granted)
+	}
+	none(t, granted)
+
+	var order []string
+	for range 5 {
+		l.Release()
+		g := next(t, granted)
+		if g.err != nil {
+			t.Fatalf("Acquire(%s) = %v", g.owner, g.err)
+		}
+		order = append(order, g.owner)
+	}
+	want := []string{"a", "b", "c", "a", "a"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("slots granted to %v, want %v", order, want)
+		}
+	}
+}
+
+func TestFairLimiterSetLimit(t *testing.T) {
+	l := newFairLimiter(1)
+	granted := make(chan grant, 10)
+	ctx := context.Background()
+
+	acquire(t, ctx, l, "a", granted)
+	next(t, granted)
+	acquire(t, ctx, l, "a", granted)
+	acquire(t, ctx, l, "b", granted)
+	none(t, granted)
+
+	// Raising the limit grants the waiting slots right away.
+	l.SetLimit(3)
+	next(t, granted)
+	next(t, granted)
+
+	// Lowering it interrupts no holder, but holds new waiters back until
+	// the holders are below the new limit.
+	l.SetLimit(1)
+	acquire(t, ctx, l, "c", granted)
+	l.Release()
+	none(t, granted)
+	l.Release()
+	none(t, granted)
+	l.Release()
+	if g := next(t, granted); g.owner != "c" || g.err != nil {
+		t.Errorf("Acquire(%s) = %v, want c granted", g.owner, g.err)
+	}
+}
+
+func TestFairLimiterCancel(t *testing.T) {
+	l := newFairLimiter(1)
+	granted := make(chan grant, 10)
+	ctx := context.Background()
+
+	acquire(t, ctx, l, "holder", granted)
+	next(t, granted)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	acquire(t, ctx, l, "a", granted)
+	acquire(t, cancelled, l, "b", granted)
+	acquire(t, ctx, l, "c", granted)
+
+	cancel()
+	if g := next(t, granted); g.owner != "b" || !errors.Is(g.err, context.Canceled) {
+		t.Fatalf("Acquire(%s) = %v, want b cancelled", g.owner, g.err)
+	}
+
+	// The cancelled waiter left the rotation without taking a slot or
+	// costing another owner its turn.
+	for _, want := range []string{"a", "c"} {
+		l.Release()
+		if g := next(t, granted); g.owner != want || g.err != nil {
+			t.Fatalf("Acquire(%s) = %v, want %s granted", g.owner, g.err, want)
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active != 1 || len(l.owners) != 0 || len(l.waiters) != 0 {
+		t.Errorf("active %d, owners %v, waiters %v, want 1 slot held and nothing waiting", l.active, l.owners, l.waiters)
+	}
+}
+
+func TestFairLimiterCancelGranted(t *testing.T) {
+	l := newFairLimiter(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The free slot is granted while Acquire sees ctx done. Whichever it
+	// notices first, the slot is either held or handed back.
+	for range 100 {
+		if err := l.Acquire(ctx, "a"); err == nil {
+			l.Release()
+		} else if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Acquire() = %v, want nil or context.Canceled", err)
+		}
+		l.mu.Lock()
+		active, waiters := l.active, len(l.waiters)
+		l.mu.Unlock()
+		if active != 0 || waiters != 0 {
+			t.Fatalf("active %d, %d owners waiting, want the slot free", active, waiters)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/infernus01/knative-demo/pkg/reconciler/paging"
+	"github.com/infernus01/knative-demo/pkg/reconciler/tracing"
+)
+
+// forEachNamespace lists namespaces page by page and calls visit for each of
+// them. Returning an error from visit stops the listing.
+func forEachNamespace(ctx context.Context, client kubernetes.Interface, pageSize int64, visit func(*corev1.Namespace) error) error {
+	return paging.Paginate(ctx, metav1.ListOptions{Limit: pageSize}, func(opts metav1.ListOptions) (string, error) {
+		ctx, span := tracing.Tracer.Start(ctx, "ListNamespaces", trace.WithSpanKind(trace.SpanKindClient))
+		list, err := client.CoreV1().Namespaces().List(ctx, opts)
+		tracing.EndSpan(span, err)
+		if err != nil {
+			return "", err
+		}
+		for i := range list.Items {
+			if err := visit(&list.Items[i]); err != nil {
+				return "", err
+			}
+		}
+		return list.Continue, nil
+	})
+}
+
+// forEachPod lists the pods of namespace matching fieldSelector page by page
+// and calls visit for each of them. Returning an error from visit stops the
+// listing.
+func forEachPod(ctx context.Context, client kubernetes.Interface, namespace, fieldSelector string, pageSize int64, visit func(*corev1.Pod) error) error {
+	opts := metav1.ListOptions{
+		FieldSelector: fieldSelector,
+		Limit:         pageSize,
+	}
+	err := paging.Paginate(ctx, opts, func(opts metav1.ListOptions) (string, error) {
+		list, err := client.CoreV1().Pods(namespace).List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+		for i := range list.Items {
+			if err := visit(&list.Items[i]); err != nil {
+				return "", err
+			}
+		}
+		return list.Continue, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pods in namespace %s: %w", namespace, err)
+	}
+	return nil
+}
+
+// forEachItem lists objects page by page with list, which returns the items
+// and continue token of a page, and calls visit for each of them. Returning
+// an error from visit stops the listing.
+func forEachItem[T any](ctx context.Context, pageSize int64, list func(metav1.ListOptions) ([]T, string, error), visit func(*T) error) error {
+	return paging.Paginate(ctx, metav1.ListOptions{Limit: pageSize}, func(opts metav1.ListOptions) (string, error) {
+		items, next, err := list(opts)
+		if err != nil {
+			return "", err
+		}
+		for i := range items {
+			if err := visit(&items[i]); err != nil {
+				return "", err
+			}
+		}
+		return next, nil
+	})
+}
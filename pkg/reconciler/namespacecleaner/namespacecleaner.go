@@ -19,26 +19,86 @@ package namespacecleaner
 import (
 	"context"
 	"fmt"
-	"strings"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/reconciler"
 
 	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/audit"
+	"github.com/infernus01/knative-demo/pkg/cloudevents"
+	versioned "github.com/infernus01/knative-demo/pkg/generated/clientset/versioned"
 	namespacecleanerlister "github.com/infernus01/knative-demo/pkg/generated/listers/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/policy"
+	"github.com/infernus01/knative-demo/pkg/reconciler/config"
+	"github.com/infernus01/knative-demo/pkg/reconciler/metrics"
+	"github.com/infernus01/knative-demo/pkg/reconciler/tracing"
 )
 
+// kind identifies NamespaceCleaners in metrics.
+const kind = "NamespaceCleaner"
+
 // Reconciler implements controller.Reconciler for NamespaceCleaner resources.
 type Reconciler struct {
+	// LeaderAwareFuncs tracks the buckets this replica currently leads, so
+	// that each NamespaceCleaner is only ever cleaned by a single replica.
+	reconciler.LeaderAwareFuncs
+
 	kubeclientset          kubernetes.Interface
+	dynamicclientset       dynamic.Interface
+	clientset              versioned.Interface
 	namespacecleanerLister namespacecleanerlister.NamespaceCleanerLister
+	cleanuprunLister       namespacecleanerlister.CleanupRunLister
+	nodeLister             corelisters.NodeLister
+
+	// restConfig is the controller's client config, from which the clients
+	// impersonating each cleaner's ServiceAccount are built and cached.
+	restConfig     *rest.Config
+	impersonatedMu sync.Mutex
+	impersonated   map[string]clients
+
+	// recorder emits the Kubernetes events that serve as audit records.
+	recorder record.EventRecorder
+
+	// configStore attaches the controller ConfigMap settings to each
+	// reconcile's context.
+	configStore reconciler.ConfigStore
+
+	// metrics records the outcome of every pod deletion.
+	metrics *metrics.Recorder
+
+	// auditLog records every deletion in a tamper-evident log.
+	auditLog *audit.Log
+
+	// events emits CloudEvents for runs and pod deletions to the sink
+	// configured in config-namespacecleaner.
+	events *cloudevents.Emitter
+
+	// limiter bounds the namespaces cleaned concurrently across all cleaners.
+	limiter *fairLimiter
+
+	// inflight holds the cancel functions of cleanups that are currently
+	// running, so they can be stopped when their bucket is demoted.
+	inflightMu sync.Mutex
+	inflight   map[types.NamespacedName]context.CancelFunc
 }
 
 // Check that our Reconciler implements Interface
@@ -50,6 +110,14 @@ var _ reconciler.LeaderAware = (*Reconciler)(nil)
 // Reconcile implements controller.Reconciler
 func (r *Reconciler) Reconcile(ctx context.Context, key string) error {
 	logger := logging.FromContext(ctx).With(zap.String("namespacecleaner", key))
+
+	// Only the replica leading the bucket that owns this key may clean it up.
+	nn := types.NamespacedName{Name: key}
+	if !r.IsLeaderFor(nn) {
+		logger.Debug("Not the leader for this NamespaceCleaner, skipping")
+		return controller.NewSkipKey(key)
+	}
+
 	logger.Info("Reconciling NamespaceCleaner")
 
 	// Get the NamespaceCleaner resource with this name
@@ -62,114 +130,383 @@ func (r *Reconciler) Reconcile(ctx context.Context, key string) error {
 		return err
 	}
 
+	ctx = r.configStore.ToContext(ctx)
+	ctx, done := r.trackRun(ctx, nn)
+	defer done()
+
 	return r.reconcileNamespaceCleaner(ctx, namespaceCleaner)
 }
 
-func (r *Reconciler) reconcileNamespaceCleaner(ctx context.Context, nc *v1alpha1.NamespaceCleaner) error {
+func (r *Reconciler) reconcileNamespaceCleaner(ctx context.Context, nc *v1alpha1.NamespaceCleaner) (reconcileErr error) {
 	logger := logging.FromContext(ctx).With(zap.String("namespacecleaner", nc.Name))
 
+	if err := r.reconcileSuspended(ctx, nc); err != nil {
+		return err
+	}
+	if err := r.reconcileRunRequest(ctx, nc); err != nil {
+		return err
+	}
+	if nc.Spec.Suspend {
+		logger.Info("NamespaceCleaner is suspended, skipping cleanup")
+		return nil
+	}
+
+	if ok, err := r.reconcileServiceAccount(ctx, nc); err != nil {
+		return err
+	} else if !ok {
+		logger.Info("NamespaceCleaner has no ServiceAccount to act as, skipping cleanup")
+		return nil
+	}
+
 	// Check if selector is specified
 	if len(nc.Spec.Selector.MatchLabels) == 0 {
 		logger.Info("No selector specified, skipping cleanup")
 		return nil
 	}
 
-	// List all namespaces
-	namespaces, err := r.kubeclientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to list namespaces: %w", err)
+	now := time.Now()
+	trigger, wait := nextRun(nc, now)
+	if trigger == "" {
+		logger.Debugw("Next run is not due yet", zap.Duration("wait", wait))
+		return controller.NewRequeueAfter(wait)
 	}
 
-	totalDeleted := 0
+	// The lister may not have caught up with the status written when the
+	// previous run started, so confirm with the API server before running.
+	nc, err := r.clientset.ClusteropsV1alpha1().NamespaceCleaners().Get(ctx, nc.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if trigger, wait = nextRun(nc, now); trigger == "" {
+		return controller.NewRequeueAfter(wait)
+	}
+
+	// The span covers the whole run, so that the listing, evaluation and
+	// deletions of the run are found in a single trace.
+	ctx, span := tracing.Tracer.Start(ctx, "CleanupRun", trace.WithAttributes(tracing.CleanerAttr.String(nc.Name)))
+	defer span.End()
 
-	for _, ns := range namespaces.Items {
-		// Skip system namespaces (kube-* prefixed)
-		if strings.HasPrefix(ns.Name, "kube-") {
-			logger.Debugw("Skipping system namespace", zap.String("namespace", ns.Name))
-			continue
+	// Build the cleaner's client before the run is created, so that a run
+	// never stays Running because impersonation could not be set up.
+	kube, err := r.clientFor(nc)
+	if err != nil {
+		tracing.EndSpan(span, err)
+		return err
+	}
+	run, err := r.startRun(ctx, nc, trigger, now)
+	if run == nil {
+		tracing.EndSpan(span, err)
+		return err
+	}
+	// The run name identifies the run in every log line, event, CloudEvent
+	// and span from here on.
+	span.SetAttributes(tracing.RunAttr.String(run.Name))
+	logger = logger.With(zap.String("run", run.Name))
+	ctx = logging.WithLogger(tracing.WithRun(ctx, run.Name), logging.FromContext(ctx).With(zap.String("run", run.Name)))
+	logger.Infow("Starting cleanup run",
+		zap.String("trigger", string(trigger)),
+		zap.String("traceID", run.Annotations[v1alpha1.TraceIDAnnotation]))
+	r.events.Emit(runEvent(cloudevents.TypeRunStarted, nc, run))
+
+	// However the reconcile ends from here on, the run is finished and its
+	// outcome notified exactly once, so a failure never goes unreported.
+	interrupted := false
+	defer func() {
+		if err := r.endRun(ctx, span, nc, run, interrupted); err != nil {
+			reconcileErr = err
 		}
+	}()
+	if err != nil {
+		addError(&run.Status.Errors, err)
+		return err
+	}
 
-		// Check if namespace matches selector
-		if r.matchesSelector(ns.Labels, nc.Spec.Selector.MatchLabels) {
-			logger.Infow("Processing namespace", zap.String("namespace", ns.Name))
+	backoff := policy.NewEvictionBackoff(nc.Status.BlockedPods)
+	ownership := r.cleanup(ctx, nc, kube, backoff, run)
 
-			deleted, err := r.cleanupOldPods(ctx, ns.Name)
-			if err != nil {
-				logger.Errorw("Error cleaning namespace",
-					zap.String("namespace", ns.Name),
-					zap.Error(err))
-				// Continue with other namespaces even if one fails
-				continue
-			}
-			totalDeleted += deleted
+	// Record the outcome even when the run was interrupted by a demotion.
+	interrupted = ctx.Err() != nil
+	ctx = context.WithoutCancel(ctx)
+	if ownership != nil && !interrupted {
+		if err := r.reconcileOwnership(ctx, nc, ownership); err != nil {
+			logger.Errorw("Failed to record namespace ownership", zap.Error(err))
 		}
 	}
+	if !interrupted {
+		if err := r.reconcileForbidden(ctx, nc, kube); err != nil {
+			logger.Errorw("Failed to record denied requests", zap.Error(err))
+		}
+	}
+	if blocked := backoff.Result(interrupted); !equality.Semantic.DeepEqual(blocked, nc.Status.BlockedPods) {
+		err := r.updateStatus(ctx, nc.Name, func(status *v1alpha1.NamespaceCleanerStatus) {
+			status.BlockedPods = blocked
+		})
+		if err != nil {
+			logger.Errorw("Failed to record pods blocked by disruption budgets", zap.Error(err))
+		}
+	}
+	if err := r.pruneRuns(ctx, nc, run.Name); err != nil {
+		logger.Errorw("Failed to prune old CleanupRuns", zap.Error(err))
+	}
 
-	logger.Infow("Cleanup completed",
-		zap.String("namespacecleaner", nc.Name),
-		zap.Int("totalDeleted", totalDeleted))
+	return controller.NewRequeueAfter(nc.Spec.GetInterval())
+}
 
-	return nil
+// endRun records the outcome of run, marks span failed unless the run
+// succeeded, and notifies and announces the outcome. The outcome is notified
+// even when it could not be recorded, and the error returned.
+func (r *Reconciler) endRun(ctx context.Context, span trace.Span, nc *v1alpha1.NamespaceCleaner, run *v1alpha1.CleanupRun, interrupted bool) error {
+	ctx = context.WithoutCancel(ctx)
+	logger := logging.FromContext(ctx)
+
+	err := r.finishRun(ctx, run, interrupted)
+	if err != nil {
+		logger.Errorw("Failed to record the outcome of the run", zap.Error(err))
+	}
+	if run.Status.Phase != v1alpha1.RunPhaseSucceeded {
+		span.SetStatus(codes.Error, string(run.Status.Phase))
+	}
+	r.notify(ctx, nc, run)
+	if run.Status.Phase == v1alpha1.RunPhaseSucceeded {
+		r.events.Emit(runEvent(cloudevents.TypeRunCompleted, nc, run))
+	} else {
+		r.events.Emit(runEvent(cloudevents.TypeRunFailed, nc, run))
+	}
+
+	logger.Infow("Cleanup completed",
+		zap.String("phase", string(run.Status.Phase)),
+		zap.Int32("totalDeleted", run.Status.TotalDeleted))
+	return err
 }
 
-func (r *Reconciler) cleanupOldPods(ctx context.Context, namespace string) (int, error) {
-	logger := logging.FromContext(ctx).With(zap.String("namespace", namespace))
+// cleanup performs a single run of nc through kube, recording its outcome in
+// run.Status. It returns the namespaces nc owns and the cleaners it overlaps with, or nil
+// if the namespaces could not all be listed.
+func (r *Reconciler) cleanup(ctx context.Context, nc *v1alpha1.NamespaceCleaner, kube *cleanerClient, backoff *policy.EvictionBackoff, run *v1alpha1.CleanupRun) *ownership {
+	logger := logging.FromContext(ctx).With(zap.String("namespacecleaner", nc.Name))
+	cfg := config.FromContextOrDefaults(ctx).Controller
 
-	pods, err := r.kubeclientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	archiver, err := r.archiverFor(ctx, nc.Spec.Archive)
 	if err != nil {
-		return 0, fmt.Errorf("failed to list pods in namespace %s: %w", namespace, err)
+		run.Status.Errors = append(run.Status.Errors, err.Error())
+		return nil
+	}
+
+	// Every cleaner takes part in deciding who owns a namespace.
+	cleaners, err := r.namespacecleanerLister.List(labels.Everything())
+	if err != nil {
+		addError(&run.Status.Errors, fmt.Errorf("failed to list NamespaceCleaners: %w", err))
+		return nil
 	}
 
-	deleted := 0
-	cutoff := time.Now().Add(-30 * time.Second) // Demo: Delete pods older than 30 seconds
+	concurrency := int(nc.Spec.Concurrency)
+	if concurrency <= 0 {
+		concurrency = cfg.DefaultNamespaceConcurrency
+	}
 
-	for _, pod := range pods.Items {
-		// Only delete completed pods (Succeeded or Failed)
-		if pod.Status.Phase == "Succeeded" || pod.Status.Phase == "Failed" {
-			if pod.CreationTimestamp.Time.Before(cutoff) {
-				logger.Infow("Deleting old pod (older than 30 seconds)",
-					zap.String("pod", pod.Name),
-					zap.String("phase", string(pod.Status.Phase)),
-					zap.Duration("age", time.Since(pod.CreationTimestamp.Time)))
+	var resultsMu sync.Mutex
+	matched := make(chan string)
+
+	// Matching namespaces are cleaned by a bounded set of workers. Each
+	// namespace additionally needs a slot from the shared limiter, which
+	// caps the global parallelism and interleaves the cleaners fairly.
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for namespace := range matched {
+				if err := r.limiter.Acquire(ctx, nc.Name); err != nil {
+					return
+				}
+				result := v1alpha1.NamespaceRunResult{Name: namespace}
+				ctx, span := tracing.Tracer.Start(ctx, "CleanNamespace", trace.WithAttributes(tracing.NamespaceAttr.String(namespace)))
+				err := r.cleanupOldPods(ctx, nc, kube, backoff, run.Name, namespace, archiver, &result)
+				// Old ReplicaSets go first, so that the configuration only
+				// they referred to is seen unreferenced in the same run.
+				if err == nil && nc.Spec.ReplicaSets != nil {
+					err = r.pruneReplicaSets(ctx, nc, kube, namespace, &result)
+				}
+				if err == nil && nc.Spec.OrphanedConfig != nil {
+					err = r.cleanupOrphanedConfig(ctx, nc, kube, namespace, &result)
+				}
+				if err == nil && nc.Spec.UnusedVolumes != nil {
+					err = r.cleanupUnusedVolumes(ctx, nc, kube, namespace, &result)
+				}
+				span.SetAttributes(
+					attribute.Int("clusterops.pods.deleted", int(result.Deleted)),
+					attribute.Int("clusterops.pods.candidates", int(result.Candidates)))
+				tracing.EndSpan(span, err)
+				r.limiter.Release()
 
-				err := r.kubeclientset.CoreV1().Pods(namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{})
 				if err != nil {
-					logger.Errorw("Failed to delete pod",
-						zap.String("pod", pod.Name),
+					logger.Errorw("Error cleaning namespace",
+						zap.String("namespace", namespace),
 						zap.Error(err))
-					continue
+					// Continue with other namespaces even if one fails
+					addError(&result.Errors, err)
 				}
-				deleted++
+
+				resultsMu.Lock()
+				run.Status.Namespaces = append(run.Status.Namespaces, result)
+				resultsMu.Unlock()
 			}
+		}()
+	}
+
+	// Namespaces are streamed to the workers page by page. A list restarted
+	// after an expired continue token may return a namespace twice, so
+	// remember which ones were already handed out.
+	dispatched := make(map[string]struct{})
+	owned := newOwnership()
+	err = forEachNamespace(ctx, kube, cfg.ListPageSize, func(ns *corev1.Namespace) error {
+		decision := policy.EvaluateNamespace(nc, cleaners, ns, time.Now())
+		owned.record(nc.Name, ns.Name, decision)
+		if !decision.Matches {
+			if decision.Reason != "" {
+				logger.Infow("Skipping namespace",
+					zap.String("namespace", ns.Name),
+					zap.String("reason", decision.Reason))
+			}
+			return nil
+		}
+		if _, ok := dispatched[ns.Name]; ok {
+			return nil
+		}
+		dispatched[ns.Name] = struct{}{}
+
+		logger.Infow("Processing namespace", zap.String("namespace", ns.Name))
+		select {
+		case matched <- ns.Name:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(matched)
+	wg.Wait()
+
+	if err != nil {
+		if ctx.Err() == nil {
+			addError(&run.Status.Errors, fmt.Errorf("failed to list namespaces: %w", kube.check(err)))
+		}
+		return nil
+	}
+	return owned
+}
+
+// reconcileSuspended keeps the Suspended condition in line with spec.suspend.
+// A manual run requested while suspended is kept pending until the cleaner
+// is resumed, which the condition and a single event report.
+func (r *Reconciler) reconcileSuspended(ctx context.Context, nc *v1alpha1.NamespaceCleaner) error {
+	condition := metav1.Condition{
+		Type:               v1alpha1.ConditionSuspended,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Active",
+		Message:            "Cleanup runs are enabled",
+		ObservedGeneration: nc.Generation,
+	}
+	if nc.Spec.Suspend {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Suspended"
+		condition.Message = "Cleanup runs are paused by spec.suspend"
+		if requestedAt, ok := pendingRunRequest(nc); ok {
+			condition.Reason = "RunRequestPending"
+			condition.Message = fmt.Sprintf("Cleanup runs are paused by spec.suspend, the run requested at %s starts once resumed",
+				requestedAt.UTC().Format(time.RFC3339Nano))
 		}
 	}
 
-	return deleted, nil
+	current := meta.FindStatusCondition(nc.Status.Conditions, condition.Type)
+	if current != nil && current.Status == condition.Status && current.Message == condition.Message &&
+		current.ObservedGeneration == condition.ObservedGeneration {
+		return nil
+	}
+	if condition.Reason == "RunRequestPending" && (current == nil || current.Message != condition.Message) {
+		r.recorder.Event(nc, corev1.EventTypeNormal, "RunRequestPending", condition.Message)
+	}
+
+	return r.updateStatus(ctx, nc.Name, func(status *v1alpha1.NamespaceCleanerStatus) {
+		meta.SetStatusCondition(&status.Conditions, condition)
+	})
 }
 
-func (r *Reconciler) matchesSelector(labels map[string]string, selectorLabels map[string]string) bool {
-	if labels == nil {
-		return false
+// reconcileRunRequest sets the InvalidRunRequest condition from the
+// run-requested-at annotation, warning once per invalid value rather than on
+// every reconcile.
+func (r *Reconciler) reconcileRunRequest(ctx context.Context, nc *v1alpha1.NamespaceCleaner) error {
+	condition := metav1.Condition{
+		Type:               v1alpha1.ConditionInvalidRunRequest,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Valid",
+		Message:            "No invalid run request is pending",
+		ObservedGeneration: nc.Generation,
+	}
+	if _, ok, err := nc.RunRequestedAt(); ok && err != nil {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "ParseError"
+		condition.Message = fmt.Sprintf("Ignoring annotation %s: %v", v1alpha1.RunRequestedAtAnnotation, err)
 	}
 
-	for key, value := range selectorLabels {
-		if labels[key] != value {
-			return false
-		}
+	current := meta.FindStatusCondition(nc.Status.Conditions, condition.Type)
+	if current != nil && current.Status == condition.Status && current.Message == condition.Message &&
+		current.ObservedGeneration == condition.ObservedGeneration {
+		return nil
+	}
+	if condition.Status == metav1.ConditionTrue && (current == nil || current.Message != condition.Message) {
+		r.recorder.Event(nc, corev1.EventTypeWarning, "InvalidRunRequest", condition.Message)
 	}
+	return r.updateStatus(ctx, nc.Name, func(status *v1alpha1.NamespaceCleanerStatus) {
+		meta.SetStatusCondition(&status.Conditions, condition)
+	})
+}
+
+// trackRun registers a cancellable context for the cleanup of key, so that
+// Demote can stop it. The returned function must be called once the run ends.
+func (r *Reconciler) trackRun(ctx context.Context, key types.NamespacedName) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
 
-	return true
+	r.inflightMu.Lock()
+	if r.inflight == nil {
+		r.inflight = make(map[types.NamespacedName]context.CancelFunc)
+	}
+	r.inflight[key] = cancel
+	r.inflightMu.Unlock()
+
+	return ctx, func() {
+		r.inflightMu.Lock()
+		delete(r.inflight, key)
+		r.inflightMu.Unlock()
+		cancel()
+	}
 }
 
-// Promote implements reconciler.LeaderAware
-func (r *Reconciler) Promote(bkt reconciler.Bucket, enq func(reconciler.Bucket, types.NamespacedName)) error {
-	// This is called when we become the leader.
-	// For this simple controller, we don't need to do anything special.
+// promote enqueues every NamespaceCleaner owned by the newly acquired bucket,
+// so cleanups resume immediately after a failover instead of waiting for the
+// next resync.
+func (r *Reconciler) promote(bkt reconciler.Bucket, enq func(reconciler.Bucket, types.NamespacedName)) error {
+	cleaners, err := r.namespacecleanerLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list namespacecleaners: %w", err)
+	}
+
+	for _, nc := range cleaners {
+		// enq drops keys that do not belong to bkt.
+		enq(bkt, types.NamespacedName{Name: nc.Name})
+	}
 	return nil
 }
 
-// Demote implements reconciler.LeaderAware
-func (r *Reconciler) Demote(bkt reconciler.Bucket) {
-	// This is called when we are no longer the leader.
-	// For this simple controller, we don't need to do anything special.
+// demote stops the in-flight cleanups of keys owned by the lost bucket.
+func (r *Reconciler) demote(bkt reconciler.Bucket) {
+	r.inflightMu.Lock()
+	defer r.inflightMu.Unlock()
+
+	for key, cancel := range r.inflight {
+		if bkt.Has(key) {
+			cancel()
+		}
+	}
 }
@@ -0,0 +1,135 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/system"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/notify"
+	"github.com/infernus01/knative-demo/pkg/reconciler/tracing"
+)
+
+const (
+	// Keys of the Secrets referenced by spec.notifications.
+	webhookURLKey    = "url"
+	usernameKey      = "username"
+	passwordKey      = "password"
+	authorizationKey = "authorization"
+
+	// notifyTimeout bounds the delivery of a notification, retries included.
+	notifyTimeout = time.Minute
+)
+
+// notifierFor builds the Notifier configured by spec.
+func (r *Reconciler) notifierFor(ctx context.Context, spec *v1alpha1.NotificationSpec) (notify.Notifier, error) {
+	set := 0
+	for _, configured := range []bool{spec.Webhook != nil, spec.SMTP != nil, spec.HTTP != nil} {
+		if configured {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("notification %s must set exactly one of webhook, smtp and http", spec.Name)
+	}
+
+	switch {
+	case spec.Webhook != nil:
+		secret, err := r.notificationSecret(ctx, spec.Webhook.URLSecret)
+		if err != nil {
+			return nil, err
+		}
+		return notify.NewWebhook(string(secret.Data[webhookURLKey])), nil
+
+	case spec.SMTP != nil:
+		smtp := &notify.SMTP{Address: spec.SMTP.Address, From: spec.SMTP.From, To: spec.SMTP.To}
+		if spec.SMTP.CredentialsSecret != "" {
+			secret, err := r.notificationSecret(ctx, spec.SMTP.CredentialsSecret)
+			if err != nil {
+				return nil, err
+			}
+			smtp.Username, smtp.Password = string(secret.Data[usernameKey]), string(secret.Data[passwordKey])
+		}
+		return smtp, nil
+
+	default:
+		authorization := ""
+		if spec.HTTP.CredentialsSecret != "" {
+			secret, err := r.notificationSecret(ctx, spec.HTTP.CredentialsSecret)
+			if err != nil {
+				return nil, err
+			}
+			authorization = string(secret.Data[authorizationKey])
+		}
+		return notify.NewHTTP(spec.HTTP.URL, authorization), nil
+	}
+}
+
+func (r *Reconciler) notificationSecret(ctx context.Context, name string) (*corev1.Secret, error) {
+	secret, err := r.kubeclientset.CoreV1().Secrets(system.Namespace()).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification Secret %s: %w", name, err)
+	}
+	return secret, nil
+}
+
+// notify sends the outcome of run to the notifications of nc that subscribe
+// to its phase. Delivery, retries included, happens in the background so
+// that a slow endpoint does not hold up the cleaner.
+func (r *Reconciler) notify(ctx context.Context, nc *v1alpha1.NamespaceCleaner, run *v1alpha1.CleanupRun) {
+	logger := logging.FromContext(ctx)
+	recorder := tracing.Recorder(ctx, r.recorder)
+	run = run.DeepCopy()
+	for i := range nc.Spec.Notifications {
+		spec := &nc.Spec.Notifications[i]
+		if !slices.Contains(spec.GetOn(), run.Status.Phase) {
+			continue
+		}
+
+		n, err := notify.Render(spec.Template, run)
+		if err != nil {
+			recorder.Eventf(nc, corev1.EventTypeWarning, "NotificationFailed", "Notification %s: %v", spec.Name, err)
+			continue
+		}
+		notifier, err := r.notifierFor(ctx, spec)
+		if err != nil {
+			recorder.Eventf(nc, corev1.EventTypeWarning, "NotificationFailed", "Notification %s: %v", spec.Name, err)
+			continue
+		}
+
+		go func(name string) {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+			defer cancel()
+			if err := notify.NewRetry(notifier).Notify(ctx, n); err != nil {
+				logger.Errorw("Failed to send notification",
+					zap.String("notification", name),
+					zap.Error(err))
+				recorder.Eventf(nc, corev1.EventTypeWarning, "NotificationFailed",
+					"Notification %s of run %s: %v", name, run.Name, err)
+			}
+		}(spec.Name)
+	}
+}
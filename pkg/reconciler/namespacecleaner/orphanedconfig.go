@@ -0,0 +1,380 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/ptr"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/audit"
+	"github.com/infernus01/knative-demo/pkg/policy"
+	"github.com/infernus01/knative-demo/pkg/reconciler/config"
+	"github.com/infernus01/knative-demo/pkg/reconciler/metrics"
+	"github.com/infernus01/knative-demo/pkg/reconciler/tracing"
+)
+
+// configObject is a ConfigMap or a Secret.
+type configObject interface {
+	metav1.Object
+	runtime.Object
+}
+
+// configCleanup is the garbage collection of the ConfigMaps and Secrets of a
+// single namespace during a run.
+type configCleanup struct {
+	*Reconciler
+
+	nc        *v1alpha1.NamespaceCleaner
+	kube      *cleanerClient
+	namespace string
+	refs      *policy.ConfigReferences
+	result    *v1alpha1.NamespaceRunResult
+	logger    *zap.SugaredLogger
+
+	// recorder annotates the events of the cleanup with its run.
+	recorder record.EventRecorder
+}
+
+// cleanupOrphanedConfig deletes the ConfigMaps and Secrets of namespace that
+// nothing has referred to for longer than spec.orphanedConfig.gracePeriod.
+// Those found unreferenced are annotated with since when, and the annotation
+// is removed again once something refers to them.
+func (r *Reconciler) cleanupOrphanedConfig(ctx context.Context, nc *v1alpha1.NamespaceCleaner, kube *cleanerClient, namespace string, result *v1alpha1.NamespaceRunResult) error {
+	pageSize := config.FromContextOrDefaults(ctx).Controller.ListPageSize
+	p := nc.Spec.OrphanedConfig
+
+	// A reference the graph misses would get an object in use deleted, so
+	// nothing is collected unless every source was listed.
+	refs, err := configReferences(ctx, kube, namespace, pageSize)
+	if err != nil {
+		return kube.check(err)
+	}
+
+	c := &configCleanup{
+		Reconciler: r,
+		nc:         nc,
+		kube:       kube,
+		namespace:  namespace,
+		refs:       refs,
+		result:     result,
+		logger:     logging.FromContext(ctx).With(zap.String("namespace", namespace)),
+		recorder:   tracing.Recorder(ctx, r.recorder),
+	}
+
+	if p.Collects(v1alpha1.ConfigKindConfigMap) {
+		err := forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]corev1.ConfigMap, string, error) {
+			list, err := kube.CoreV1().ConfigMaps(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		}, func(cm *corev1.ConfigMap) error {
+			c.collect(ctx, v1alpha1.ConfigKindConfigMap, cm, "")
+			return ctx.Err()
+		})
+		if err != nil {
+			return kube.check(fmt.Errorf("failed to list ConfigMaps in namespace %s: %w", namespace, err))
+		}
+	}
+	if p.Collects(v1alpha1.ConfigKindSecret) {
+		err := forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]corev1.Secret, string, error) {
+			list, err := kube.CoreV1().Secrets(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		}, func(secret *corev1.Secret) error {
+			c.collect(ctx, v1alpha1.ConfigKindSecret, secret, secret.Type)
+			return ctx.Err()
+		})
+		if err != nil {
+			return kube.check(fmt.Errorf("failed to list Secrets in namespace %s: %w", namespace, err))
+		}
+	}
+	return nil
+}
+
+// collect marks, unmarks or deletes obj of kind as the policy says.
+func (c *configCleanup) collect(ctx context.Context, kind v1alpha1.ConfigKind, obj configObject, secretType corev1.SecretType) {
+	now := time.Now()
+	decision := policy.EvaluateOrphanedConfig(c.nc.Spec.OrphanedConfig, kind, obj,
+		secretType, c.refs.Referenced(kind, obj.GetName()), now)
+
+	switch decision.Action {
+	case policy.ConfigMark:
+		c.annotate(ctx, kind, obj, ptr.String(now.UTC().Format(time.RFC3339)))
+	case policy.ConfigUnmark:
+		c.annotate(ctx, kind, obj, nil)
+	case policy.ConfigDelete:
+		c.delete(ctx, kind, obj, decision)
+	}
+}
+
+// annotate sets the UnreferencedSinceAnnotation of obj to since, or removes
+// it when since is nil.
+func (c *configCleanup) annotate(ctx context.Context, kind v1alpha1.ConfigKind, obj configObject, since *string) {
+	if c.nc.Spec.DryRun {
+		return
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{v1alpha1.UnreferencedSinceAnnotation: since},
+		},
+	})
+	if err != nil {
+		addError(&c.result.Errors, err)
+		return
+	}
+
+	opts := metav1.PatchOptions{}
+	if kind == v1alpha1.ConfigKindSecret {
+		_, err = c.kube.CoreV1().Secrets(c.namespace).Patch(ctx, obj.GetName(), types.MergePatchType, patch, opts)
+	} else {
+		_, err = c.kube.CoreV1().ConfigMaps(c.namespace).Patch(ctx, obj.GetName(), types.MergePatchType, patch, opts)
+	}
+	if err := c.kube.check(err); err != nil {
+		c.logger.Errorw("Failed to annotate unreferenced object",
+			zap.String("kind", string(kind)),
+			zap.String("name", obj.GetName()),
+			zap.Error(err))
+		addError(&c.result.Errors, fmt.Errorf("failed to annotate %s %s: %w", kind, obj.GetName(), err))
+	}
+}
+
+// delete deletes obj of kind, unless it changed since it was listed.
+func (c *configCleanup) delete(ctx context.Context, kind v1alpha1.ConfigKind, obj configObject, decision policy.ConfigDecision) {
+	record := audit.NewRecord(audit.ActionDelete, "v1", string(kind), obj)
+	if c.nc.Spec.DryRun {
+		c.logger.Infow("Dry run: would delete unreferenced object",
+			zap.String("kind", string(kind)),
+			zap.String("name", obj.GetName()),
+			zap.String("reason", decision.Reason))
+		c.recordAudit(ctx, c.nc, c.result, record, policy.RuleOrphanedConfig, decision.Reason)
+		return
+	}
+
+	c.logger.Infow("Deleting unreferenced object",
+		zap.String("kind", string(kind)),
+		zap.String("name", obj.GetName()),
+		zap.String("reason", decision.Reason))
+
+	// The preconditions fail the delete if the object was recreated or
+	// changed, e.g. marked again, since it was listed.
+	uid, resourceVersion := obj.GetUID(), obj.GetResourceVersion()
+	opts := metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid, ResourceVersion: &resourceVersion}}
+	err := c.kube.check(tracing.TraceDelete(ctx, string(kind), obj, func(ctx context.Context) error {
+		if kind == v1alpha1.ConfigKindSecret {
+			return c.kube.CoreV1().Secrets(c.namespace).Delete(ctx, obj.GetName(), opts)
+		}
+		return c.kube.CoreV1().ConfigMaps(c.namespace).Delete(ctx, obj.GetName(), opts)
+	}))
+	if reason, ok := metrics.SkipReason(err); ok {
+		c.logger.Infow("Skipping deletion of unreferenced object",
+			zap.String("kind", string(kind)),
+			zap.String("name", obj.GetName()),
+			zap.String("reason", reason))
+		return
+	} else if err != nil {
+		c.logger.Errorw("Failed to delete unreferenced object",
+			zap.String("kind", string(kind)),
+			zap.String("name", obj.GetName()),
+			zap.Error(err))
+		addError(&c.result.Errors, fmt.Errorf("failed to delete %s %s: %w", kind, obj.GetName(), err))
+		return
+	}
+	c.result.ConfigDeleted++
+	c.recordAudit(ctx, c.nc, c.result, record, policy.RuleOrphanedConfig, decision.Reason)
+
+	c.recorder.Eventf(obj, corev1.EventTypeNormal, "Unreferenced",
+		"Deleted by NamespaceCleaner %s: %s", c.nc.Name, decision.Reason)
+}
+
+// configReferences builds the graph of the ConfigMaps and Secrets of
+// namespace referred to by its pods, the pod templates of its workloads, its
+// ServiceAccounts and its Ingresses' TLS.
+func configReferences(ctx context.Context, kube *cleanerClient, namespace string, pageSize int64) (*policy.ConfigReferences, error) {
+	refs := policy.NewConfigReferences()
+	sources := []struct {
+		kind string
+		list func() error
+	}{{
+		kind: "pods",
+		list: func() error {
+			return forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]corev1.Pod, string, error) {
+				list, err := kube.CoreV1().Pods(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return list.Items, list.Continue, nil
+			}, func(pod *corev1.Pod) error {
+				refs.AddPodSpec(&pod.Spec)
+				return nil
+			})
+		},
+	}, {
+		kind: "replicationcontrollers",
+		list: func() error {
+			return forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]corev1.ReplicationController, string, error) {
+				list, err := kube.CoreV1().ReplicationControllers(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return list.Items, list.Continue, nil
+			}, func(rc *corev1.ReplicationController) error {
+				if rc.Spec.Template != nil {
+					refs.AddPodSpec(&rc.Spec.Template.Spec)
+				}
+				return nil
+			})
+		},
+	}, {
+		kind: "deployments",
+		list: func() error {
+			return forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]appsv1.Deployment, string, error) {
+				list, err := kube.AppsV1().Deployments(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return list.Items, list.Continue, nil
+			}, func(d *appsv1.Deployment) error {
+				refs.AddPodSpec(&d.Spec.Template.Spec)
+				return nil
+			})
+		},
+	}, {
+		// Old ReplicaSets keep what a rollback of their Deployment needs.
+		kind: "replicasets",
+		list: func() error {
+			return forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]appsv1.ReplicaSet, string, error) {
+				list, err := kube.AppsV1().ReplicaSets(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return list.Items, list.Continue, nil
+			}, func(rs *appsv1.ReplicaSet) error {
+				refs.AddPodSpec(&rs.Spec.Template.Spec)
+				return nil
+			})
+		},
+	}, {
+		kind: "statefulsets",
+		list: func() error {
+			return forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]appsv1.StatefulSet, string, error) {
+				list, err := kube.AppsV1().StatefulSets(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return list.Items, list.Continue, nil
+			}, func(ss *appsv1.StatefulSet) error {
+				refs.AddPodSpec(&ss.Spec.Template.Spec)
+				return nil
+			})
+		},
+	}, {
+		kind: "daemonsets",
+		list: func() error {
+			return forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]appsv1.DaemonSet, string, error) {
+				list, err := kube.AppsV1().DaemonSets(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return list.Items, list.Continue, nil
+			}, func(ds *appsv1.DaemonSet) error {
+				refs.AddPodSpec(&ds.Spec.Template.Spec)
+				return nil
+			})
+		},
+	}, {
+		kind: "jobs",
+		list: func() error {
+			return forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]batchv1.Job, string, error) {
+				list, err := kube.BatchV1().Jobs(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return list.Items, list.Continue, nil
+			}, func(job *batchv1.Job) error {
+				refs.AddPodSpec(&job.Spec.Template.Spec)
+				return nil
+			})
+		},
+	}, {
+		kind: "cronjobs",
+		list: func() error {
+			return forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]batchv1.CronJob, string, error) {
+				list, err := kube.BatchV1().CronJobs(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return list.Items, list.Continue, nil
+			}, func(cj *batchv1.CronJob) error {
+				refs.AddPodSpec(&cj.Spec.JobTemplate.Spec.Template.Spec)
+				return nil
+			})
+		},
+	}, {
+		kind: "serviceaccounts",
+		list: func() error {
+			return forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]corev1.ServiceAccount, string, error) {
+				list, err := kube.CoreV1().ServiceAccounts(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return list.Items, list.Continue, nil
+			}, func(sa *corev1.ServiceAccount) error {
+				refs.AddServiceAccount(sa)
+				return nil
+			})
+		},
+	}, {
+		kind: "ingresses",
+		list: func() error {
+			return forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]networkingv1.Ingress, string, error) {
+				list, err := kube.NetworkingV1().Ingresses(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return list.Items, list.Continue, nil
+			}, func(ing *networkingv1.Ingress) error {
+				refs.AddIngress(ing)
+				return nil
+			})
+		},
+	}}
+
+	for _, source := range sources {
+		if err := source.list(); err != nil {
+			return nil, fmt.Errorf("failed to list %s in namespace %s: %w", source.kind, namespace, err)
+		}
+	}
+	return refs, nil
+}
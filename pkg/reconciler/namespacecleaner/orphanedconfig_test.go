@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"slices"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	logtesting "knative.dev/pkg/logging/testing"
+)
+
+func TestConfigReferences(t *testing.T) {
+	ctx := logtesting.TestContextWithLogger(t)
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Namespace: "ci", Name: name}
+	}
+	template := func(configMap string) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{Spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+			VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: configMap},
+			}},
+		}}}}
+	}
+	pod := func(namespace, configMap string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: configMap}, Spec: template(configMap).Spec}
+	}
+	rcTemplate := template("rc")
+
+	objects := []runtime.Object{
+		pod("ci", "pod"),
+		// Pods of other namespaces refer to their own ConfigMaps.
+		pod("other", "other"),
+		&corev1.ReplicationController{ObjectMeta: meta("rc"), Spec: corev1.ReplicationControllerSpec{Template: &rcTemplate}},
+		&corev1.ReplicationController{ObjectMeta: meta("rc-without-template")},
+		&appsv1.Deployment{ObjectMeta: meta("deployment"), Spec: appsv1.DeploymentSpec{Template: template("deployment")}},
+		&appsv1.ReplicaSet{ObjectMeta: meta("replicaset"), Spec: appsv1.ReplicaSetSpec{Template: template("replicaset")}},
+		&appsv1.StatefulSet{ObjectMeta: meta("statefulset"), Spec: appsv1.StatefulSetSpec{Template: template("statefulset")}},
+		&appsv1.DaemonSet{ObjectMeta: meta("daemonset"), Spec: appsv1.DaemonSetSpec{Template: template("daemonset")}},
+		&batchv1.Job{ObjectMeta: meta("job"), Spec: batchv1.JobSpec{Template: template("job")}},
+		&batchv1.CronJob{ObjectMeta: meta("cronjob"), Spec: batchv1.CronJobSpec{
+			JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: template("cronjob")}},
+		}},
+		&corev1.ServiceAccount{ObjectMeta: meta("builder"), ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}}},
+		&networkingv1.Ingress{ObjectMeta: meta("web"), Spec: networkingv1.IngressSpec{TLS: []networkingv1.IngressTLS{{SecretName: "tls"}}}},
+	}
+	kube := &cleanerClient{Interface: fake.NewClientset(objects...)}
+
+	refs, err := configReferences(ctx, kube, "ci", 2)
+	if err != nil {
+		t.Fatal("configReferences() =", err)
+	}
+	wantConfigMaps := []string{"cronjob", "daemonset", "deployment", "job", "pod", "rc", "replicaset", "statefulset"}
+	if got := sets.List(refs.ConfigMaps); !slices.Equal(got, wantConfigMaps) {
+		t.Errorf("ConfigMaps = %v, want %v", got, wantConfigMaps)
+	}
+	if got, want := sets.List(refs.Secrets), []string{"registry", "tls"}; !slices.Equal(got, want) {
+		t.Errorf("Secrets = %v, want %v", got, want)
+	}
+}
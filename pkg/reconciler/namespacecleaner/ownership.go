@@ -0,0 +1,105 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/policy"
+)
+
+// maxOwnedNamespaces bounds the namespaces listed in status.ownedNamespaces.
+const maxOwnedNamespaces = 100
+
+// ownership collects, over one run, the namespaces a cleaner owns and the
+// other cleaners selecting the same namespaces.
+type ownership struct {
+	owned       map[string]struct{}
+	conflicting map[string]struct{}
+}
+
+func newOwnership() *ownership {
+	return &ownership{
+		owned:       make(map[string]struct{}),
+		conflicting: make(map[string]struct{}),
+	}
+}
+
+// record notes the decision of cleaner name on namespace.
+func (o *ownership) record(name, namespace string, decision policy.NamespaceDecision) {
+	if decision.Owner == name {
+		o.owned[namespace] = struct{}{}
+	}
+	for _, other := range decision.Overlapping {
+		o.conflicting[other] = struct{}{}
+	}
+}
+
+// reconcileOwnership publishes the namespaces owned by nc and the cleaners
+// it overlaps with, warning once whenever the set of overlapping cleaners
+// changes.
+func (r *Reconciler) reconcileOwnership(ctx context.Context, nc *v1alpha1.NamespaceCleaner, o *ownership) error {
+	owned := sortedKeys(o.owned)
+	conflicting := sortedKeys(o.conflicting)
+
+	condition := metav1.Condition{
+		Type:               v1alpha1.ConditionOverlapping,
+		Status:             metav1.ConditionFalse,
+		Reason:             "NoOverlap",
+		Message:            "No other NamespaceCleaner selects the same namespaces",
+		ObservedGeneration: nc.Generation,
+	}
+	if len(conflicting) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "SelectorsOverlap"
+		condition.Message = fmt.Sprintf("Namespaces are also selected by %s; each is cleaned only by the cleaner with the highest precedence",
+			strings.Join(conflicting, ", "))
+
+		if !slices.Equal(conflicting, nc.Status.ConflictingCleaners) {
+			r.recorder.Eventf(nc, corev1.EventTypeWarning, "SelectorsOverlap",
+				"Selector overlaps with NamespaceCleaners %s", strings.Join(conflicting, ", "))
+		}
+	}
+
+	return r.updateStatus(ctx, nc.Name, func(status *v1alpha1.NamespaceCleanerStatus) {
+		status.ConflictingCleaners = conflicting
+		status.OwnedNamespaceCount = int32(len(owned))
+		status.OwnedNamespaces = owned[:min(len(owned), maxOwnedNamespaces)]
+		meta.SetStatusCondition(&status.Conditions, condition)
+	})
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
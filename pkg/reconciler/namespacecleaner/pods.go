@@ -0,0 +1,375 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/ptr"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/archive"
+	"github.com/infernus01/knative-demo/pkg/audit"
+	"github.com/infernus01/knative-demo/pkg/cloudevents"
+	"github.com/infernus01/knative-demo/pkg/policy"
+	"github.com/infernus01/knative-demo/pkg/reconciler/config"
+	"github.com/infernus01/knative-demo/pkg/reconciler/metrics"
+	"github.com/infernus01/knative-demo/pkg/reconciler/tracing"
+)
+
+// podCleanup is the cleanup of the pods of a single namespace during a run.
+type podCleanup struct {
+	*Reconciler
+
+	nc       *v1alpha1.NamespaceCleaner
+	run      string
+	kube     *cleanerClient
+	backoff  *policy.EvictionBackoff
+	archiver archive.Archiver
+	nodes    policy.NodeLookup
+	result   *v1alpha1.NamespaceRunResult
+	logger   *zap.SugaredLogger
+
+	// recorder annotates the events of the cleanup with its run.
+	recorder record.EventRecorder
+
+	// brokenOwners are the workloads of broken pods acted on in this run.
+	brokenOwners sets.Set[string]
+}
+
+func (r *Reconciler) cleanupOldPods(ctx context.Context, nc *v1alpha1.NamespaceCleaner, kube *cleanerClient, backoff *policy.EvictionBackoff, run, namespace string, archiver archive.Archiver, result *v1alpha1.NamespaceRunResult) error {
+	cfg := config.FromContextOrDefaults(ctx).Controller
+	c := &podCleanup{
+		Reconciler: r,
+		nc:         nc,
+		run:        run,
+		kube:       kube,
+		backoff:    backoff,
+		archiver:   archiver,
+		nodes:      r.nodeLookup(ctx),
+		result:     result,
+		logger:     logging.FromContext(ctx).With(zap.String("namespace", namespace)),
+		recorder:   tracing.Recorder(ctx, r.recorder),
+
+		brokenOwners: sets.New[string](),
+	}
+
+	// With a retention policy finished pods past their TTL are only deleted
+	// once every pod of the namespace was seen, and so the most recent ones
+	// of each group are known.
+	var expiry *policy.Expiry
+	if nc.Spec.Retention != nil {
+		expiry = policy.NewExpiry(nc.Spec.Retention, c.jobLookup(ctx, namespace))
+	}
+
+	for _, selector := range policy.PodFieldSelectors(nc) {
+		err := forEachPod(ctx, kube, namespace, selector, cfg.ListPageSize, func(pod *corev1.Pod) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			decision, err := policy.EvaluateCleanerPod(nc, pod, c.nodes, time.Now())
+			if err != nil {
+				addError(&c.result.Errors, fmt.Errorf("failed to evaluate pod %s: %w", pod.Name, err))
+				return nil
+			}
+			switch {
+			case expiry != nil && expiry.Hold(pod, decision):
+			case !decision.Delete:
+			case decision.Rule == policy.RuleStuckTerminating:
+				c.forceDelete(ctx, pod, decision)
+			case decision.Rule == policy.RuleOrphanedNode:
+				c.deleteOrphan(ctx, pod, decision)
+			case decision.Rule == policy.RuleBrokenPod:
+				c.handleBroken(ctx, pod, decision)
+			case decision.Rule == policy.RuleUnschedulable:
+				if c.deletePod(ctx, pod, decision) {
+					c.result.Unschedulable++
+				}
+			default:
+				c.deletePod(ctx, pod, decision)
+			}
+			return nil
+		})
+		if err != nil {
+			return kube.check(err)
+		}
+	}
+
+	if expiry == nil {
+		return nil
+	}
+	expired, retained := expiry.Release()
+	c.result.Retained += int32(retained)
+	for _, e := range expired {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.deletePod(ctx, e.Pod, e.Decision)
+	}
+
+	return nil
+}
+
+// dryRun records pod in the dry run preview and the audit log, reporting
+// whether this is a dry run.
+func (c *podCleanup) dryRun(ctx context.Context, pod *corev1.Pod, decision policy.PodDecision) bool {
+	if !c.nc.Spec.DryRun {
+		return false
+	}
+	c.recordPod(ctx, pod, decision, "")
+	c.logger.Infow("Dry run: would delete pod",
+		zap.String("pod", pod.Name),
+		zap.String("reason", decision.Reason))
+	if len(c.result.DryRunPreview) < maxPreviewPods {
+		c.result.DryRunPreview = append(c.result.DryRunPreview, pod.Name)
+	}
+	return true
+}
+
+// deletePod archives and removes a pod selected by the pod policy,
+// reporting whether it was deleted.
+func (c *podCleanup) deletePod(ctx context.Context, pod *corev1.Pod, decision policy.PodDecision) bool {
+	c.result.Candidates++
+	if c.dryRun(ctx, pod, decision) {
+		return false
+	}
+
+	// A pod a disruption budget protected last time is only retried
+	// once its backoff elapsed.
+	if c.backoff.Deferred(pod, time.Now()) {
+		c.result.Blocked++
+		return false
+	}
+
+	c.logger.Infow("Deleting pod",
+		zap.String("pod", pod.Name),
+		zap.String("action", string(c.nc.Spec.Action)),
+		zap.String("reason", decision.Reason),
+		zap.Duration("age", time.Since(pod.CreationTimestamp.Time)))
+
+	// Preserve the pod's logs and events first, they are gone for
+	// good once it is deleted.
+	var location string
+	if c.archiver != nil {
+		var err error
+		location, err = archive.Pod(ctx, c.kube, c.archiver, pod)
+		if err := c.kube.check(err); err != nil {
+			c.logger.Errorw("Failed to archive pod, not deleting it",
+				zap.String("pod", pod.Name),
+				zap.Error(err))
+			addError(&c.result.Errors, err)
+			return false
+		}
+		c.recorder.AnnotatedEventf(pod, map[string]string{archive.LocationAnnotation: location},
+			corev1.EventTypeNormal, "PodArchived",
+			"Archived to %s before deletion by NamespaceCleaner %s", location, c.nc.Name)
+	}
+
+	err := c.kube.check(tracing.TraceDelete(ctx, "Pod", pod, func(ctx context.Context) error {
+		return policy.Remove(ctx, c.kube, &c.nc.Spec.PodPolicy, pod)
+	}))
+	if policy.BlockedByBudget(&c.nc.Spec.PodPolicy, err) {
+		c.logger.Infow("Eviction blocked by a disruption budget",
+			zap.String("pod", pod.Name),
+			zap.Error(err))
+		c.backoff.Blocked(pod, time.Now(), err)
+		c.result.Blocked++
+		c.metrics.Blocked(ctx, kind, c.nc.Name)
+		return false
+	}
+	return c.deleted(ctx, pod, decision, location, err)
+}
+
+// deleted records the outcome of deleting pod as decided, after archiving it
+// to archived if set, reporting whether it was deleted.
+func (c *podCleanup) deleted(ctx context.Context, pod *corev1.Pod, decision policy.PodDecision, archived string, err error) bool {
+	if reason, ok := metrics.SkipReason(err); ok {
+		// Gone already, e.g. seen again after a list restart, or
+		// recreated or changed since it was listed.
+		c.logger.Infow("Skipping pod deletion",
+			zap.String("pod", pod.Name),
+			zap.String("reason", reason))
+		c.result.Skipped++
+		c.metrics.Skipped(ctx, kind, c.nc.Name, reason)
+		return false
+	} else if err != nil {
+		c.logger.Errorw("Failed to delete pod",
+			zap.String("pod", pod.Name),
+			zap.Error(err))
+		addError(&c.result.Errors, fmt.Errorf("failed to delete pod %s: %w", pod.Name, err))
+		c.metrics.Failed(ctx, kind, c.nc.Name)
+		return false
+	}
+	c.result.Deleted++
+	c.metrics.Deleted(ctx, kind, c.nc.Name)
+	c.recordPod(ctx, pod, decision, archived)
+	c.events.Emit(cloudevents.PodDeleted(eventSource(c.nc), c.nc.Name, c.run, pod, decision.Rule, decision.Reason))
+	return true
+}
+
+// deleteOrphan deletes a pod whose node is gone or NotReady. Its logs are
+// out of reach with the node, so it is not archived.
+func (c *podCleanup) deleteOrphan(ctx context.Context, pod *corev1.Pod, decision policy.PodDecision) {
+	c.result.Candidates++
+	if c.dryRun(ctx, pod, decision) {
+		return
+	}
+
+	opts := policy.DeleteOptions(&c.nc.Spec.PodPolicy, pod)
+	if c.nc.Spec.OrphanedNode.Force {
+		opts.GracePeriodSeconds = ptr.Int64(0)
+	}
+	c.logger.Infow("Deleting pod on lost node",
+		zap.String("pod", pod.Name),
+		zap.String("reason", decision.Reason),
+		zap.Bool("force", c.nc.Spec.OrphanedNode.Force))
+
+	err := c.kube.check(tracing.TraceDelete(ctx, "Pod", pod, func(ctx context.Context) error {
+		return c.kube.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, opts)
+	}))
+	if !c.deleted(ctx, pod, decision, "", err) {
+		return
+	}
+	c.result.Orphaned++
+
+	c.recorder.Eventf(pod, corev1.EventTypeWarning, "NodeLost",
+		"Deleted by NamespaceCleaner %s: %s", c.nc.Name, decision.Reason)
+	c.audit(pod, decision.Rule, decision.Reason)
+}
+
+// forceDelete removes the configured finalizers from a pod stuck in
+// Terminating and deletes it without grace period.
+func (c *podCleanup) forceDelete(ctx context.Context, pod *corev1.Pod, decision policy.PodDecision) {
+	c.result.Candidates++
+	if c.dryRun(ctx, pod, decision) {
+		return
+	}
+
+	stuck := c.nc.Spec.StuckTerminating
+	removed := make([]string, 0, len(stuck.RemoveFinalizers))
+	remaining := make([]string, 0, len(pod.Finalizers))
+	for _, finalizer := range pod.Finalizers {
+		if slices.Contains(stuck.RemoveFinalizers, finalizer) {
+			removed = append(removed, finalizer)
+		} else {
+			remaining = append(remaining, finalizer)
+		}
+	}
+
+	c.logger.Infow("Force deleting pod stuck in Terminating",
+		zap.String("pod", pod.Name),
+		zap.String("reason", decision.Reason),
+		zap.Strings("removeFinalizers", removed))
+
+	if len(removed) > 0 {
+		// The resourceVersion makes the patch fail if the pod changed since
+		// it was listed, rather than overwrite finalizers added meanwhile.
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"resourceVersion": pod.ResourceVersion,
+				"finalizers":      remaining,
+			},
+		})
+		if err != nil {
+			addError(&c.result.Errors, err)
+			return
+		}
+		_, err = c.kube.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err := c.kube.check(err); err != nil {
+			c.deleted(ctx, pod, decision, "", fmt.Errorf("failed to remove finalizers: %w", err))
+			return
+		}
+		// Recorded on its own, since the delete below may still fail.
+		c.recordAudit(ctx, c.nc, c.result, audit.NewRecord(audit.ActionRemoveFinalizers, "v1", "Pod", pod),
+			decision.Rule, fmt.Sprintf("%s, removed finalizers %v", decision.Reason, removed))
+	}
+
+	// Removing the finalizers bumped the resourceVersion, so only the UID
+	// guards against deleting a recreated pod.
+	err := c.kube.check(tracing.TraceDelete(ctx, "Pod", pod, func(ctx context.Context) error {
+		return c.kube.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{
+			GracePeriodSeconds: ptr.Int64(0),
+			Preconditions:      &metav1.Preconditions{UID: &pod.UID},
+		})
+	}))
+	if errors.IsNotFound(err) && len(removed) > 0 {
+		// Removing the finalizers was enough to let the pod go.
+		err = nil
+	}
+	if !c.deleted(ctx, pod, decision, "", err) {
+		return
+	}
+	c.result.ForceDeleted++
+
+	message := decision.Reason
+	if len(removed) > 0 {
+		message = fmt.Sprintf("%s, removed finalizers %v", message, removed)
+	}
+	c.recorder.Eventf(pod, corev1.EventTypeWarning, "ForceDeleted",
+		"Force deleted by NamespaceCleaner %s: %s", c.nc.Name, message)
+	c.audit(pod, decision.Rule, message)
+}
+
+// nodeLookup finds nodes in the informer cache. A node missing from the
+// cache may only not have been seen yet, so it is only reported gone once the
+// API server confirms it.
+func (r *Reconciler) nodeLookup(ctx context.Context) policy.NodeLookup {
+	return func(name string) (*corev1.Node, error) {
+		node, err := r.nodeLister.Get(name)
+		if !errors.IsNotFound(err) {
+			return node, err
+		}
+		return r.kubeclientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	}
+}
+
+// jobLookup finds the Jobs of namespace, caching them for the rest of the run.
+func (c *podCleanup) jobLookup(ctx context.Context, namespace string) policy.JobLookup {
+	jobs := map[string]*batchv1.Job{}
+	return func(name string) (*batchv1.Job, bool) {
+		job, ok := jobs[name]
+		if !ok {
+			var err error
+			job, err = c.kube.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err := c.kube.check(err); err != nil {
+				if !errors.IsNotFound(err) {
+					// Grouping the pods by their Job only keeps more of them.
+					c.logger.Warnw("Failed to get Job, grouping its pods by the Job",
+						zap.String("job", name),
+						zap.Error(err))
+				}
+				job = nil
+			}
+			jobs[name] = job
+		}
+		return job, job != nil
+	}
+}
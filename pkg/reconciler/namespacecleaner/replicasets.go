@@ -0,0 +1,132 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/logging"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/audit"
+	"github.com/infernus01/knative-demo/pkg/policy"
+	"github.com/infernus01/knative-demo/pkg/reconciler/config"
+	"github.com/infernus01/knative-demo/pkg/reconciler/metrics"
+	"github.com/infernus01/knative-demo/pkg/reconciler/tracing"
+)
+
+// pruneReplicaSets deletes the old ReplicaSets of the Deployments of
+// namespace beyond spec.replicaSets.keepRevisions.
+func (r *Reconciler) pruneReplicaSets(ctx context.Context, nc *v1alpha1.NamespaceCleaner, kube *cleanerClient, namespace string, result *v1alpha1.NamespaceRunResult) error {
+	pageSize := config.FromContextOrDefaults(ctx).Controller.ListPageSize
+	logger := logging.FromContext(ctx).With(zap.String("namespace", namespace))
+	recorder := tracing.Recorder(ctx, r.recorder)
+
+	// ReplicaSets are grouped by the Deployment controlling them.
+	owned := map[types.UID][]*appsv1.ReplicaSet{}
+	err := forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]appsv1.ReplicaSet, string, error) {
+		list, err := kube.AppsV1().ReplicaSets(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	}, func(rs *appsv1.ReplicaSet) error {
+		if owner := policy.DeploymentOf(rs); owner != nil {
+			owned[owner.UID] = append(owned[owner.UID], rs)
+		}
+		return nil
+	})
+	if err != nil {
+		return kube.check(fmt.Errorf("failed to list ReplicaSets in namespace %s: %w", namespace, err))
+	}
+	if len(owned) == 0 {
+		return nil
+	}
+
+	var prunable []*appsv1.ReplicaSet
+	err = forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]appsv1.Deployment, string, error) {
+		list, err := kube.AppsV1().Deployments(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	}, func(deployment *appsv1.Deployment) error {
+		prunable = append(prunable, policy.PrunableReplicaSets(nc.Spec.ReplicaSets, deployment, owned[deployment.UID])...)
+		return nil
+	})
+	if err != nil {
+		return kube.check(fmt.Errorf("failed to list Deployments in namespace %s: %w", namespace, err))
+	}
+
+	background := metav1.DeletePropagationBackground
+	for _, rs := range prunable {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		owner := policy.DeploymentOf(rs).Name
+		record := audit.NewRecord(audit.ActionDelete, "apps/v1", "ReplicaSet", rs)
+		reason := fmt.Sprintf("revision %d of Deployment %s is beyond the %d old revisions kept",
+			policy.Revision(rs), owner, nc.Spec.ReplicaSets.KeepRevisions)
+		if nc.Spec.DryRun {
+			logger.Infow("Dry run: would delete old ReplicaSet",
+				zap.String("replicaset", rs.Name),
+				zap.String("deployment", owner),
+				zap.Int64("revision", policy.Revision(rs)))
+			r.recordAudit(ctx, nc, result, record, policy.RuleOldReplicaSet, reason)
+			continue
+		}
+
+		logger.Infow("Deleting old ReplicaSet",
+			zap.String("replicaset", rs.Name),
+			zap.String("deployment", owner),
+			zap.Int64("revision", policy.Revision(rs)))
+
+		// The preconditions fail the delete if the Deployment rolled back
+		// to the revision, scaling it up, since it was listed.
+		err := kube.check(tracing.TraceDelete(ctx, "ReplicaSet", rs, func(ctx context.Context) error {
+			return kube.AppsV1().ReplicaSets(namespace).Delete(ctx, rs.Name, metav1.DeleteOptions{
+				PropagationPolicy: &background,
+				Preconditions:     &metav1.Preconditions{UID: &rs.UID, ResourceVersion: &rs.ResourceVersion},
+			})
+		}))
+		if reason, ok := metrics.SkipReason(err); ok {
+			logger.Infow("Skipping deletion of ReplicaSet",
+				zap.String("replicaset", rs.Name),
+				zap.String("reason", reason))
+			continue
+		} else if err != nil {
+			logger.Errorw("Failed to delete ReplicaSet",
+				zap.String("replicaset", rs.Name),
+				zap.Error(err))
+			addError(&result.Errors, fmt.Errorf("failed to delete ReplicaSet %s: %w", rs.Name, err))
+			continue
+		}
+		result.ReplicaSetsDeleted++
+		r.recordAudit(ctx, nc, result, record, policy.RuleOldReplicaSet, reason)
+
+		recorder.Eventf(rs, corev1.EventTypeNormal, "Pruned",
+			"Revision %d of Deployment %s deleted by NamespaceCleaner %s, keeping %d old revisions",
+			policy.Revision(rs), owner, nc.Name, nc.Spec.ReplicaSets.KeepRevisions)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/retry"
+	"knative.dev/pkg/kmeta"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+const (
+	// maxPreviewPods caps the pods listed per namespace in a dry run preview.
+	maxPreviewPods = 100
+
+	// maxErrors caps the errors recorded per namespace and per run, so a
+	// CleanupRun stays well below the object size limit.
+	maxErrors = 20
+)
+
+// nextRun returns what triggers a run of nc if one is due at now. Otherwise
+// it returns an empty trigger and how long to wait for the next scheduled run.
+func nextRun(nc *v1alpha1.NamespaceCleaner, now time.Time) (v1alpha1.RunTrigger, time.Duration) {
+	if _, ok := pendingRunRequest(nc); ok {
+		return v1alpha1.RunTriggerManual, 0
+	}
+
+	if nc.Status.LastRunTime == nil || nc.Generation != nc.Status.ObservedGeneration {
+		return v1alpha1.RunTriggerEvent, 0
+	}
+
+	next := nc.Status.LastRunTime.Add(nc.Spec.GetInterval())
+	if !now.Before(next) {
+		return v1alpha1.RunTriggerSchedule, 0
+	}
+	return "", next.Sub(now)
+}
+
+// pendingRunRequest returns when the manual run requested through the
+// run-requested-at annotation of nc was requested, if it was not acted upon
+// yet.
+func pendingRunRequest(nc *v1alpha1.NamespaceCleaner) (time.Time, bool) {
+	requestedAt, ok, err := nc.RunRequestedAt()
+	if !ok || err != nil {
+		return time.Time{}, false
+	}
+	var last time.Time
+	if t, err := time.Parse(time.RFC3339Nano, nc.Status.LastManualRunRequest); err == nil {
+		last = t
+	} else if nc.Status.LastManualRunTime != nil {
+		// Statuses written before lastManualRunRequest only have the last
+		// request to the second.
+		last = nc.Status.LastManualRunTime.Time
+	}
+	if !requestedAt.After(last) {
+		return time.Time{}, false
+	}
+	return requestedAt, true
+}
+
+// startRun creates the CleanupRun recording a run of nc and marks the run as
+// started in its own status and in the status of nc. When either update
+// fails, the run is returned with the error, for the caller to finish it.
+func (r *Reconciler) startRun(ctx context.Context, nc *v1alpha1.NamespaceCleaner, trigger v1alpha1.RunTrigger, now time.Time) (*v1alpha1.CleanupRun, error) {
+	run := &v1alpha1.CleanupRun{
+		ObjectMeta: metav1.ObjectMeta{
+			// The random suffix tells apart runs started within a second,
+			// such as a manual run right after a scheduled one.
+			GenerateName:    kmeta.ChildName(nc.Name, fmt.Sprintf("-%d-", now.Unix())),
+			Labels:          map[string]string{v1alpha1.CleanerLabel: nc.Name},
+			Annotations:     runAnnotations(ctx),
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(nc, v1alpha1.SchemeGroupVersion.WithKind("NamespaceCleaner"))},
+		},
+		Spec: v1alpha1.CleanupRunSpec{
+			Cleaner: nc.Name,
+			Trigger: trigger,
+			DryRun:  nc.Spec.DryRun,
+		},
+	}
+
+	created, err := r.clientset.ClusteropsV1alpha1().CleanupRuns().Create(ctx, run, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CleanupRun: %w", err)
+	}
+
+	created.Status = v1alpha1.CleanupRunStatus{
+		Phase:     v1alpha1.RunPhaseRunning,
+		StartTime: &metav1.Time{Time: now},
+	}
+	run, err = r.clientset.ClusteropsV1alpha1().CleanupRuns().UpdateStatus(ctx, created, metav1.UpdateOptions{})
+	if err != nil {
+		// The run exists, so it must be finished rather than left without
+		// a phase.
+		return created, fmt.Errorf("failed to update CleanupRun status: %w", err)
+	}
+
+	// Remember the run before doing any work, so a crash mid-run does not
+	// cause it to be repeated before the next interval.
+	generation := nc.Generation
+	requestedAt, _ := pendingRunRequest(nc)
+	err = r.updateStatus(ctx, nc.Name, func(status *v1alpha1.NamespaceCleanerStatus) {
+		status.ObservedGeneration = generation
+		status.LastRunTime = run.Status.StartTime
+		status.LastRun = run.Name
+		if trigger == v1alpha1.RunTriggerManual {
+			// Acknowledge the request so it is not acted upon again.
+			status.LastManualRunTime = &metav1.Time{Time: requestedAt}
+			status.LastManualRunRequest = requestedAt.UTC().Format(time.RFC3339Nano)
+		}
+	})
+	if err != nil {
+		return run, fmt.Errorf("failed to update NamespaceCleaner status: %w", err)
+	}
+
+	return run, nil
+}
+
+// finishRun completes the status of run and persists it.
+func (r *Reconciler) finishRun(ctx context.Context, run *v1alpha1.CleanupRun, interrupted bool) error {
+	sort.Slice(run.Status.Namespaces, func(i, j int) bool {
+		return run.Status.Namespaces[i].Name < run.Status.Namespaces[j].Name
+	})
+
+	failed := len(run.Status.Errors) > 0
+	run.Status.TotalDeleted, run.Status.TotalSkipped, run.Status.TotalBlocked = 0, 0, 0
+	run.Status.TotalReclaimedStorage = nil
+	for _, ns := range run.Status.Namespaces {
+		run.Status.TotalDeleted += ns.Deleted
+		run.Status.TotalSkipped += ns.Skipped
+		run.Status.TotalBlocked += ns.Blocked
+		if ns.ReclaimedStorage != nil {
+			if run.Status.TotalReclaimedStorage == nil {
+				run.Status.TotalReclaimedStorage = resource.NewQuantity(0, resource.BinarySI)
+			}
+			run.Status.TotalReclaimedStorage.Add(*ns.ReclaimedStorage)
+		}
+		failed = failed || len(ns.Errors) > 0
+	}
+
+	switch {
+	case interrupted:
+		run.Status.Phase = v1alpha1.RunPhaseInterrupted
+	case failed:
+		run.Status.Phase = v1alpha1.RunPhaseFailed
+	default:
+		run.Status.Phase = v1alpha1.RunPhaseSucceeded
+	}
+	run.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+
+	if _, err := r.clientset.ClusteropsV1alpha1().CleanupRuns().UpdateStatus(ctx, run, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update CleanupRun status: %w", err)
+	}
+	return nil
+}
+
+// pruneRuns deletes the oldest CleanupRuns of nc beyond its
+// runsHistoryLimit, never touching the current run.
+func (r *Reconciler) pruneRuns(ctx context.Context, nc *v1alpha1.NamespaceCleaner, current string) error {
+	runs, err := r.cleanuprunLister.List(labels.SelectorFromSet(labels.Set{v1alpha1.CleanerLabel: nc.Name}))
+	if err != nil {
+		return err
+	}
+
+	previous := make([]*v1alpha1.CleanupRun, 0, len(runs))
+	for _, run := range runs {
+		if run.Name != current {
+			previous = append(previous, run)
+		}
+	}
+
+	// The current run counts towards the limit.
+	keep := max(nc.Spec.GetRunsHistoryLimit()-1, 0)
+	if len(previous) <= keep {
+		return nil
+	}
+
+	sort.Slice(previous, func(i, j int) bool {
+		ti, tj := previous[i].CreationTimestamp, previous[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return tj.Before(&ti)
+		}
+		return previous[i].Name > previous[j].Name
+	})
+
+	for _, run := range previous[keep:] {
+		err := r.clientset.ClusteropsV1alpha1().CleanupRuns().Delete(ctx, run.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete CleanupRun %s: %w", run.Name, err)
+		}
+	}
+	return nil
+}
+
+// updateStatus applies mutate to the latest status of the NamespaceCleaner
+// called name, retrying on conflicts.
+func (r *Reconciler) updateStatus(ctx context.Context, name string, mutate func(*v1alpha1.NamespaceCleanerStatus)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		nc, err := r.clientset.ClusteropsV1alpha1().NamespaceCleaners().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		mutate(&nc.Status)
+		_, err = r.clientset.ClusteropsV1alpha1().NamespaceCleaners().UpdateStatus(ctx, nc, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// addError appends err to errs unless maxErrors was already reached.
+func addError(errs *[]string, err error) {
+	if len(*errs) < maxErrors {
+		*errs = append(*errs, err.Error())
+	}
+}
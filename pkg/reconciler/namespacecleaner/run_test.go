@@ -0,0 +1,201 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/generated/clientset/versioned/fake"
+)
+
+func TestNextRun(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	interval := metav1.Duration{Duration: 10 * time.Minute}
+	// cleaner returns a cleaner that last ran ago, requested to run with
+	// annotation if set.
+	cleaner := func(ago time.Duration, annotation string, mutate ...func(*v1alpha1.NamespaceCleanerStatus)) *v1alpha1.NamespaceCleaner {
+		nc := &v1alpha1.NamespaceCleaner{
+			ObjectMeta: metav1.ObjectMeta{Name: "ci", Generation: 2},
+			Spec:       v1alpha1.NamespaceCleanerSpec{Interval: &interval},
+			Status: v1alpha1.NamespaceCleanerStatus{
+				ObservedGeneration: 2,
+				LastRunTime:        &metav1.Time{Time: now.Add(-ago)},
+			},
+		}
+		if annotation != "" {
+			nc.Annotations = map[string]string{v1alpha1.RunRequestedAtAnnotation: annotation}
+		}
+		for _, m := range mutate {
+			m(&nc.Status)
+		}
+		return nc
+	}
+	acknowledged := func(request string) func(*v1alpha1.NamespaceCleanerStatus) {
+		return func(status *v1alpha1.NamespaceCleanerStatus) {
+			at, err := time.Parse(time.RFC3339Nano, request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			status.LastManualRunTime = &metav1.Time{Time: at.Truncate(time.Second)}
+			status.LastManualRunRequest = request
+		}
+	}
+	// Statuses written before lastManualRunRequest.
+	acknowledgedToTheSecond := func(request string) func(*v1alpha1.NamespaceCleanerStatus) {
+		return func(status *v1alpha1.NamespaceCleanerStatus) {
+			at, err := time.Parse(time.RFC3339, request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			status.LastManualRunTime = &metav1.Time{Time: at}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		nc      *v1alpha1.NamespaceCleaner
+		trigger v1alpha1.RunTrigger
+		wait    time.Duration
+	}{{
+		name: "not due",
+		nc:   cleaner(4*time.Minute, ""),
+		wait: 6 * time.Minute,
+	}, {
+		name:    "scheduled",
+		nc:      cleaner(10*time.Minute, ""),
+		trigger: v1alpha1.RunTriggerSchedule,
+	}, {
+		name:    "never ran",
+		nc:      cleaner(0, "", func(status *v1alpha1.NamespaceCleanerStatus) { status.LastRunTime = nil }),
+		trigger: v1alpha1.RunTriggerEvent,
+	}, {
+		name:    "spec changed",
+		nc:      cleaner(time.Minute, "", func(status *v1alpha1.NamespaceCleanerStatus) { status.ObservedGeneration = 1 }),
+		trigger: v1alpha1.RunTriggerEvent,
+	}, {
+		name:    "requested",
+		nc:      cleaner(time.Minute, "2026-10-01T11:59:30Z"),
+		trigger: v1alpha1.RunTriggerManual,
+	}, {
+		name: "request acted upon",
+		nc:   cleaner(time.Minute, "2026-10-01T11:59:30Z", acknowledged("2026-10-01T11:59:30Z")),
+		wait: 9 * time.Minute,
+	}, {
+		name:    "request within the same second",
+		nc:      cleaner(time.Minute, "2026-10-01T11:59:30.75Z", acknowledged("2026-10-01T11:59:30.25Z")),
+		trigger: v1alpha1.RunTriggerManual,
+	}, {
+		name: "request with fractional seconds acted upon",
+		nc:   cleaner(time.Minute, "2026-10-01T11:59:30.75Z", acknowledged("2026-10-01T11:59:30.75Z")),
+		wait: 9 * time.Minute,
+	}, {
+		name: "older request",
+		nc:   cleaner(time.Minute, "2026-10-01T11:00:00Z", acknowledged("2026-10-01T11:59:30Z")),
+		wait: 9 * time.Minute,
+	}, {
+		name: "request acted upon before upgrading",
+		nc:   cleaner(time.Minute, "2026-10-01T11:59:30Z", acknowledgedToTheSecond("2026-10-01T11:59:30Z")),
+		wait: 9 * time.Minute,
+	}, {
+		name:    "request after upgrading",
+		nc:      cleaner(time.Minute, "2026-10-01T11:59:45Z", acknowledgedToTheSecond("2026-10-01T11:59:30Z")),
+		trigger: v1alpha1.RunTriggerManual,
+	}, {
+		name: "invalid request",
+		nc:   cleaner(time.Minute, "now"),
+		wait: 9 * time.Minute,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trigger, wait := nextRun(test.nc, now)
+			if trigger != test.trigger || wait != test.wait {
+				t.Errorf("nextRun() = %q, %s, want %q, %s", trigger, wait, test.trigger, test.wait)
+			}
+		})
+	}
+}
+
+func TestReconcileSuspendedRunRequest(t *testing.T) {
+	ctx := logtesting.TestContextWithLogger(t)
+	nc := &v1alpha1.NamespaceCleaner{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "ci",
+			Generation:  3,
+			Annotations: map[string]string{v1alpha1.RunRequestedAtAnnotation: "2026-10-01T12:00:00.5Z"},
+		},
+		Spec: v1alpha1.NamespaceCleanerSpec{Suspend: true},
+	}
+	clientset := fake.NewSimpleClientset(nc)
+	recorder := record.NewFakeRecorder(10)
+	r := &Reconciler{clientset: clientset, recorder: recorder}
+
+	reconcile := func() *metav1.Condition {
+		t.Helper()
+		if err := r.reconcileSuspended(ctx, nc); err != nil {
+			t.Fatal("reconcileSuspended() =", err)
+		}
+		updated, err := clientset.ClusteropsV1alpha1().NamespaceCleaners().Get(ctx, nc.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal("Get() =", err)
+		}
+		nc = updated
+		return meta.FindStatusCondition(nc.Status.Conditions, v1alpha1.ConditionSuspended)
+	}
+
+	condition := reconcile()
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != "RunRequestPending" ||
+		!strings.Contains(condition.Message, "2026-10-01T12:00:00.5Z") {
+		t.Fatalf("Suspended condition = %+v, want the pending request", condition)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("recorded %d events, want 1", len(recorder.Events))
+	}
+
+	// Reconciling again reports the same request once.
+	reconcile()
+	if len(recorder.Events) != 1 {
+		t.Errorf("recorded %d events after reconciling again, want 1", len(recorder.Events))
+	}
+
+	// A new request is reported in turn.
+	nc.Annotations[v1alpha1.RunRequestedAtAnnotation] = "2026-10-01T12:00:00.9Z"
+	if condition := reconcile(); !strings.Contains(condition.Message, "2026-10-01T12:00:00.9Z") {
+		t.Errorf("Suspended condition = %+v, want the new request", condition)
+	}
+	if len(recorder.Events) != 2 {
+		t.Errorf("recorded %d events for the new request, want 2", len(recorder.Events))
+	}
+
+	// The request stays pending, and runs once resumed.
+	nc.Spec.Suspend = false
+	nc.Generation++
+	if condition := reconcile(); condition.Status != metav1.ConditionFalse {
+		t.Errorf("Suspended condition = %+v, want False once resumed", condition)
+	}
+	if trigger, _ := nextRun(nc, time.Now()); trigger != v1alpha1.RunTriggerManual {
+		t.Errorf("nextRun() = %q once resumed, want %q", trigger, v1alpha1.RunTriggerManual)
+	}
+}
@@ -0,0 +1,268 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/logging"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/audit"
+	"github.com/infernus01/knative-demo/pkg/policy"
+	"github.com/infernus01/knative-demo/pkg/reconciler/config"
+	"github.com/infernus01/knative-demo/pkg/reconciler/metrics"
+	"github.com/infernus01/knative-demo/pkg/reconciler/tracing"
+)
+
+// volumeSnapshots are the snapshots taken of claims before they are deleted.
+var volumeSnapshots = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshots"}
+
+// volumeCleanup is the reclaiming of the PersistentVolumeClaims of a single
+// namespace during a run.
+type volumeCleanup struct {
+	*Reconciler
+
+	nc        *v1alpha1.NamespaceCleaner
+	kube      *cleanerClient
+	namespace string
+	result    *v1alpha1.NamespaceRunResult
+	logger    *zap.SugaredLogger
+
+	// recorder annotates the events of the cleanup with its run.
+	recorder record.EventRecorder
+}
+
+// cleanupUnusedVolumes deletes the Bound PersistentVolumeClaims of namespace
+// that no pod has mounted for longer than spec.unusedVolumes.unusedFor,
+// after taking a VolumeSnapshot of them if asked to.
+func (r *Reconciler) cleanupUnusedVolumes(ctx context.Context, nc *v1alpha1.NamespaceCleaner, kube *cleanerClient, namespace string, result *v1alpha1.NamespaceRunResult) error {
+	pageSize := config.FromContextOrDefaults(ctx).Controller.ListPageSize
+
+	// Finished pods count as well, they are how Jobs use their claims.
+	use := policy.NewClaimUse()
+	listed := time.Now()
+	err := forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]corev1.Pod, string, error) {
+		list, err := kube.CoreV1().Pods(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	}, func(pod *corev1.Pod) error {
+		use.AddPod(pod, listed)
+		return nil
+	})
+	if err != nil {
+		return kube.check(fmt.Errorf("failed to list pods in namespace %s: %w", namespace, err))
+	}
+	// A StatefulSet scaled to zero mounts its claims again when scaled up.
+	err = forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]appsv1.StatefulSet, string, error) {
+		list, err := kube.AppsV1().StatefulSets(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	}, func(sts *appsv1.StatefulSet) error {
+		use.AddStatefulSet(sts)
+		return nil
+	})
+	if err != nil {
+		return kube.check(fmt.Errorf("failed to list StatefulSets in namespace %s: %w", namespace, err))
+	}
+
+	c := &volumeCleanup{
+		Reconciler: r,
+		nc:         nc,
+		kube:       kube,
+		namespace:  namespace,
+		result:     result,
+		logger:     logging.FromContext(ctx).With(zap.String("namespace", namespace)),
+		recorder:   tracing.Recorder(ctx, r.recorder),
+	}
+	err = forEachItem(ctx, pageSize, func(opts metav1.ListOptions) ([]corev1.PersistentVolumeClaim, string, error) {
+		list, err := kube.CoreV1().PersistentVolumeClaims(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	}, func(pvc *corev1.PersistentVolumeClaim) error {
+		decision := policy.EvaluateVolumeClaim(nc.Spec.UnusedVolumes, pvc, use, time.Now())
+		switch decision.Action {
+		case policy.VolumeMarkUsed:
+			c.markUsed(ctx, pvc, decision.LastUsed)
+		case policy.VolumeDelete:
+			c.reclaim(ctx, pvc, decision)
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return kube.check(fmt.Errorf("failed to list PersistentVolumeClaims in namespace %s: %w", namespace, err))
+	}
+	return nil
+}
+
+// markUsed records used as the last use of pvc.
+func (c *volumeCleanup) markUsed(ctx context.Context, pvc *corev1.PersistentVolumeClaim, used time.Time) {
+	if c.nc.Spec.DryRun {
+		return
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{v1alpha1.LastUsedAnnotation: used.UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		addError(&c.result.Errors, err)
+		return
+	}
+	_, err = c.kube.CoreV1().PersistentVolumeClaims(c.namespace).Patch(ctx, pvc.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err := c.kube.check(err); err != nil {
+		c.logger.Errorw("Failed to record the last use of PersistentVolumeClaim",
+			zap.String("pvc", pvc.Name),
+			zap.Error(err))
+		addError(&c.result.Errors, fmt.Errorf("failed to annotate PersistentVolumeClaim %s: %w", pvc.Name, err))
+	}
+}
+
+// reclaim deletes pvc, once its snapshot is ready to use when one is taken.
+func (c *volumeCleanup) reclaim(ctx context.Context, pvc *corev1.PersistentVolumeClaim, decision policy.VolumeDecision) {
+	record := audit.NewRecord(audit.ActionDelete, "v1", "PersistentVolumeClaim", pvc)
+	if c.nc.Spec.DryRun {
+		c.logger.Infow("Dry run: would delete unused PersistentVolumeClaim",
+			zap.String("pvc", pvc.Name),
+			zap.Bool("snapshot", c.nc.Spec.UnusedVolumes.Snapshot != nil),
+			zap.String("reason", decision.Reason))
+		c.recordAudit(ctx, c.nc, c.result, record, policy.RuleUnusedVolume, decision.Reason)
+		return
+	}
+
+	if c.nc.Spec.UnusedVolumes.Snapshot != nil {
+		ready, err := c.snapshot(ctx, pvc)
+		if err != nil {
+			c.logger.Errorw("Failed to snapshot PersistentVolumeClaim, not deleting it",
+				zap.String("pvc", pvc.Name),
+				zap.Error(err))
+			addError(&c.result.Errors, err)
+			return
+		}
+		if !ready {
+			// The claim is deleted by a later run, once the snapshot is
+			// ready to use.
+			return
+		}
+	}
+
+	c.logger.Infow("Deleting unused PersistentVolumeClaim",
+		zap.String("pvc", pvc.Name),
+		zap.String("reason", decision.Reason))
+
+	// The preconditions fail the delete if the claim was recreated or
+	// changed, e.g. marked used again, since it was listed.
+	err := c.kube.check(tracing.TraceDelete(ctx, "PersistentVolumeClaim", pvc, func(ctx context.Context) error {
+		return c.kube.CoreV1().PersistentVolumeClaims(c.namespace).Delete(ctx, pvc.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &pvc.UID, ResourceVersion: &pvc.ResourceVersion},
+		})
+	}))
+	if reason, ok := metrics.SkipReason(err); ok {
+		c.logger.Infow("Skipping deletion of PersistentVolumeClaim",
+			zap.String("pvc", pvc.Name),
+			zap.String("reason", reason))
+		return
+	} else if err != nil {
+		c.logger.Errorw("Failed to delete PersistentVolumeClaim",
+			zap.String("pvc", pvc.Name),
+			zap.Error(err))
+		addError(&c.result.Errors, fmt.Errorf("failed to delete PersistentVolumeClaim %s: %w", pvc.Name, err))
+		return
+	}
+
+	c.result.VolumesDeleted++
+	c.recordAudit(ctx, c.nc, c.result, record, policy.RuleUnusedVolume, decision.Reason)
+	capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+	if c.result.ReclaimedStorage == nil {
+		c.result.ReclaimedStorage = resource.NewQuantity(0, resource.BinarySI)
+	}
+	c.result.ReclaimedStorage.Add(capacity)
+
+	c.recorder.Eventf(pvc, corev1.EventTypeNormal, "Reclaimed",
+		"Deleted by NamespaceCleaner %s, reclaiming %s: %s", c.nc.Name, capacity.String(), decision.Reason)
+}
+
+// snapshot takes a VolumeSnapshot of pvc unless it already has one,
+// reporting whether it is ready to use.
+func (c *volumeCleanup) snapshot(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	// The UID in the name tells the snapshots of claims recreated with the
+	// same name apart.
+	name := pvc.Name
+	if len(name) > 244 {
+		name = name[:244]
+	}
+	name = fmt.Sprintf("%s-%s", name, string(pvc.UID)[:8])
+	snapshots := c.kube.dynamic.Resource(volumeSnapshots).Namespace(c.namespace)
+
+	existing, err := snapshots.Get(ctx, name, metav1.GetOptions{})
+	if err := c.kube.check(err); err == nil {
+		if message, found, _ := unstructured.NestedString(existing.Object, "status", "error", "message"); found {
+			return false, fmt.Errorf("VolumeSnapshot %s of PersistentVolumeClaim %s failed: %s", name, pvc.Name, message)
+		}
+		ready, _, _ := unstructured.NestedBool(existing.Object, "status", "readyToUse")
+		return ready, nil
+	} else if !errors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to get VolumeSnapshot %s: %w", name, err)
+	}
+
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{"persistentVolumeClaimName": pvc.Name},
+	}
+	if class := c.nc.Spec.UnusedVolumes.Snapshot.ClassName; class != "" {
+		spec["volumeSnapshotClassName"] = class
+	}
+	snapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": volumeSnapshots.GroupVersion().String(),
+		"kind":       "VolumeSnapshot",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": c.namespace,
+			"labels":    map[string]interface{}{v1alpha1.CleanerLabel: c.nc.Name},
+		},
+		"spec": spec,
+	}}
+	if _, err := snapshots.Create(ctx, snapshot, metav1.CreateOptions{}); c.kube.check(err) != nil {
+		return false, fmt.Errorf("failed to create VolumeSnapshot %s: %w", name, err)
+	}
+
+	c.logger.Infow("Took VolumeSnapshot of unused PersistentVolumeClaim",
+		zap.String("pvc", pvc.Name),
+		zap.String("snapshot", name))
+	c.result.Snapshots++
+	c.recorder.Eventf(pvc, corev1.EventTypeNormal, "Snapshotted",
+		"VolumeSnapshot %s taken by NamespaceCleaner %s before deleting the claim", name, c.nc.Name)
+	return false, nil
+}
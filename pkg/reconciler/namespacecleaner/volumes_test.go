@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecleaner
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/audit"
+	"github.com/infernus01/knative-demo/pkg/policy"
+)
+
+func TestReclaimSnapshot(t *testing.T) {
+	ctx := logtesting.TestContextWithLogger(t)
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "cache", UID: "0123456789abcdef"},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Phase:    corev1.ClaimBound,
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+		},
+	}
+	nc := &v1alpha1.NamespaceCleaner{
+		ObjectMeta: metav1.ObjectMeta{Name: "ci"},
+		Spec: v1alpha1.NamespaceCleanerSpec{UnusedVolumes: &v1alpha1.UnusedVolumePolicy{
+			Snapshot: &v1alpha1.VolumeSnapshotSpec{ClassName: "csi-snapclass"},
+		}},
+	}
+	auditLog := audit.NewLog()
+	if err := auditLog.Configure(audit.Config{Sink: audit.SinkNone}); err != nil {
+		t.Fatal("Configure() =", err)
+	}
+	kube := &cleanerClient{
+		Interface: fake.NewClientset(pvc),
+		dynamic: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+			volumeSnapshots: "VolumeSnapshotList",
+		}),
+	}
+	c := &volumeCleanup{
+		Reconciler: &Reconciler{auditLog: auditLog},
+		nc:         nc,
+		kube:       kube,
+		namespace:  "ci",
+		result:     &v1alpha1.NamespaceRunResult{},
+		logger:     logtesting.TestLogger(t),
+		recorder:   record.NewFakeRecorder(10),
+	}
+	decision := policy.VolumeDecision{Action: policy.VolumeDelete, Reason: "unused"}
+	snapshots := kube.dynamic.Resource(volumeSnapshots).Namespace("ci")
+	exists := func() bool {
+		_, err := kube.CoreV1().PersistentVolumeClaims("ci").Get(ctx, "cache", metav1.GetOptions{})
+		return err == nil
+	}
+	setStatus := func(status map[string]interface{}) {
+		t.Helper()
+		snapshot, err := snapshots.Get(ctx, "cache-01234567", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal("Get(VolumeSnapshot) =", err)
+		}
+		snapshot.Object["status"] = status
+		if _, err := snapshots.Update(ctx, snapshot, metav1.UpdateOptions{}); err != nil {
+			t.Fatal("Update(VolumeSnapshot) =", err)
+		}
+	}
+
+	// The first run takes the snapshot.
+	c.reclaim(ctx, pvc, decision)
+	if !exists() || c.result.Snapshots != 1 || c.result.VolumesDeleted != 0 {
+		t.Fatalf("after taking the snapshot: exists = %v, result = %+v", exists(), c.result)
+	}
+	snapshot, err := snapshots.Get(ctx, "cache-01234567", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("Get(VolumeSnapshot) =", err)
+	}
+	if source, _, _ := unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName"); source != "cache" {
+		t.Errorf("snapshot source = %q, want cache", source)
+	}
+	if class, _, _ := unstructured.NestedString(snapshot.Object, "spec", "volumeSnapshotClassName"); class != "csi-snapclass" {
+		t.Errorf("snapshot class = %q, want csi-snapclass", class)
+	}
+
+	// Until the snapshot is ready to use the claim is kept.
+	setStatus(map[string]interface{}{"readyToUse": false})
+	c.reclaim(ctx, pvc, decision)
+	if !exists() || c.result.Snapshots != 1 || len(c.result.Errors) != 0 {
+		t.Fatalf("before the snapshot is ready: exists = %v, result = %+v", exists(), c.result)
+	}
+
+	// A failed snapshot keeps the claim and is reported.
+	setStatus(map[string]interface{}{"error": map[string]interface{}{"message": "out of quota"}})
+	c.reclaim(ctx, pvc, decision)
+	if !exists() || len(c.result.Errors) != 1 {
+		t.Fatalf("after the snapshot failed: exists = %v, result = %+v", exists(), c.result)
+	}
+
+	setStatus(map[string]interface{}{"readyToUse": true})
+	c.reclaim(ctx, pvc, decision)
+	if exists() || c.result.VolumesDeleted != 1 || c.result.ReclaimedStorage.String() != "10Gi" {
+		t.Errorf("once the snapshot is ready: exists = %v, result = %+v", exists(), c.result)
+	}
+}
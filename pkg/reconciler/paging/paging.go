@@ -0,0 +1,57 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package paging drives chunked lists against the API server.
+package paging
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/logging"
+)
+
+// maxRestarts bounds how often a paginated list is restarted from the
+// beginning after its continue token expired.
+const maxRestarts = 3
+
+// Paginate drives a chunked list: page is called with Limit/Continue set and
+// returns the continue token of the next page, or "" after the last one.
+// When the API server reports the token as expired (410 Gone) the list is
+// restarted from the first page, so callers must tolerate seeing an item
+// more than once.
+func Paginate(ctx context.Context, opts metav1.ListOptions, page func(metav1.ListOptions) (string, error)) error {
+	restarts := 0
+	for {
+		next, err := page(opts)
+		if (errors.IsResourceExpired(err) || errors.IsGone(err)) && opts.Continue != "" && restarts < maxRestarts {
+			restarts++
+			logging.FromContext(ctx).Infow("Continue token expired, restarting list",
+				zap.Int("restart", restarts), zap.Error(err))
+			opts.Continue = ""
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+		opts.Continue = next
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package paging
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	logtesting "knative.dev/pkg/logging/testing"
+)
+
+// lister serves items two per page, the continue token being the index of
+// the next item. The calls listed in fail return their error instead.
+type lister struct {
+	items []string
+	fail  map[int]error
+	calls int
+}
+
+func (l *lister) page(opts metav1.ListOptions, visit func(string)) (string, error) {
+	l.calls++
+	if err := l.fail[l.calls]; err != nil {
+		return "", err
+	}
+	start := 0
+	if opts.Continue != "" {
+		start, _ = strconv.Atoi(opts.Continue)
+	}
+	end := min(start+int(opts.Limit), len(l.items))
+	for _, item := range l.items[start:end] {
+		visit(item)
+	}
+	if end == len(l.items) {
+		return "", nil
+	}
+	return strconv.Itoa(end), nil
+}
+
+func TestPaginate(t *testing.T) {
+	expired := apierrs.NewResourceExpired("too old resource version")
+	gone := apierrs.NewGone("the continue token expired")
+	denied := apierrs.NewForbidden(schema.GroupResource{Resource: "pods"}, "", errors.New("denied"))
+
+	tests := []struct {
+		name      string
+		fail      map[int]error
+		wantErr   error
+		wantCalls int
+		// wantVisited are the items visited in order, duplicates included.
+		wantVisited []string
+	}{{
+		name:        "single pass",
+		wantCalls:   3,
+		wantVisited: []string{"a", "b", "c", "d", "e"},
+	}, {
+		name:        "expired mid-list",
+		fail:        map[int]error{2: expired},
+		wantCalls:   5,
+		wantVisited: []string{"a", "b", "a", "b", "c", "d", "e"},
+	}, {
+		name:        "gone mid-list",
+		fail:        map[int]error{3: gone},
+		wantCalls:   6,
+		wantVisited: []string{"a", "b", "c", "d", "a", "b", "c", "d", "e"},
+	}, {
+		name:        "three restarts",
+		fail:        map[int]error{2: expired, 4: gone, 6: expired},
+		wantCalls:   9,
+		wantVisited: []string{"a", "b", "a", "b", "a", "b", "a", "b", "c", "d", "e"},
+	}, {
+		name:        "gives up after three restarts",
+		fail:        map[int]error{2: expired, 4: expired, 6: expired, 8: expired},
+		wantErr:     expired,
+		wantCalls:   8,
+		wantVisited: []string{"a", "b", "a", "b", "a", "b", "a", "b"},
+	}, {
+		// Without a continue token there is nothing to restart from.
+		name:      "expired on the first page",
+		fail:      map[int]error{1: expired},
+		wantErr:   expired,
+		wantCalls: 1,
+	}, {
+		name:        "other errors",
+		fail:        map[int]error{2: denied},
+		wantErr:     denied,
+		wantCalls:   2,
+		wantVisited: []string{"a", "b"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := &lister{items: []string{"a", "b", "c", "d", "e"}, fail: test.fail}
+			var visited []string
+			err := Paginate(logtesting.TestContextWithLogger(t), metav1.ListOptions{Limit: 2}, func(opts metav1.ListOptions) (string, error) {
+				return l.page(opts, func(item string) { visited = append(visited, item) })
+			})
+
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Paginate() = %v, want %v", err, test.wantErr)
+			}
+			if l.calls != test.wantCalls {
+				t.Errorf("%d pages listed, want %d", l.calls, test.wantCalls)
+			}
+			if len(visited) != len(test.wantVisited) {
+				t.Fatalf("visited %v, want %v", visited, test.wantVisited)
+			}
+			for i := range visited {
+				if visited[i] != test.wantVisited[i] {
+					t.Fatalf("visited %v, want %v", visited, test.wantVisited)
+				}
+			}
+		})
+	}
+}
+
+func TestPaginateDedupe(t *testing.T) {
+	l := &lister{
+		items: []string{"a", "b", "c", "d", "e"},
+		fail:  map[int]error{3: apierrs.NewResourceExpired("too old resource version")},
+	}
+
+	// Callers that act on items keep track of those already seen, as the
+	// items before the restart are listed again.
+	seen := sets.New[string]()
+	var acted []string
+	err := Paginate(logtesting.TestContextWithLogger(t), metav1.ListOptions{Limit: 2}, func(opts metav1.ListOptions) (string, error) {
+		return l.page(opts, func(item string) {
+			if !seen.Has(item) {
+				seen.Insert(item)
+				acted = append(acted, item)
+			}
+		})
+	})
+	if err != nil {
+		t.Fatalf("Paginate() = %v", err)
+	}
+	if want := []string{"a", "b", "c", "d", "e"}; len(acted) != len(want) || !seen.HasAll(want...) {
+		t.Errorf("acted on %v, want each of %v once", acted, want)
+	}
+}
+
+func TestPaginateOptions(t *testing.T) {
+	opts := metav1.ListOptions{FieldSelector: "status.phase=Failed", Limit: 2}
+	l := &lister{
+		items: []string{"a", "b", "c"},
+		fail:  map[int]error{2: apierrs.NewGone("the continue token expired")},
+	}
+
+	var continues []string
+	err := Paginate(logtesting.TestContextWithLogger(t), opts, func(got metav1.ListOptions) (string, error) {
+		if got.FieldSelector != opts.FieldSelector || got.Limit != opts.Limit {
+			t.Errorf("page listed with %+v, want the selector and limit of %+v", got, opts)
+		}
+		continues = append(continues, got.Continue)
+		return l.page(got, func(string) {})
+	})
+	if err != nil {
+		t.Fatalf("Paginate() = %v", err)
+	}
+	// The restart lists from the first page again.
+	want := []string{"", "2", "", "2"}
+	if len(continues) != len(want) {
+		t.Fatalf("continue tokens %q, want %q", continues, want)
+	}
+	for i := range want {
+		if continues[i] != want[i] {
+			t.Fatalf("continue tokens %q, want %q", continues, want)
+		}
+	}
+}
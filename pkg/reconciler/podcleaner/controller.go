@@ -0,0 +1,121 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podcleaner
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+
+	"github.com/infernus01/knative-demo/pkg/audit"
+	"github.com/infernus01/knative-demo/pkg/cloudevents"
+	versionedscheme "github.com/infernus01/knative-demo/pkg/generated/clientset/versioned/scheme"
+	"github.com/infernus01/knative-demo/pkg/reconciler/config"
+	"github.com/infernus01/knative-demo/pkg/reconciler/metrics"
+
+	clusteropsclient "github.com/infernus01/knative-demo/pkg/client/injection/client"
+	namespacecleanerinformer "github.com/infernus01/knative-demo/pkg/client/injection/informers/clusterops/v1alpha1/namespacecleaner"
+	podcleanerinformer "github.com/infernus01/knative-demo/pkg/client/injection/informers/clusterops/v1alpha1/podcleaner"
+
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
+)
+
+const (
+	// controllerAgentName is the string used by this controller to identify
+	// itself when creating events.
+	controllerAgentName = "podcleaner-controller"
+)
+
+func init() {
+	// Register our types so events can reference PodCleaners.
+	utilruntime.Must(versionedscheme.AddToScheme(scheme.Scheme))
+}
+
+// NewController creates a Reconciler and returns the result of NewImpl.
+func NewController(
+	ctx context.Context,
+	cmw configmap.Watcher,
+) *controller.Impl {
+	logger := logging.FromContext(ctx)
+
+	podcleanerInformer := podcleanerinformer.Get(ctx)
+	namespacecleanerInformer := namespacecleanerinformer.Get(ctx)
+
+	recorder := controller.GetEventRecorder(ctx)
+	if recorder == nil {
+		logger.Debug("Creating event broadcaster")
+		eventBroadcaster := record.NewBroadcaster()
+		watches := []watch.Interface{
+			eventBroadcaster.StartLogging(logger.Named("event-broadcaster").Infof),
+			eventBroadcaster.StartRecordingToSink(
+				&typedcorev1.EventSinkImpl{Interface: kubeclient.Get(ctx).CoreV1().Events("")}),
+		}
+		recorder = eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
+		go func() {
+			<-ctx.Done()
+			for _, w := range watches {
+				w.Stop()
+			}
+		}()
+	}
+
+	c := &Reconciler{
+		kubeclientset:          kubeclient.Get(ctx),
+		clientset:              clusteropsclient.Get(ctx),
+		podcleanerLister:       podcleanerInformer.Lister(),
+		namespacecleanerLister: namespacecleanerInformer.Lister(),
+		recorder:               recorder,
+		metrics:                metrics.NewRecorder(),
+		auditLog:               audit.Default,
+		events:                 cloudevents.NewEmitter(logger.Named("cloudevents")),
+	}
+	c.PromoteFunc = c.promote
+	c.DemoteFunc = c.demote
+	go c.events.Run(ctx)
+
+	configStore := config.NewStore(logger.Named("config-store"), func(name string, value interface{}) {
+		if cfg, ok := value.(*config.Controller); ok {
+			c.events.SetSink(cfg.CloudEventsSink)
+			if err := c.auditLog.Configure(cfg.Audit); err != nil {
+				logger.Errorw("Failed to configure the audit log", zap.Error(err))
+			}
+		}
+	})
+	configStore.WatchConfigs(cmw)
+	c.configStore = configStore
+
+	impl := controller.NewContext(ctx, c, controller.ControllerOptions{
+		WorkQueueName: controllerAgentName,
+		Logger:        logger,
+	})
+
+	logger.Info("Setting up event handlers")
+
+	// Set up an event handler for when PodCleaner resources change
+	podcleanerInformer.Informer().AddEventHandler(controller.HandleAll(impl.Enqueue))
+
+	return impl
+}
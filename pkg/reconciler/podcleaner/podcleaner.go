@@ -0,0 +1,409 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podcleaner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/kmeta"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/reconciler"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/audit"
+	"github.com/infernus01/knative-demo/pkg/cloudevents"
+	versioned "github.com/infernus01/knative-demo/pkg/generated/clientset/versioned"
+	clusteropslister "github.com/infernus01/knative-demo/pkg/generated/listers/clusterops/v1alpha1"
+	"github.com/infernus01/knative-demo/pkg/policy"
+	"github.com/infernus01/knative-demo/pkg/reconciler/config"
+	"github.com/infernus01/knative-demo/pkg/reconciler/metrics"
+	"github.com/infernus01/knative-demo/pkg/reconciler/paging"
+	"github.com/infernus01/knative-demo/pkg/reconciler/tracing"
+)
+
+const (
+	// maxErrors bounds the errors recorded in status.errors.
+	maxErrors = 20
+
+	// kind identifies PodCleaners in metrics.
+	kind = "PodCleaner"
+)
+
+// Reconciler implements controller.Reconciler for PodCleaner resources.
+type Reconciler struct {
+	// LeaderAwareFuncs tracks the buckets this replica currently leads, so
+	// that each PodCleaner is only ever run by a single replica.
+	reconciler.LeaderAwareFuncs
+
+	kubeclientset          kubernetes.Interface
+	clientset              versioned.Interface
+	podcleanerLister       clusteropslister.PodCleanerLister
+	namespacecleanerLister clusteropslister.NamespaceCleanerLister
+
+	recorder record.EventRecorder
+
+	// metrics records the outcome of every pod deletion.
+	metrics *metrics.Recorder
+
+	// auditLog records every deletion in a tamper-evident log.
+	auditLog *audit.Log
+
+	// events announces every deleted pod as a CloudEvent.
+	events *cloudevents.Emitter
+
+	// configStore attaches the controller ConfigMap settings to each
+	// reconcile's context.
+	configStore reconciler.ConfigStore
+
+	// inflight holds the cancel functions of cleanups that are currently
+	// running, so they can be stopped when their bucket is demoted.
+	inflightMu sync.Mutex
+	inflight   map[types.NamespacedName]context.CancelFunc
+}
+
+// Check that our Reconciler implements Interface
+var _ controller.Reconciler = (*Reconciler)(nil)
+
+// Check that our Reconciler implements LeaderAware
+var _ reconciler.LeaderAware = (*Reconciler)(nil)
+
+// Reconcile implements controller.Reconciler
+func (r *Reconciler) Reconcile(ctx context.Context, key string) error {
+	logger := logging.FromContext(ctx).With(zap.String("podcleaner", key))
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		logger.Errorw("Invalid resource key", zap.Error(err))
+		return nil
+	}
+
+	// Only the replica leading the bucket that owns this key may run it.
+	if !r.IsLeaderFor(types.NamespacedName{Namespace: namespace, Name: name}) {
+		logger.Debug("Not the leader for this PodCleaner, skipping")
+		return controller.NewSkipKey(key)
+	}
+
+	pc, err := r.podcleanerLister.PodCleaners(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		logger.Info("PodCleaner resource no longer exists")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	ctx, done := r.trackRun(ctx, types.NamespacedName{Namespace: namespace, Name: name})
+	defer done()
+
+	ctx = r.configStore.ToContext(ctx)
+	return r.reconcilePodCleaner(ctx, pc)
+}
+
+func (r *Reconciler) reconcilePodCleaner(ctx context.Context, pc *v1alpha1.PodCleaner) error {
+	logger := logging.FromContext(ctx).With(zap.String("podcleaner", pc.Namespace+"/"+pc.Name))
+
+	if pc.Spec.Suspend {
+		logger.Info("PodCleaner is suspended, skipping cleanup")
+		return nil
+	}
+
+	now := time.Now()
+	interval := pc.Spec.GetInterval()
+	if last := pc.Status.LastRunTime; last != nil && pc.Status.ObservedGeneration == pc.Generation {
+		if wait := last.Add(interval).Sub(now); wait > 0 {
+			return controller.NewRequeueAfter(wait)
+		}
+	}
+
+	podPolicy, limited, err := r.effectivePolicy(ctx, pc)
+	if err != nil {
+		return err
+	}
+
+	// The run name identifies the run in every log line, audit record,
+	// CloudEvent and span, as the CleanupRun name does for NamespaceCleaners.
+	run := kmeta.ChildName(pc.Name, fmt.Sprintf("-%d-%s", now.Unix(), rand.String(5)))
+	ctx, span := tracing.Tracer.Start(ctx, "PodCleanerRun", trace.WithAttributes(
+		tracing.CleanerAttr.String(pc.Namespace+"/"+pc.Name),
+		tracing.RunAttr.String(run)))
+	defer span.End()
+	logger = logger.With(zap.String("run", run))
+	ctx = logging.WithLogger(tracing.WithRun(ctx, run), logging.FromContext(ctx).With(zap.String("run", run)))
+
+	status := v1alpha1.PodCleanerStatus{
+		ObservedGeneration: pc.Generation,
+		LastRunTime:        &metav1.Time{Time: now},
+		LastRun:            run,
+	}
+	backoff := policy.NewEvictionBackoff(pc.Status.BlockedPods)
+	if err := r.cleanup(ctx, pc, podPolicy, backoff, &status); err != nil {
+		addError(&status.Errors, err)
+	}
+	if len(status.Errors) > 0 {
+		span.SetStatus(codes.Error, status.Errors[0])
+	}
+	// Record the outcome even when the run was interrupted by a demotion,
+	// but leave the last run time so the next leader runs it right away.
+	interrupted := ctx.Err() != nil
+	ctx = context.WithoutCancel(ctx)
+	status.BlockedPods = backoff.Result(interrupted)
+	if interrupted {
+		status.LastRunTime = pc.Status.LastRunTime
+		span.SetStatus(codes.Error, "Interrupted")
+	}
+
+	logger.Infow("Cleanup completed",
+		zap.Int32("candidates", status.Candidates),
+		zap.Int32("deleted", status.Deleted))
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest, err := r.clientset.ClusteropsV1alpha1().PodCleaners(pc.Namespace).Get(ctx, pc.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		status.Conditions = latest.Status.Conditions
+		meta.SetStatusCondition(&status.Conditions, limited)
+		latest.Status = status
+		_, err = r.clientset.ClusteropsV1alpha1().PodCleaners(pc.Namespace).UpdateStatus(ctx, latest, metav1.UpdateOptions{})
+		return err
+	})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to update PodCleaner status: %w", err)
+	}
+
+	return controller.NewRequeueAfter(interval)
+}
+
+// effectivePolicy returns the policy of pc clamped to the tenant limits of
+// the cluster cleaners selecting its namespace, and the Limited condition
+// describing whether it was clamped. The admission policy rejects PodCleaners
+// beyond these limits, this catches limits tightened after creation.
+func (r *Reconciler) effectivePolicy(ctx context.Context, pc *v1alpha1.PodCleaner) (*v1alpha1.PodPolicy, metav1.Condition, error) {
+	condition := metav1.Condition{
+		Type:               v1alpha1.ConditionLimited,
+		Status:             metav1.ConditionFalse,
+		Reason:             "WithinLimits",
+		Message:            "The spec is within the limits of the cluster cleaners",
+		ObservedGeneration: pc.Generation,
+	}
+
+	ns, err := r.kubeclientset.CoreV1().Namespaces().Get(ctx, pc.Namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, condition, fmt.Errorf("failed to get namespace %s: %w", pc.Namespace, err)
+	}
+	cleaners, err := r.namespacecleanerLister.List(labels.Everything())
+	if err != nil {
+		return nil, condition, fmt.Errorf("failed to list NamespaceCleaners: %w", err)
+	}
+
+	podPolicy := pc.Spec.PodPolicy.DeepCopy()
+	if minTTL, by := policy.TenantMinTTL(cleaners, ns); policy.RaiseTTL(podPolicy, minTTL) {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "MinTTL"
+		condition.Message = fmt.Sprintf("ttl raised to %s by the tenant limits of NamespaceCleaner %s", minTTL, by)
+		if !meta.IsStatusConditionTrue(pc.Status.Conditions, v1alpha1.ConditionLimited) {
+			r.recorder.Event(pc, corev1.EventTypeWarning, "Limited", condition.Message)
+		}
+	}
+	return podPolicy, condition, nil
+}
+
+// cleanup deletes the pods in the namespace of pc that podPolicy selects,
+// counting them in status.
+func (r *Reconciler) cleanup(ctx context.Context, pc *v1alpha1.PodCleaner, podPolicy *v1alpha1.PodPolicy, backoff *policy.EvictionBackoff, status *v1alpha1.PodCleanerStatus) error {
+	cfg := config.FromContextOrDefaults(ctx).Controller
+
+	for _, phase := range policy.FinishedPhases {
+		opts := metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("status.phase", string(phase)).String(),
+			Limit:         cfg.ListPageSize,
+		}
+		err := paging.Paginate(ctx, opts, func(opts metav1.ListOptions) (string, error) {
+			list, err := r.kubeclientset.CoreV1().Pods(pc.Namespace).List(ctx, opts)
+			if err != nil {
+				return "", err
+			}
+			for i := range list.Items {
+				// Stop as soon as the run is cancelled by a demotion.
+				if err := ctx.Err(); err != nil {
+					return "", err
+				}
+				r.cleanupPod(ctx, pc, podPolicy, backoff, status, &list.Items[i])
+			}
+			return list.Continue, nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list pods: %w", err)
+		}
+	}
+	return nil
+}
+
+// cleanupPod deletes or evicts pod if podPolicy selects it and counts the
+// outcome in status.
+func (r *Reconciler) cleanupPod(ctx context.Context, pc *v1alpha1.PodCleaner, podPolicy *v1alpha1.PodPolicy, backoff *policy.EvictionBackoff, status *v1alpha1.PodCleanerStatus, pod *corev1.Pod) {
+	logger := logging.FromContext(ctx).With(zap.String("namespace", pc.Namespace))
+	name := pc.Namespace + "/" + pc.Name
+
+	decision := policy.EvaluatePod(podPolicy, pod, time.Now())
+	if !decision.Delete {
+		return
+	}
+	status.Candidates++
+
+	if pc.Spec.DryRun {
+		logger.Infow("Dry run: would delete pod",
+			zap.String("pod", pod.Name),
+			zap.String("reason", decision.Reason))
+		r.recordAudit(ctx, pc, podPolicy, pod, decision, status)
+		return
+	}
+
+	if backoff.Deferred(pod, time.Now()) {
+		return
+	}
+
+	logger.Infow("Deleting pod",
+		zap.String("pod", pod.Name),
+		zap.String("action", string(podPolicy.Action)),
+		zap.String("reason", decision.Reason))
+	err := tracing.TraceDelete(ctx, "Pod", pod, func(ctx context.Context) error {
+		return policy.Remove(ctx, r.kubeclientset, podPolicy, pod)
+	})
+	if policy.BlockedByBudget(podPolicy, err) {
+		logger.Infow("Eviction blocked by a disruption budget",
+			zap.String("pod", pod.Name),
+			zap.Error(err))
+		backoff.Blocked(pod, time.Now(), err)
+		r.metrics.Blocked(ctx, kind, name)
+		return
+	} else if reason, ok := metrics.SkipReason(err); ok {
+		logger.Infow("Skipping pod deletion",
+			zap.String("pod", pod.Name),
+			zap.String("reason", reason))
+		status.Skipped++
+		r.metrics.Skipped(ctx, kind, name, reason)
+		return
+	} else if err != nil {
+		logger.Errorw("Failed to delete pod", zap.String("pod", pod.Name), zap.Error(err))
+		addError(&status.Errors, fmt.Errorf("failed to delete pod %s: %w", pod.Name, err))
+		r.metrics.Failed(ctx, kind, name)
+		return
+	}
+	status.Deleted++
+	r.metrics.Deleted(ctx, kind, name)
+	r.recordAudit(ctx, pc, podPolicy, pod, decision, status)
+	r.events.Emit(cloudevents.PodDeleted(eventSource(pc), name, tracing.RunFrom(ctx), pod, decision.Rule, decision.Reason))
+}
+
+// eventSource identifies pc as the source of CloudEvents.
+func eventSource(pc *v1alpha1.PodCleaner) string {
+	return "/apis/" + v1alpha1.SchemeGroupVersion.String() + "/namespaces/" + pc.Namespace + "/podcleaners/" + pc.Name
+}
+
+// recordAudit appends the deletion of pod by pc as decided to the audit log.
+func (r *Reconciler) recordAudit(ctx context.Context, pc *v1alpha1.PodCleaner, podPolicy *v1alpha1.PodPolicy, pod *corev1.Pod, decision policy.PodDecision, status *v1alpha1.PodCleanerStatus) {
+	action := audit.ActionDelete
+	if podPolicy.Action == v1alpha1.PodActionEvict {
+		action = audit.ActionEvict
+	}
+	record := audit.NewRecord(action, "v1", "Pod", pod)
+	record.CleanerKind = kind
+	record.Cleaner = pc.Namespace + "/" + pc.Name
+	record.Rule = decision.Rule
+	record.Reason = decision.Reason
+	record.Run = tracing.RunFrom(ctx)
+	record.DryRun = pc.Spec.DryRun
+	if err := r.auditLog.Record(record); err != nil {
+		logging.FromContext(ctx).Errorw("Failed to write audit record", zap.Error(err))
+		addError(&status.Errors, err)
+	}
+}
+
+// promote enqueues every PodCleaner so the buckets this replica just
+// started leading are picked up immediately.
+func (r *Reconciler) promote(bkt reconciler.Bucket, enq func(reconciler.Bucket, types.NamespacedName)) error {
+	cleaners, err := r.podcleanerLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list podcleaners: %w", err)
+	}
+
+	for _, pc := range cleaners {
+		// enq drops keys that do not belong to bkt.
+		enq(bkt, types.NamespacedName{Namespace: pc.Namespace, Name: pc.Name})
+	}
+	return nil
+}
+
+// trackRun registers a cancellable context for the cleanup of key, so that
+// Demote can stop it. The returned function must be called once the run ends.
+func (r *Reconciler) trackRun(ctx context.Context, key types.NamespacedName) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	r.inflightMu.Lock()
+	if r.inflight == nil {
+		r.inflight = make(map[types.NamespacedName]context.CancelFunc)
+	}
+	r.inflight[key] = cancel
+	r.inflightMu.Unlock()
+
+	return ctx, func() {
+		r.inflightMu.Lock()
+		delete(r.inflight, key)
+		r.inflightMu.Unlock()
+		cancel()
+	}
+}
+
+// demote stops the in-flight cleanups of keys owned by the lost bucket.
+func (r *Reconciler) demote(bkt reconciler.Bucket) {
+	r.inflightMu.Lock()
+	defer r.inflightMu.Unlock()
+
+	for key, cancel := range r.inflight {
+		if bkt.Has(key) {
+			cancel()
+		}
+	}
+}
+
+// addError appends err to errs unless maxErrors was already reached.
+func addError(errs *[]string, err error) {
+	if len(*errs) < maxErrors {
+		*errs = append(*errs, err.Error())
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podcleaner
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+	clusteropslister "github.com/infernus01/knative-demo/pkg/generated/listers/clusterops/v1alpha1"
+)
+
+func TestEffectivePolicy(t *testing.T) {
+	ctx := logtesting.TestContextWithLogger(t)
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"tier": "dev"}}}
+	cleaners := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	cleaners.Add(&v1alpha1.NamespaceCleaner{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev"},
+		Spec: v1alpha1.NamespaceCleanerSpec{
+			Selector:     metav1.LabelSelector{MatchLabels: map[string]string{"tier": "dev"}},
+			TenantLimits: &v1alpha1.TenantLimits{MinTTL: &metav1.Duration{Duration: time.Hour}},
+		},
+	})
+	podCleaner := func(ttl time.Duration, conditions ...metav1.Condition) *v1alpha1.PodCleaner {
+		return &v1alpha1.PodCleaner{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cleanup", Generation: 2},
+			Spec:       v1alpha1.PodCleanerSpec{PodPolicy: v1alpha1.PodPolicy{TTL: &metav1.Duration{Duration: ttl}}},
+			Status:     v1alpha1.PodCleanerStatus{Conditions: conditions},
+		}
+	}
+	limitedCondition := metav1.Condition{Type: v1alpha1.ConditionLimited, Status: metav1.ConditionTrue, Reason: "MinTTL"}
+
+	tests := []struct {
+		name    string
+		pc      *v1alpha1.PodCleaner
+		ttl     time.Duration
+		limited bool
+		events  int
+	}{{
+		name: "within the limits",
+		pc:   podCleaner(2 * time.Hour),
+		ttl:  2 * time.Hour,
+	}, {
+		name:    "raised",
+		pc:      podCleaner(time.Minute),
+		ttl:     time.Hour,
+		limited: true,
+		events:  1,
+	}, {
+		// The warning is only recorded when the condition turns True.
+		name:    "raised again",
+		pc:      podCleaner(time.Minute, limitedCondition),
+		ttl:     time.Hour,
+		limited: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &Reconciler{
+				kubeclientset:          fake.NewClientset(ns),
+				namespacecleanerLister: clusteropslister.NewNamespaceCleanerLister(cleaners),
+				recorder:               recorder,
+			}
+			before := test.pc.DeepCopy()
+			got, condition, err := r.effectivePolicy(ctx, test.pc)
+			if err != nil {
+				t.Fatal("effectivePolicy() =", err)
+			}
+			if ttl := got.GetTTL(); ttl != test.ttl {
+				t.Errorf("ttl = %s, want %s", ttl, test.ttl)
+			}
+			if limited := condition.Status == metav1.ConditionTrue; limited != test.limited {
+				t.Errorf("condition = %+v, want limited %v", condition, test.limited)
+			}
+			if condition.ObservedGeneration != test.pc.Generation {
+				t.Errorf("condition observed generation %d, want %d", condition.ObservedGeneration, test.pc.Generation)
+			}
+			if len(recorder.Events) != test.events {
+				t.Errorf("recorded %d events, want %d", len(recorder.Events), test.events)
+			}
+			// The PodCleaner itself is left as it was.
+			if !equality.Semantic.DeepEqual(test.pc, before) {
+				t.Errorf("effectivePolicy() changed the PodCleaner to %+v", test.pc)
+			}
+		})
+	}
+
+	// Without the namespace there are no limits to apply.
+	r := &Reconciler{
+		kubeclientset:          fake.NewClientset(),
+		namespacecleanerLister: clusteropslister.NewNamespaceCleanerLister(cleaners),
+		recorder:               record.NewFakeRecorder(10),
+	}
+	if _, _, err := r.effectivePolicy(ctx, podCleaner(time.Minute)); err == nil {
+		t.Error("effectivePolicy() = nil, want an error for a missing namespace")
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing traces cleanup runs and tags what they record with the
+// run they belong to.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/infernus01/knative-demo/pkg/apis/clusterops/v1alpha1"
+)
+
+// Tracer creates the spans of cleanup runs. They are exported through the
+// tracer provider that sharedmain configures from config-observability.
+var Tracer = otel.Tracer("github.com/infernus01/knative-demo/pkg/reconciler")
+
+// Attributes of the spans.
+var (
+	CleanerAttr   = attribute.Key("clusterops.cleaner.name")
+	RunAttr       = attribute.Key("clusterops.run")
+	NamespaceAttr = attribute.Key("k8s.namespace.name")
+	ObjectAttr    = attribute.Key("clusterops.object.name")
+	UIDAttr       = attribute.Key("clusterops.object.uid")
+)
+
+// EndSpan ends span, recording err as its status.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceDelete calls del, the API call deleting obj of the given kind, in a
+// span of its own.
+func TraceDelete(ctx context.Context, kind string, obj metav1.Object, del func(context.Context) error) error {
+	ctx, span := Tracer.Start(ctx, "Delete"+kind,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			NamespaceAttr.String(obj.GetNamespace()),
+			ObjectAttr.String(obj.GetName()),
+			UIDAttr.String(string(obj.GetUID()))))
+	err := del(ctx)
+	EndSpan(span, err)
+	return err
+}
+
+// runKey is the context key of the run being performed.
+type runKey struct{}
+
+// WithRun attaches the name of the run being performed to ctx.
+func WithRun(ctx context.Context, run string) context.Context {
+	return context.WithValue(ctx, runKey{}, run)
+}
+
+// RunFrom returns the name of the run attached to ctx, if any.
+func RunFrom(ctx context.Context) string {
+	run, _ := ctx.Value(runKey{}).(string)
+	return run
+}
+
+// Recorder returns recorder annotating its events with the run attached to
+// ctx, if any.
+func Recorder(ctx context.Context, recorder record.EventRecorder) record.EventRecorder {
+	run := RunFrom(ctx)
+	if run == "" {
+		return recorder
+	}
+	return &annotatingRecorder{EventRecorder: recorder, run: run}
+}
+
+// annotatingRecorder sets v1alpha1.RunAnnotation on every event it records.
+type annotatingRecorder struct {
+	record.EventRecorder
+	run string
+}
+
+func (r *annotatingRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.AnnotatedEventf(object, nil, eventtype, reason, "%s", message)
+}
+
+func (r *annotatingRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.AnnotatedEventf(object, nil, eventtype, reason, messageFmt, args...)
+}
+
+func (r *annotatingRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	annotated := make(map[string]string, len(annotations)+1)
+	for k, v := range annotations {
+		annotated[k] = v
+	}
+	annotated[v1alpha1.RunAnnotation] = r.run
+	r.EventRecorder.AnnotatedEventf(object, annotated, eventtype, reason, messageFmt, args...)
+}